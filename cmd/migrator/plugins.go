@@ -0,0 +1,7 @@
+package main
+
+// Пакеты со своими трансформерами строк подключаются здесь пустым импортом: их init() вызывает
+// transform.Register из logs-migrator/pkg/transform до разбора конфига. Вне этого репозитория мигратор
+// с ними собирается через logs-migrator/pkg/cli. Например:
+//
+//	import _ "example.com/acme/migrator-transforms"
@@ -0,0 +1,519 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// maxPacket максимальный размер пакета протокола MySQL: пакеты длиннее делятся на части
+const maxPacket = 1<<24 - 1
+
+// Первый байт ответа сервера
+const (
+	respOK         = 0x00
+	respMoreData   = 0x01
+	respEOF        = 0xfe
+	respErr        = 0xff
+	respAuthSwitch = respEOF
+)
+
+// Команды протокола
+const (
+	comQuery         = 0x03
+	comBinlogDump    = 0x12
+	comRegisterSlave = 0x15
+)
+
+// Плагины авторизации
+const (
+	pluginNative      = "mysql_native_password"
+	pluginCachingSHA2 = "caching_sha2_password"
+)
+
+const (
+	charsetUTF8MB4   = 45
+	handshakeTimeout = 30 * time.Second
+)
+
+// Флаги возможностей клиента
+const (
+	clientLongPassword = 1 << 0
+	clientProtocol41   = 1 << 9
+	clientSSL          = 1 << 11
+	clientTransactions = 1 << 13
+	clientSecureConn   = 1 << 15
+	clientPluginAuth   = 1 << 19
+)
+
+// errMalformed ответ сервера короче, чем требует протокол
+var errMalformed = errors.New("malformed packet")
+
+// Options параметры подключения реплики
+type Options struct {
+	// ServerID идентификатор реплики, уникальный среди реплик источника. Реплику с тем же идентификатором
+	// источник отключит
+	ServerID uint32
+
+	// Checksum события заканчиваются CRC32 (binlog_checksum = CRC32 на источнике)
+	Checksum bool
+
+	// Heartbeat период heartbeat-событий, которые источник шлет, когда новых событий нет (0 - выключены).
+	// Если за три периода не пришло ни одного события, чтение завершается ошибкой
+	Heartbeat time.Duration
+}
+
+// Conn соединение с источником в роли реплики. Поддерживает авторизацию mysql_native_password
+// и caching_sha2_password, в том числе через TLS
+type Conn struct {
+	nc   net.Conn
+	r    *bufio.Reader
+	seq  byte
+	opts Options
+}
+
+// Dial подключается к серверу из DSN в формате go-sql-driver/mysql и авторизуется. TLS включается параметром
+// tls из DSN. Если сервер TLS не поддерживает, подключение завершается ошибкой при любом значении tls,
+// в том числе preferred: соединение реплики не понижается до открытого молча
+func Dial(ctx context.Context, dsn string, opts Options) (*Conn, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, cfg.Net, cfg.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("dial %s: %w", cfg.Addr, err)
+	}
+
+	c := &Conn{nc: nc, r: bufio.NewReaderSize(nc, 64<<10), opts: opts}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(handshakeTimeout)
+	}
+	_ = nc.SetDeadline(deadline)
+
+	if err := c.handshake(cfg.User, cfg.Passwd, cfg.Net == "unix", cfg.TLS); err != nil {
+		_ = nc.Close()
+		return nil, fmt.Errorf("binlog connection to %s: %w", cfg.Addr, err)
+	}
+	_ = nc.SetDeadline(time.Time{})
+
+	return c, nil
+}
+
+// Close закрывает соединение. Вызов из другой горутины прерывает ожидание события
+func (c *Conn) Close() error {
+	return c.nc.Close()
+}
+
+// Exec выполняет запрос, который не возвращает строк, например SET
+func (c *Conn) Exec(query string) error {
+	c.seq = 0
+	if err := c.writePacket(append([]byte{comQuery}, query...)); err != nil {
+		return err
+	}
+	return c.readOK()
+}
+
+// Dump регистрирует реплику и запрашивает поток событий binlog с позиции pos
+func (c *Conn) Dump(pos Position) (*Stream, error) {
+	checksum := "NONE"
+	if c.opts.Checksum {
+		checksum = "CRC32"
+	}
+	if err := c.Exec("SET @master_binlog_checksum = '" + checksum + "'"); err != nil {
+		return nil, fmt.Errorf("set binlog checksum: %w", err)
+	}
+	if c.opts.Heartbeat > 0 {
+		if err := c.Exec(fmt.Sprintf("SET @master_heartbeat_period = %d", c.opts.Heartbeat.Nanoseconds())); err != nil {
+			return nil, fmt.Errorf("set heartbeat period: %w", err)
+		}
+	}
+
+	// Регистрация нужна, чтобы реплика была видна в SHOW REPLICAS. Хост, пользователь и порт не передаются
+	buf := []byte{comRegisterSlave}
+	buf = binary.LittleEndian.AppendUint32(buf, c.opts.ServerID)
+	buf = append(buf, 0, 0, 0)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	c.seq = 0
+	if err := c.writePacket(buf); err != nil {
+		return nil, err
+	}
+	if err := c.readOK(); err != nil {
+		return nil, fmt.Errorf("register replica: %w", err)
+	}
+
+	buf = []byte{comBinlogDump}
+	buf = binary.LittleEndian.AppendUint32(buf, pos.Pos)
+	buf = binary.LittleEndian.AppendUint16(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, c.opts.ServerID)
+	buf = append(buf, pos.File...)
+	c.seq = 0
+	if err := c.writePacket(buf); err != nil {
+		return nil, err
+	}
+
+	return newStream(c, pos, c.opts.Checksum), nil
+}
+
+// readEvent читает следующее событие потока binlog без маркера OK
+func (c *Conn) readEvent() ([]byte, error) {
+	if c.opts.Heartbeat > 0 {
+		_ = c.nc.SetReadDeadline(time.Now().Add(3 * c.opts.Heartbeat))
+	}
+
+	data, err := c.readPacket()
+	if err != nil {
+		return nil, err
+	}
+
+	switch data[0] {
+	case respOK:
+		return data[1:], nil
+	case respErr:
+		return nil, parseError(data)
+	case respEOF:
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("unexpected binlog packet 0x%02x", data[0])
+	}
+}
+
+// handshake разбирает приветствие сервера, переходит на TLS, если задан tlsConf, отправляет ответ с авторизацией
+// и ждет ее результата
+func (c *Conn) handshake(user, password string, unix bool, tlsConf *tls.Config) error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if data[0] == respErr {
+		return parseError(data)
+	}
+	if data[0] != 10 {
+		return fmt.Errorf("unsupported protocol version %d", data[0])
+	}
+
+	// Версия сервера, id соединения, первые 8 байт scramble и младшие флаги возможностей
+	pos := bytes.IndexByte(data[1:], 0) + 2
+	if pos < 2 || len(data) < pos+4+8+1+2 {
+		return errMalformed
+	}
+	pos += 4
+	scramble := append([]byte{}, data[pos:pos+8]...)
+	pos += 8 + 1
+	caps := uint32(binary.LittleEndian.Uint16(data[pos:]))
+	pos += 2
+
+	plugin := pluginNative
+	if len(data) >= pos+1+2+2+1+10 {
+		pos += 1 + 2
+		caps |= uint32(binary.LittleEndian.Uint16(data[pos:])) << 16
+		pos += 2
+		authLen := int(data[pos])
+		pos += 1 + 10
+
+		if caps&clientSecureConn != 0 {
+			n := max(13, authLen-8)
+			if len(data) < pos+n {
+				return errMalformed
+			}
+			scramble = append(scramble, data[pos:pos+12]...)
+			pos += n
+		}
+		if caps&clientPluginAuth != 0 && pos < len(data) {
+			plugin = string(bytes.TrimRight(data[pos:], "\x00"))
+		}
+	}
+	if caps&clientProtocol41 == 0 || caps&clientSecureConn == 0 || len(scramble) < 20 {
+		return fmt.Errorf("server does not support protocol 4.1 authentication")
+	}
+
+	// С незнакомым плагином отвечаем mysql_native_password: сервер попросит сменить метод, если нужно
+	if plugin != pluginNative && plugin != pluginCachingSHA2 {
+		plugin = pluginNative
+	}
+	auth, err := authResponse(plugin, scramble, password)
+	if err != nil {
+		return err
+	}
+
+	flags := uint32(clientLongPassword | clientProtocol41 | clientTransactions | clientSecureConn | clientPluginAuth)
+	if tlsConf != nil {
+		if caps&clientSSL == 0 {
+			return fmt.Errorf("server does not support TLS")
+		}
+		flags |= clientSSL
+	}
+
+	buf := binary.LittleEndian.AppendUint32(nil, flags)
+	buf = binary.LittleEndian.AppendUint32(buf, maxPacket)
+	buf = append(buf, charsetUTF8MB4)
+	buf = append(buf, make([]byte, 23)...)
+
+	// Запрос TLS - начало ответа до имени пользователя. После него соединение переходит на TLS, и ответ
+	// с авторизацией уходит уже зашифрованным
+	if tlsConf != nil {
+		if err := c.writePacket(buf); err != nil {
+			return err
+		}
+		tc := tls.Client(c.nc, tlsConf)
+		if err := tc.Handshake(); err != nil {
+			return fmt.Errorf("TLS handshake: %w", err)
+		}
+		c.nc, c.r = tc, bufio.NewReaderSize(tc, 64<<10)
+	}
+
+	buf = append(buf, user...)
+	buf = append(buf, 0, byte(len(auth)))
+	buf = append(buf, auth...)
+	buf = append(buf, plugin...)
+	buf = append(buf, 0)
+	if err := c.writePacket(buf); err != nil {
+		return err
+	}
+
+	return c.authResult(plugin, scramble, password, unix || tlsConf != nil)
+}
+
+// authResult обрабатывает ответы сервера на авторизацию: смену метода и полную авторизацию caching_sha2_password.
+// secure - соединение через сокет или TLS, по нему пароль можно передать как есть
+func (c *Conn) authResult(plugin string, scramble []byte, password string, secure bool) error {
+	for {
+		data, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+
+		switch data[0] {
+		case respOK:
+			return nil
+		case respErr:
+			return parseError(data)
+
+		case respAuthSwitch:
+			name, rest, ok := bytes.Cut(data[1:], []byte{0})
+			if !ok || len(rest) < 20 {
+				return fmt.Errorf("unsupported auth switch request")
+			}
+			plugin, scramble = string(name), append([]byte{}, rest[:20]...)
+			auth, err := authResponse(plugin, scramble, password)
+			if err != nil {
+				return err
+			}
+			if err := c.writePacket(auth); err != nil {
+				return err
+			}
+
+		case respMoreData:
+			if plugin != pluginCachingSHA2 || len(data) < 2 {
+				return fmt.Errorf("unexpected auth data for %s", plugin)
+			}
+			switch data[1] {
+			case 3:
+				// Быстрая авторизация по кэшу сервера, дальше придет OK
+			case 4:
+				// Полная авторизация: пароль передается как есть только через сокет или TLS, иначе
+				// зашифрованным открытым ключом сервера
+				if secure {
+					if err := c.writePacket(append([]byte(password), 0)); err != nil {
+						return err
+					}
+					continue
+				}
+				if err := c.writePacket([]byte{2}); err != nil {
+					return err
+				}
+				key, err := c.readPacket()
+				if err != nil {
+					return err
+				}
+				if key[0] != respMoreData {
+					return fmt.Errorf("server did not send its public key")
+				}
+				enc, err := encryptPassword(password, scramble, key[1:])
+				if err != nil {
+					return err
+				}
+				if err := c.writePacket(enc); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unexpected caching_sha2_password state %d", data[1])
+			}
+
+		default:
+			return fmt.Errorf("unexpected auth packet 0x%02x", data[0])
+		}
+	}
+}
+
+// authResponse возвращает ответ на scramble для плагина авторизации
+func authResponse(plugin string, scramble []byte, password string) ([]byte, error) {
+	switch plugin {
+	case pluginNative:
+		return scrambleNative(scramble, password), nil
+	case pluginCachingSHA2:
+		return scrambleSHA256(scramble, password), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth plugin %s", plugin)
+	}
+}
+
+// scrambleNative SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+func scrambleNative(scramble []byte, password string) []byte {
+	if password == "" {
+		return nil
+	}
+
+	s1 := sha1.Sum([]byte(password))
+	s2 := sha1.Sum(s1[:])
+	h := sha1.New()
+	h.Write(scramble[:20])
+	h.Write(s2[:])
+	s3 := h.Sum(nil)
+
+	for i := range s3 {
+		s3[i] ^= s1[i]
+	}
+	return s3
+}
+
+// scrambleSHA256 SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+func scrambleSHA256(scramble []byte, password string) []byte {
+	if password == "" {
+		return nil
+	}
+
+	m1 := sha256.Sum256([]byte(password))
+	m2 := sha256.Sum256(m1[:])
+	h := sha256.New()
+	h.Write(m2[:])
+	h.Write(scramble)
+	m3 := h.Sum(nil)
+
+	for i := range m3 {
+		m3[i] ^= m1[i]
+	}
+	return m3
+}
+
+// encryptPassword шифрует пароль с нулевым байтом, перемешанный со scramble, открытым ключом сервера (RSA-OAEP)
+func encryptPassword(password string, scramble, pemKey []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemKey)
+	if block == nil {
+		return nil, fmt.Errorf("invalid server public key")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse server public key: %w", err)
+	}
+	rsaKey, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("server public key is not RSA")
+	}
+
+	plain := append([]byte(password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	return rsa.EncryptOAEP(sha1.New(), rand.Reader, rsaKey, plain, nil)
+}
+
+// readOK читает ответ на команду: OK или ошибку
+func (c *Conn) readOK() error {
+	data, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+
+	switch data[0] {
+	case respOK:
+		return nil
+	case respErr:
+		return parseError(data)
+	default:
+		return fmt.Errorf("unexpected response 0x%02x", data[0])
+	}
+}
+
+// readPacket читает пакет, собирая его из частей по maxPacket байт
+func (c *Conn) readPacket() ([]byte, error) {
+	var payload []byte
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(c.r, hdr[:]); err != nil {
+			return nil, err
+		}
+		n := int(hdr[0]) | int(hdr[1])<<8 | int(hdr[2])<<16
+		c.seq = hdr[3] + 1
+
+		part := make([]byte, n)
+		if _, err := io.ReadFull(c.r, part); err != nil {
+			return nil, err
+		}
+		payload = append(payload, part...)
+
+		if n < maxPacket {
+			if len(payload) == 0 {
+				return nil, errMalformed
+			}
+			return payload, nil
+		}
+	}
+}
+
+// writePacket отправляет пакет, деля его на части по maxPacket байт
+func (c *Conn) writePacket(data []byte) error {
+	for {
+		n := min(len(data), maxPacket)
+		buf := make([]byte, 4, 4+n)
+		buf[0], buf[1], buf[2], buf[3] = byte(n), byte(n>>8), byte(n>>16), c.seq
+		c.seq++
+
+		if _, err := c.nc.Write(append(buf, data[:n]...)); err != nil {
+			return err
+		}
+		data = data[n:]
+
+		if n < maxPacket {
+			return nil
+		}
+	}
+}
+
+// parseError разбирает пакет ошибки в ошибку драйвера, чтобы ее можно было классифицировать как обычные ошибки MySQL
+func parseError(data []byte) error {
+	if len(data) < 3 {
+		return errMalformed
+	}
+
+	e := &mysql.MySQLError{Number: binary.LittleEndian.Uint16(data[1:3])}
+	msg := data[3:]
+	if len(msg) >= 6 && msg[0] == '#' {
+		copy(e.SQLState[:], msg[1:6])
+		msg = msg[6:]
+	}
+	e.Message = string(msg)
+
+	return e
+}
@@ -0,0 +1,267 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// fakeSource минимальный источник: приветствие с mysql_native_password, OK на команды и поток событий
+// на COM_BINLOG_DUMP. С tls источник предлагает TLS и переходит на него по запросу клиента
+type fakeSource struct {
+	t        *testing.T
+	password string
+	events   [][]byte
+	tls      *tls.Config
+
+	queries []string
+	dump    []byte
+}
+
+func (f *fakeSource) serve(c net.Conn) {
+	defer c.Close()
+	conn := &Conn{nc: c, r: bufio.NewReader(c)}
+
+	scramble := []byte("abcdefghijklmnopqrst")
+	hello := []byte{10}
+	hello = append(hello, "8.0.36\x00"...)
+	hello = binary.LittleEndian.AppendUint32(hello, 1)
+	hello = append(hello, scramble[:8]...)
+	hello = append(hello, 0)
+	caps := uint32(clientLongPassword | clientProtocol41 | clientTransactions | clientSecureConn | clientPluginAuth)
+	if f.tls != nil {
+		caps |= clientSSL
+	}
+	hello = binary.LittleEndian.AppendUint16(hello, uint16(caps))
+	hello = append(hello, charsetUTF8MB4, 2, 0)
+	hello = binary.LittleEndian.AppendUint16(hello, uint16(caps>>16))
+	hello = append(hello, 21)
+	hello = append(hello, make([]byte, 10)...)
+	hello = append(hello, scramble[8:]...)
+	hello = append(hello, 0)
+	hello = append(hello, pluginNative+"\x00"...)
+	if err := conn.writePacket(hello); err != nil {
+		f.t.Errorf("write handshake: %v", err)
+		return
+	}
+
+	resp, err := conn.readPacket()
+	if errors.Is(err, io.EOF) {
+		// Клиент отказался продолжать после приветствия
+		return
+	}
+	if err != nil {
+		f.t.Errorf("read handshake response: %v", err)
+		return
+	}
+	if f.tls != nil {
+		if len(resp) != 32 || binary.LittleEndian.Uint32(resp)&clientSSL == 0 {
+			f.t.Errorf("handshake response is not an SSL request: %x", resp)
+			return
+		}
+		// ClientHello мог уже попасть в буфер чтения вместе с запросом TLS
+		tc := tls.Server(bufferedConn{Conn: c, r: conn.r}, f.tls)
+		conn.nc, conn.r = tc, bufio.NewReader(tc)
+		if resp, err = conn.readPacket(); err != nil {
+			f.t.Errorf("read handshake response over TLS: %v", err)
+			return
+		}
+	}
+	if !bytes.Contains(resp, nativeScramble(scramble, f.password)) {
+		_ = conn.writePacket([]byte{respErr, 0x15, 0x04, '#', '2', '8', '0', '0', '0', 'A', 'c', 'c', 'e', 's', 's'})
+		return
+	}
+	_ = conn.writePacket([]byte{respOK, 0, 0, 2, 0, 0, 0})
+
+	for {
+		conn.seq = 0
+		cmd, err := conn.readPacket()
+		if err != nil {
+			return
+		}
+
+		switch cmd[0] {
+		case comQuery:
+			f.queries = append(f.queries, string(cmd[1:]))
+			_ = conn.writePacket([]byte{respOK, 0, 0, 2, 0, 0, 0})
+		case comRegisterSlave:
+			_ = conn.writePacket([]byte{respOK, 0, 0, 2, 0, 0, 0})
+		case comBinlogDump:
+			f.dump = cmd
+			for _, ev := range f.events {
+				_ = conn.writePacket(append([]byte{respOK}, ev...))
+			}
+			_ = conn.writePacket([]byte{respEOF, 0, 0, 2, 0})
+			return
+		}
+	}
+}
+
+// bufferedConn соединение, которое читает через буфер, уже заполненный из него
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// nativeScramble ответ mysql_native_password, посчитанный независимо от scrambleNative
+func nativeScramble(scramble []byte, password string) []byte {
+	s1 := sha1.Sum([]byte(password))
+	s2 := sha1.Sum(s1[:])
+	s3 := sha1.Sum(append(append([]byte{}, scramble...), s2[:]...))
+	for i := range s3 {
+		s3[i] ^= s1[i]
+	}
+	return s3[:]
+}
+
+func startFakeSource(t *testing.T, f *fakeSource) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		f.serve(c)
+	}()
+	return ln.Addr().String()
+}
+
+func TestDump(t *testing.T) {
+	rotate := binary.LittleEndian.AppendUint64(nil, 4)
+	rotate = append(rotate, "bin.000007"...)
+	f := &fakeSource{
+		t:        t,
+		password: "secret",
+		events: [][]byte{
+			testEvent(RotateEvent, 0, rotate, true),
+			testEvent(XIDEvent, 120, binary.LittleEndian.AppendUint64(nil, 1), true),
+		},
+	}
+	addr := startFakeSource(t, f)
+
+	conn, err := Dial(context.Background(), "repl:secret@tcp("+addr+")/", Options{ServerID: 77, Checksum: true})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := conn.Dump(Position{File: "bin.000007", Pos: 4})
+	if err != nil {
+		t.Fatalf("Dump() error = %v", err)
+	}
+
+	var types []EventType
+	for {
+		ev, err := stream.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		types = append(types, ev.Type)
+	}
+
+	if len(types) != 2 || types[0] != RotateEvent || types[1] != XIDEvent {
+		t.Errorf("events = %v, want rotate and xid", types)
+	}
+	if stream.Pos() != (Position{File: "bin.000007", Pos: 120}) {
+		t.Errorf("Pos() = %s, want bin.000007:120", stream.Pos())
+	}
+	if len(f.queries) != 1 || !strings.Contains(f.queries[0], "'CRC32'") {
+		t.Errorf("queries = %q, want checksum setup", f.queries)
+	}
+	if id := binary.LittleEndian.Uint32(f.dump[7:]); id != 77 || string(f.dump[11:]) != "bin.000007" {
+		t.Errorf("dump request server id = %d, file = %q", id, f.dump[11:])
+	}
+}
+
+func TestDialAccessDenied(t *testing.T) {
+	addr := startFakeSource(t, &fakeSource{t: t, password: "secret"})
+
+	_, err := Dial(context.Background(), "repl:wrong@tcp("+addr+")/", Options{ServerID: 77})
+	var myErr *mysql.MySQLError
+	if !errors.As(err, &myErr) || myErr.Number != 1045 {
+		t.Errorf("Dial() error = %v, want MySQL error 1045", err)
+	}
+}
+
+func TestDialTLSNotSupported(t *testing.T) {
+	for _, mode := range []string{"true", "skip-verify", "preferred"} {
+		t.Run(mode, func(t *testing.T) {
+			addr := startFakeSource(t, &fakeSource{t: t, password: "secret"})
+
+			_, err := Dial(context.Background(), "repl:secret@tcp("+addr+")/?tls="+mode, Options{ServerID: 77})
+			if err == nil || !strings.Contains(err.Error(), "server does not support TLS") {
+				t.Errorf("Dial() error = %v, want TLS refusal", err)
+			}
+		})
+	}
+}
+
+// testTLSConfig конфигурация TLS источника с самоподписанным сертификатом
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestDialTLS(t *testing.T) {
+	for _, mode := range []string{"skip-verify", "preferred"} {
+		t.Run(mode, func(t *testing.T) {
+			f := &fakeSource{t: t, password: "secret", tls: testTLSConfig(t)}
+			addr := startFakeSource(t, f)
+
+			c, err := Dial(context.Background(), "repl:secret@tcp("+addr+")/?tls="+mode, Options{ServerID: 77})
+			if err != nil {
+				t.Fatalf("Dial() error = %v", err)
+			}
+			defer c.Close()
+
+			if _, ok := c.nc.(*tls.Conn); !ok {
+				t.Errorf("connection is %T, want *tls.Conn", c.nc)
+			}
+		})
+	}
+}
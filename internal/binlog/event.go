@@ -0,0 +1,281 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// EventType тип события binlog
+type EventType byte
+
+const (
+	QueryEvent             EventType = 2
+	RotateEvent            EventType = 4
+	FormatDescriptionEvent EventType = 15
+	XIDEvent               EventType = 16
+	TableMapEvent          EventType = 19
+	WriteRowsEventV1       EventType = 23
+	UpdateRowsEventV1      EventType = 24
+	DeleteRowsEventV1      EventType = 25
+	HeartbeatEvent         EventType = 27
+	WriteRowsEventV2       EventType = 30
+	UpdateRowsEventV2      EventType = 31
+	DeleteRowsEventV2      EventType = 32
+
+	// События, изменения в которых этот пакет не разбирает: частичное обновление JSON и сжатые транзакции
+	// MySQL, сжатые события MariaDB (log_bin_compress)
+	partialUpdateRowsEvent   EventType = 39
+	transactionPayloadEvent  EventType = 40
+	mariaFirstCompressedType EventType = 165
+	mariaLastCompressedType  EventType = 171
+)
+
+// headerSize размер заголовка события binlog v4
+const headerSize = 19
+
+// Header заголовок события
+type Header struct {
+	Timestamp uint32
+	Type      EventType
+	ServerID  uint32
+	Size      uint32
+
+	// NextPos смещение следующего события в файле binlog, 0 - у событий, которые источник сформировал
+	// для реплики и которых нет в файле
+	NextPos uint32
+	Flags   uint16
+}
+
+// Event событие binlog
+type Event struct {
+	Header
+
+	// Pos позиция после события: с нее продолжается чтение
+	Pos Position
+
+	// Query текст запроса события QUERY_EVENT
+	Query string
+
+	// Rows изменения строк событий WRITE_ROWS, UPDATE_ROWS и DELETE_ROWS
+	Rows *RowsEvent
+}
+
+// Commit сообщает, что событие завершает транзакцию или выполнено вне транзакции (DDL). С позиции после
+// такого события можно начать чтение заново: описания таблиц изменений придут в следующей транзакции
+func (e *Event) Commit() bool {
+	switch e.Type {
+	case XIDEvent:
+		return true
+	case QueryEvent:
+		return e.Query != "BEGIN"
+	default:
+		return false
+	}
+}
+
+// Stream поток событий binlog. Отслеживает позицию и описания таблиц из TABLE_MAP_EVENT, по которым
+// разбираются события изменения строк
+type Stream struct {
+	conn     *Conn
+	checksum bool
+	pos      Position
+
+	// tableIDSize размер идентификатора таблицы в событиях: 6 байт, у очень старых серверов - 4
+	tableIDSize int
+	tables      map[uint64]*TableMap
+
+	// match отбирает таблицы, изменения строк которых разбираются, nil - все таблицы
+	match func(schema, table string) bool
+}
+
+func newStream(conn *Conn, pos Position, checksum bool) *Stream {
+	return &Stream{conn: conn, checksum: checksum, pos: pos, tableIDSize: 6, tables: make(map[uint64]*TableMap)}
+}
+
+// Next ждет и возвращает следующее событие
+func (s *Stream) Next() (*Event, error) {
+	raw, err := s.conn.readEvent()
+	if err != nil {
+		return nil, err
+	}
+	return s.parse(raw)
+}
+
+// Match ограничивает разбор изменений строк таблицами, для которых match возвращает true. У событий
+// остальных таблиц Rows остается nil: их значения не разбираются, и незнакомые типы колонок в них не мешают
+func (s *Stream) Match(match func(schema, table string) bool) {
+	s.match = match
+}
+
+// Pos возвращает позицию после последнего прочитанного события
+func (s *Stream) Pos() Position {
+	return s.pos
+}
+
+// parse разбирает событие и сдвигает позицию потока
+func (s *Stream) parse(raw []byte) (*Event, error) {
+	if len(raw) < headerSize {
+		return nil, errMalformed
+	}
+
+	h := Header{
+		Timestamp: binary.LittleEndian.Uint32(raw[0:]),
+		Type:      EventType(raw[4]),
+		ServerID:  binary.LittleEndian.Uint32(raw[5:]),
+		Size:      binary.LittleEndian.Uint32(raw[9:]),
+		NextPos:   binary.LittleEndian.Uint32(raw[13:]),
+		Flags:     binary.LittleEndian.Uint16(raw[17:]),
+	}
+
+	if s.checksum {
+		if len(raw) < headerSize+4 {
+			return nil, errMalformed
+		}
+		body, sum := raw[:len(raw)-4], binary.LittleEndian.Uint32(raw[len(raw)-4:])
+		if crc32.ChecksumIEEE(body) != sum {
+			return nil, fmt.Errorf("binlog event checksum mismatch after %s", s.pos)
+		}
+		raw = body
+	}
+	data := raw[headerSize:]
+
+	ev := &Event{Header: h}
+	var err error
+	switch {
+	case h.Type == RotateEvent:
+		if len(data) < 8 {
+			return nil, errMalformed
+		}
+		s.pos = Position{File: string(data[8:]), Pos: uint32(binary.LittleEndian.Uint64(data))}
+	case h.Type == FormatDescriptionEvent:
+		s.parseFormat(data)
+	case h.Type == TableMapEvent:
+		var tm *TableMap
+		if tm, err = s.parseTableMap(data); err == nil {
+			s.tables[tm.ID] = tm
+		}
+	case h.Type == QueryEvent:
+		ev.Query, err = parseQuery(data)
+	case rowsChange(h.Type) != 0:
+		ev.Rows, err = s.parseRows(h.Type, data)
+	case h.Type == partialUpdateRowsEvent:
+		err = fmt.Errorf("partial JSON updates are not supported, set binlog_row_value_options to empty")
+	case h.Type == transactionPayloadEvent:
+		err = fmt.Errorf("compressed transactions are not supported, disable binlog_transaction_compression")
+	case h.Type >= mariaFirstCompressedType && h.Type <= mariaLastCompressedType:
+		err = fmt.Errorf("compressed binlog events are not supported, disable log_bin_compress")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("binlog event %d after %s: %w", h.Type, s.pos, err)
+	}
+
+	if h.Type != RotateEvent && h.NextPos > 0 {
+		s.pos.Pos = h.NextPos
+	}
+	ev.Pos = s.pos
+
+	return ev, nil
+}
+
+// parseFormat берет из FORMAT_DESCRIPTION_EVENT размер идентификатора таблицы: он зависит от длины
+// постоянной части TABLE_MAP_EVENT
+func (s *Stream) parseFormat(data []byte) {
+	// Версия binlog (2), версия сервера (50), время создания (4), длина заголовка (1), затем длины
+	// постоянных частей событий, начиная с типа 1
+	const lengths = 2 + 50 + 4 + 1
+	if i := lengths + int(TableMapEvent) - 1; i < len(data) && data[i] == 6 {
+		s.tableIDSize = 4
+	}
+}
+
+// parseQuery возвращает текст запроса QUERY_EVENT
+func parseQuery(data []byte) (string, error) {
+	r := reader{data: data}
+	r.skip(4 + 4)
+	schemaLen := int(r.byte())
+	r.skip(2)
+	r.skip(int(r.uint(2)))
+	r.skip(schemaLen + 1)
+	query := r.rest()
+
+	return string(query), r.err
+}
+
+// reader читает поля события. Первая ошибка запоминается, последующие чтения возвращают нулевые значения
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(r.data)-r.pos {
+		r.err = errMalformed
+		return nil
+	}
+
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *reader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *reader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// uint читает целое без знака из n байт в порядке little-endian
+func (r *reader) uint(n int) uint64 {
+	return leUint(r.bytes(n))
+}
+
+// lenenc читает целое переменной длины протокола MySQL
+func (r *reader) lenenc() int {
+	first := r.byte()
+	switch {
+	case first < 0xfb:
+		return int(first)
+	case first == 0xfc:
+		return int(r.uint(2))
+	case first == 0xfd:
+		return int(r.uint(3))
+	case first == 0xfe:
+		n := r.uint(8)
+		if n > uint64(len(r.data)) {
+			r.err = errMalformed
+			return 0
+		}
+		return int(n)
+	default:
+		if r.err == nil {
+			r.err = errMalformed
+		}
+		return 0
+	}
+}
+
+func (r *reader) rest() []byte {
+	return r.bytes(len(r.data) - r.pos)
+}
+
+func (r *reader) done() bool {
+	return r.err != nil || r.pos >= len(r.data)
+}
+
+func leUint(b []byte) uint64 {
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	return v
+}
@@ -0,0 +1,327 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testEvent собирает событие binlog: заголовок, тело и CRC32, если checksum
+func testEvent(typ EventType, nextPos uint32, body []byte, checksum bool) []byte {
+	size := headerSize + len(body)
+	if checksum {
+		size += 4
+	}
+
+	ev := binary.LittleEndian.AppendUint32(nil, 1700000000)
+	ev = append(ev, byte(typ))
+	ev = binary.LittleEndian.AppendUint32(ev, 1)
+	ev = binary.LittleEndian.AppendUint32(ev, uint32(size))
+	ev = binary.LittleEndian.AppendUint32(ev, nextPos)
+	ev = binary.LittleEndian.AppendUint16(ev, 0)
+	ev = append(ev, body...)
+	if checksum {
+		ev = binary.LittleEndian.AppendUint32(ev, crc32.ChecksumIEEE(ev))
+	}
+	return ev
+}
+
+// testTableMap тело TABLE_MAP_EVENT таблицы shop.orders (id BIGINT, name VARCHAR(20), price DECIMAL(10,2))
+func testTableMap(id uint64) []byte {
+	body := binary.LittleEndian.AppendUint64(nil, id)[:6]
+	body = append(body, 0, 0)
+	body = append(body, 4)
+	body = append(body, "shop\x00"...)
+	body = append(body, 6)
+	body = append(body, "orders\x00"...)
+	body = append(body, 3, typeLongLong, typeVarchar, typeNewDecimal)
+	body = append(body, 4, 0x50, 0x00, 0x0a, 0x02)
+	return append(body, 0)
+}
+
+// testRowsHeader начало события строк: идентификатор таблицы, флаги, дополнительные данные v2 и число колонок
+func testRowsHeader(id uint64, v2 bool) []byte {
+	body := binary.LittleEndian.AppendUint64(nil, id)[:6]
+	body = append(body, 0, 0)
+	if v2 {
+		body = append(body, 2, 0)
+	}
+	return append(body, 3)
+}
+
+// testRow образ строки со всеми тремя колонками, пустое имя - NULL
+func testRow(id uint64, name string) []byte {
+	if name == "" {
+		row := []byte{0b010}
+		row = binary.LittleEndian.AppendUint64(row, id)
+		return append(row, 0x80, 0, 0, 0x01, 0x02)
+	}
+
+	row := []byte{0}
+	row = binary.LittleEndian.AppendUint64(row, id)
+	row = append(row, byte(len(name)))
+	row = append(row, name...)
+	return append(row, 0x80, 0, 0, 0x01, 0x02)
+}
+
+func TestStreamRows(t *testing.T) {
+	tests := []struct {
+		name     string
+		typ      EventType
+		body     []byte
+		change   Change
+		wantIDs  []uint64
+		wantName string
+		image    func(RowChange) Image
+	}{
+		{
+			name:     "write v2 with null",
+			typ:      WriteRowsEventV2,
+			body:     append(append(append(testRowsHeader(7, true), 0x07), testRow(10, "ten")...), testRow(11, "")...),
+			change:   Insert,
+			wantIDs:  []uint64{10, 11},
+			wantName: "ten",
+			image:    func(r RowChange) Image { return r.After },
+		},
+		{
+			name:     "update v2 before and after",
+			typ:      UpdateRowsEventV2,
+			body:     append(append(append(testRowsHeader(7, true), 0x07, 0x07), testRow(20, "old")...), testRow(21, "new")...),
+			change:   Update,
+			wantIDs:  []uint64{21},
+			wantName: "new",
+			image:    func(r RowChange) Image { return r.After },
+		},
+		{
+			name:     "delete v1",
+			typ:      DeleteRowsEventV1,
+			body:     append(append(testRowsHeader(7, false), 0x07), testRow(30, "gone")...),
+			change:   Delete,
+			wantIDs:  []uint64{30},
+			wantName: "gone",
+			image:    func(r RowChange) Image { return r.Before },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStream(nil, Position{File: "bin.000001", Pos: 4}, true)
+			if _, err := s.parse(testEvent(TableMapEvent, 200, testTableMap(7), true)); err != nil {
+				t.Fatalf("parse(table map) error = %v", err)
+			}
+
+			ev, err := s.parse(testEvent(tt.typ, 300, tt.body, true))
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if ev.Rows == nil || ev.Rows.Change != tt.change {
+				t.Fatalf("parse() rows = %+v, want change %d", ev.Rows, tt.change)
+			}
+			if ev.Rows.Table.Schema != "shop" || ev.Rows.Table.Table != "orders" {
+				t.Errorf("table = %s.%s, want shop.orders", ev.Rows.Table.Schema, ev.Rows.Table.Table)
+			}
+			if ev.Pos != (Position{File: "bin.000001", Pos: 300}) {
+				t.Errorf("Pos = %s, want bin.000001:300", ev.Pos)
+			}
+
+			var ids []uint64
+			for _, row := range ev.Rows.Rows {
+				id, ok, err := ev.Rows.Uint(tt.image(row), 0)
+				if err != nil || !ok {
+					t.Fatalf("Uint() = %d, %v, %v", id, ok, err)
+				}
+				ids = append(ids, id)
+			}
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Fatalf("ids = %v, want %v", ids, tt.wantIDs)
+			}
+			if tt.change == Update {
+				// У обновления ID меняется: старый нужен, чтобы найти строку в целевой таблице
+				if before, _, _ := ev.Rows.Uint(ev.Rows.Rows[0].Before, 0); before != 20 {
+					t.Errorf("before id = %d, want 20", before)
+				}
+			}
+
+			img := tt.image(ev.Rows.Rows[0])
+			if got := string(img[1][1:]); got != tt.wantName {
+				t.Errorf("name = %q, want %q", got, tt.wantName)
+			}
+			if len(img[2]) != 5 {
+				t.Errorf("decimal size = %d, want 5", len(img[2]))
+			}
+		})
+	}
+}
+
+func TestStreamNullColumn(t *testing.T) {
+	s := newStream(nil, Position{File: "bin.000001", Pos: 4}, false)
+	if _, err := s.parse(testEvent(TableMapEvent, 200, testTableMap(7), false)); err != nil {
+		t.Fatalf("parse(table map) error = %v", err)
+	}
+
+	body := append(append(testRowsHeader(7, true), 0x07), testRow(11, "")...)
+	ev, err := s.parse(testEvent(WriteRowsEventV2, 300, body, false))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+
+	img := ev.Rows.Rows[0].After
+	if img[1] != nil {
+		t.Errorf("name = %q, want NULL", img[1])
+	}
+	if id, ok, _ := ev.Rows.Uint(img, 0); !ok || id != 11 {
+		t.Errorf("Uint() = %d, %v, want 11, true", id, ok)
+	}
+	if _, _, err := ev.Rows.Uint(img, 1); err == nil {
+		t.Error("Uint() of a VARCHAR column should fail")
+	}
+}
+
+func TestStreamPosition(t *testing.T) {
+	s := newStream(nil, Position{File: "bin.000001", Pos: 4}, false)
+
+	rotate := binary.LittleEndian.AppendUint64(nil, 4)
+	rotate = append(rotate, "bin.000002"...)
+	if _, err := s.parse(testEvent(RotateEvent, 0, rotate, false)); err != nil {
+		t.Fatalf("parse(rotate) error = %v", err)
+	}
+	if s.Pos() != (Position{File: "bin.000002", Pos: 4}) {
+		t.Fatalf("Pos() after rotate = %s, want bin.000002:4", s.Pos())
+	}
+
+	// Heartbeat без смещения не сдвигает позицию
+	if _, err := s.parse(testEvent(HeartbeatEvent, 0, []byte("bin.000002"), false)); err != nil {
+		t.Fatalf("parse(heartbeat) error = %v", err)
+	}
+	if s.Pos().Pos != 4 {
+		t.Errorf("Pos() after heartbeat = %s, want bin.000002:4", s.Pos())
+	}
+
+	query := make([]byte, 4+4)
+	query = append(query, 4, 0, 0, 0, 0)
+	query = append(query, "shop\x00BEGIN"...)
+	ev, err := s.parse(testEvent(QueryEvent, 150, query, false))
+	if err != nil {
+		t.Fatalf("parse(query) error = %v", err)
+	}
+	if ev.Query != "BEGIN" || ev.Commit() {
+		t.Errorf("query = %q, commit = %v, want BEGIN without commit", ev.Query, ev.Commit())
+	}
+
+	ev, err = s.parse(testEvent(XIDEvent, 250, binary.LittleEndian.AppendUint64(nil, 99), false))
+	if err != nil {
+		t.Fatalf("parse(xid) error = %v", err)
+	}
+	if !ev.Commit() || ev.Pos != (Position{File: "bin.000002", Pos: 250}) {
+		t.Errorf("xid commit = %v, pos = %s, want commit at bin.000002:250", ev.Commit(), ev.Pos)
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     func() []byte
+		wantErr string
+	}{
+		{
+			name: "checksum mismatch",
+			raw: func() []byte {
+				raw := testEvent(XIDEvent, 100, binary.LittleEndian.AppendUint64(nil, 1), true)
+				raw[len(raw)-1] ^= 0xff
+				return raw
+			},
+			wantErr: "checksum mismatch",
+		},
+		{
+			name: "unknown table id",
+			raw: func() []byte {
+				return testEvent(WriteRowsEventV2, 100, append(append(testRowsHeader(8, true), 0x07), testRow(1, "a")...), true)
+			},
+			wantErr: "unknown table id 8",
+		},
+		{
+			name: "compressed transaction",
+			raw: func() []byte {
+				return testEvent(transactionPayloadEvent, 100, []byte{1, 2, 3}, true)
+			},
+			wantErr: "compressed transactions",
+		},
+		{
+			name: "truncated event",
+			raw: func() []byte {
+				return []byte{1, 2, 3}
+			},
+			wantErr: "malformed packet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStream(nil, Position{File: "bin.000001", Pos: 4}, true)
+			_, err := s.parse(tt.raw())
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("parse() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValueSize(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  byte
+		meta uint16
+		data []byte
+		want int
+	}{
+		{name: "int", typ: typeLong, want: 4},
+		{name: "decimal(10,2)", typ: typeNewDecimal, meta: 10<<8 | 2, want: 5},
+		{name: "decimal(20,0)", typ: typeNewDecimal, meta: 20 << 8, want: 9},
+		{name: "datetime(0)", typ: typeDatetime2, meta: 0, want: 5},
+		{name: "datetime(6)", typ: typeDatetime2, meta: 6, want: 8},
+		{name: "timestamp(3)", typ: typeTimestamp2, meta: 3, want: 6},
+		{name: "char(10)", typ: typeString, meta: 0xfe0a, data: []byte{3, 'a', 'b', 'c'}, want: 4},
+		{name: "char(100) utf8mb4", typ: typeString, meta: 0xee90, data: []byte{2, 0, 'a', 'b'}, want: 4},
+		{name: "enum", typ: typeString, meta: 0xf701, want: 1},
+		{name: "set", typ: typeString, meta: 0xf802, want: 2},
+		{name: "varchar(300)", typ: typeVarchar, meta: 300, data: []byte{3, 0, 'a', 'b', 'c'}, want: 5},
+		{name: "blob", typ: typeBlob, meta: 2, data: []byte{4, 0, 1, 2, 3, 4}, want: 6},
+		{name: "json", typ: typeJSON, meta: 4, data: []byte{1, 0, 0, 0, 0}, want: 5},
+		{name: "bit(10)", typ: typeBit, meta: 1<<8 | 2, want: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := valueSize(tt.typ, tt.meta, tt.data)
+			if err != nil {
+				t.Fatalf("valueSize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("valueSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamMatch(t *testing.T) {
+	s := newStream(nil, Position{File: "bin.000001", Pos: 4}, false)
+	s.Match(func(schema, table string) bool { return table == "events" })
+	if _, err := s.parse(testEvent(TableMapEvent, 200, testTableMap(7), false)); err != nil {
+		t.Fatalf("parse(table map) error = %v", err)
+	}
+
+	// Значения чужой таблицы не разбираются, даже если образ строки поврежден
+	body := append(append(testRowsHeader(7, true), 0x07), 0xff)
+	ev, err := s.parse(testEvent(WriteRowsEventV2, 300, body, false))
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if ev.Rows != nil {
+		t.Errorf("Rows = %+v, want nil for a table outside the match", ev.Rows)
+	}
+	if s.Pos().Pos != 300 {
+		t.Errorf("Pos() = %s, want bin.000001:300", s.Pos())
+	}
+}
@@ -0,0 +1,86 @@
+package binlog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Position позиция в binlog источника: файл и смещение следующего события
+type Position struct {
+	File string `json:"file"`
+	Pos  uint32 `json:"pos"`
+}
+
+// String возвращает позицию в виде file:pos
+func (p Position) String() string {
+	return p.File + ":" + strconv.FormatUint(uint64(p.Pos), 10)
+}
+
+// ParsePosition разбирает позицию в виде file:pos, например mysql-bin.000042:4
+func ParsePosition(s string) (Position, error) {
+	file, pos, ok := strings.Cut(s, ":")
+	if !ok || file == "" {
+		return Position{}, fmt.Errorf("binlog position must be file:pos, got %q", s)
+	}
+
+	n, err := strconv.ParseUint(pos, 10, 32)
+	if err != nil || n < 4 {
+		return Position{}, fmt.Errorf("invalid binlog offset in %q", s)
+	}
+
+	return Position{File: file, Pos: uint32(n)}, nil
+}
+
+// ReadCheckpoint читает позицию из файла контрольной точки. ok = false, если файла еще нет
+func ReadCheckpoint(path string) (pos Position, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Position{}, false, nil
+	}
+	if err != nil {
+		return Position{}, false, fmt.Errorf("read binlog checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &pos); err != nil || pos.File == "" {
+		return Position{}, false, fmt.Errorf("invalid binlog checkpoint %s", path)
+	}
+
+	return pos, true, nil
+}
+
+// WriteCheckpoint заменяет файл контрольной точки: пишет позицию во временный файл рядом, синхронизирует
+// его на диск и переименовывает, поэтому после падения в файле остается прежняя или новая позиция целиком
+func WriteCheckpoint(path string, pos Position) error {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("write binlog checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write binlog checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("sync binlog checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write binlog checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("write binlog checkpoint: %w", err)
+	}
+	return nil
+}
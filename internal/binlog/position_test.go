@@ -0,0 +1,74 @@
+package binlog
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePosition(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    Position
+		wantErr bool
+	}{
+		{name: "file and offset", in: "mysql-bin.000042:154", want: Position{File: "mysql-bin.000042", Pos: 154}},
+		{name: "start of file", in: "mysql-bin.000001:4", want: Position{File: "mysql-bin.000001", Pos: 4}},
+		{name: "no offset", in: "mysql-bin.000001", wantErr: true},
+		{name: "no file", in: ":4", wantErr: true},
+		{name: "offset inside header", in: "mysql-bin.000001:3", wantErr: true},
+		{name: "offset overflow", in: "mysql-bin.000001:4294967296", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePosition(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePosition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParsePosition() = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr && got.String() != tt.in {
+				t.Errorf("String() = %s, want %s", got.String(), tt.in)
+			}
+		})
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "binlog.json")
+
+	if _, ok, err := ReadCheckpoint(path); err != nil || ok {
+		t.Fatalf("ReadCheckpoint() of missing file = %v, %v, want not found", ok, err)
+	}
+
+	for _, want := range []Position{{File: "bin.000001", Pos: 120}, {File: "bin.000002", Pos: 4}} {
+		if err := WriteCheckpoint(path, want); err != nil {
+			t.Fatalf("WriteCheckpoint() error = %v", err)
+		}
+		got, ok, err := ReadCheckpoint(path)
+		if err != nil || !ok {
+			t.Fatalf("ReadCheckpoint() = %v, %v", ok, err)
+		}
+		if got != want {
+			t.Errorf("ReadCheckpoint() = %s, want %s", got, want)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("checkpoint dir has %d files, want only the checkpoint", len(entries))
+	}
+
+	if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ReadCheckpoint(path); err == nil {
+		t.Error("ReadCheckpoint() of an empty position should fail")
+	}
+}
@@ -0,0 +1,315 @@
+package binlog
+
+import (
+	"fmt"
+)
+
+// Типы колонок в TABLE_MAP_EVENT
+const (
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDatetime   = 12
+	typeYear       = 13
+	typeNewDate    = 14
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDatetime2  = 18
+	typeTime2      = 19
+	typeJSON       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// decimalBytes байты на остаток из 0-8 десятичных цифр в двоичном формате DECIMAL, 9 цифр занимают 4 байта
+var decimalBytes = [9]int{0, 1, 1, 2, 2, 3, 3, 4, 4}
+
+// TableMap описание таблицы из TABLE_MAP_EVENT: типы колонок и их метаданные, по которым разбираются
+// образы строк. Имен колонок в событии нет, колонки идут в порядке таблицы
+type TableMap struct {
+	ID     uint64
+	Schema string
+	Table  string
+	Types  []byte
+	Meta   []uint16
+}
+
+// Change вид изменения строк
+type Change int
+
+const (
+	Insert Change = iota + 1
+	Update
+	Delete
+)
+
+// RowsEvent изменения строк одной таблицы
+type RowsEvent struct {
+	Change Change
+	Table  *TableMap
+	Rows   []RowChange
+}
+
+// RowChange образы строки до и после изменения: у вставки есть только After, у удаления - только Before
+type RowChange struct {
+	Before, After Image
+}
+
+// Image образ строки: значения колонок в формате binlog по порядку таблицы, nil - NULL или колонки нет в образе
+// (binlog_row_image = MINIMAL)
+type Image [][]byte
+
+// Uint возвращает значение целочисленной колонки col (с 0) из образа строки. ok = false, если значение NULL
+// или колонки нет в образе. Знак не учитывается: колонка хранит неотрицательные ID
+func (e *RowsEvent) Uint(img Image, col int) (v uint64, ok bool, err error) {
+	if col < 0 || col >= len(e.Table.Types) {
+		return 0, false, fmt.Errorf("%s.%s has no column %d", e.Table.Schema, e.Table.Table, col+1)
+	}
+
+	switch e.Table.Types[col] {
+	case typeTiny, typeShort, typeInt24, typeLong, typeLongLong:
+	default:
+		return 0, false, fmt.Errorf("column %d of %s.%s is not an integer (type %d)", col+1, e.Table.Schema, e.Table.Table, e.Table.Types[col])
+	}
+
+	if col >= len(img) || img[col] == nil {
+		return 0, false, nil
+	}
+	return leUint(img[col]), true, nil
+}
+
+// rowsChange возвращает вид изменения события строк или 0 для остальных событий
+func rowsChange(t EventType) Change {
+	switch t {
+	case WriteRowsEventV1, WriteRowsEventV2:
+		return Insert
+	case UpdateRowsEventV1, UpdateRowsEventV2:
+		return Update
+	case DeleteRowsEventV1, DeleteRowsEventV2:
+		return Delete
+	default:
+		return 0
+	}
+}
+
+// parseTableMap разбирает TABLE_MAP_EVENT. Дополнительные метаданные (binlog_row_metadata = FULL) не нужны
+func (s *Stream) parseTableMap(data []byte) (*TableMap, error) {
+	r := reader{data: data}
+
+	tm := &TableMap{ID: r.uint(s.tableIDSize)}
+	r.skip(2)
+	tm.Schema = string(r.bytes(int(r.byte())))
+	r.skip(1)
+	tm.Table = string(r.bytes(int(r.byte())))
+	r.skip(1)
+
+	tm.Types = r.bytes(r.lenenc())
+	meta := r.bytes(r.lenenc())
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	var err error
+	if tm.Meta, err = parseMeta(tm.Types, meta); err != nil {
+		return nil, fmt.Errorf("table map %s.%s: %w", tm.Schema, tm.Table, err)
+	}
+	return tm, nil
+}
+
+// parseMeta разбирает метаданные колонок: длины строк, точность чисел и дробных секунд
+func parseMeta(types, meta []byte) ([]uint16, error) {
+	r := reader{data: meta}
+	out := make([]uint16, len(types))
+
+	for i, t := range types {
+		switch t {
+		case typeString, typeNewDecimal:
+			// Два байта, старший первым: реальный тип и длина CHAR, точность и масштаб DECIMAL
+			out[i] = uint16(r.byte())<<8 | uint16(r.byte())
+		case typeVarchar, typeVarString, typeBit:
+			out[i] = uint16(r.uint(2))
+		case typeFloat, typeDouble, typeBlob, typeGeometry, typeJSON, typeTimestamp2, typeDatetime2, typeTime2:
+			out[i] = uint16(r.byte())
+		}
+	}
+
+	return out, r.err
+}
+
+// parseRows разбирает событие изменения строк таблицы, описанной предыдущим TABLE_MAP_EVENT
+func (s *Stream) parseRows(t EventType, data []byte) (*RowsEvent, error) {
+	change := rowsChange(t)
+	r := reader{data: data}
+
+	id := r.uint(s.tableIDSize)
+	r.skip(2)
+	if t >= WriteRowsEventV2 {
+		// Длина дополнительных данных v2 учитывает и само поле длины
+		r.skip(int(r.uint(2)) - 2)
+	}
+
+	n := r.lenenc()
+	present := r.bytes((n + 7) / 8)
+	presentAfter := present
+	if change == Update {
+		presentAfter = r.bytes((n + 7) / 8)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	tm := s.tables[id]
+	if tm == nil {
+		return nil, fmt.Errorf("rows event for unknown table id %d", id)
+	}
+	if s.match != nil && !s.match(tm.Schema, tm.Table) {
+		return nil, nil
+	}
+	if n > len(tm.Types) {
+		return nil, fmt.Errorf("rows event has %d columns, table map of %s.%s has %d", n, tm.Schema, tm.Table, len(tm.Types))
+	}
+
+	ev := &RowsEvent{Change: change, Table: tm}
+	for !r.done() {
+		img, err := readImage(&r, tm, n, present)
+		if err != nil {
+			return nil, err
+		}
+
+		var row RowChange
+		switch change {
+		case Insert:
+			row.After = img
+		case Delete:
+			row.Before = img
+		case Update:
+			row.Before = img
+			if row.After, err = readImage(&r, tm, n, presentAfter); err != nil {
+				return nil, err
+			}
+		}
+		ev.Rows = append(ev.Rows, row)
+	}
+
+	return ev, r.err
+}
+
+// readImage читает образ строки: битовую карту NULL по колонкам из present и значения остальных колонок
+func readImage(r *reader, tm *TableMap, n int, present []byte) (Image, error) {
+	cols := 0
+	for i := 0; i < n; i++ {
+		if bit(present, i) {
+			cols++
+		}
+	}
+	nulls := r.bytes((cols + 7) / 8)
+
+	img := make(Image, n)
+	j := 0
+	for i := 0; i < n && r.err == nil; i++ {
+		if !bit(present, i) {
+			continue
+		}
+		null := bit(nulls, j)
+		j++
+		if null {
+			continue
+		}
+
+		size, err := valueSize(tm.Types[i], tm.Meta[i], r.data[r.pos:])
+		if err != nil {
+			return nil, fmt.Errorf("column %d of %s.%s: %w", i+1, tm.Schema, tm.Table, err)
+		}
+		img[i] = r.bytes(size)
+	}
+
+	return img, r.err
+}
+
+// valueSize возвращает размер значения колонки в образе строки, для строк и BLOB - вместе с длиной
+func valueSize(t byte, meta uint16, data []byte) (int, error) {
+	// CHAR, ENUM и SET приходят как STRING: реальный тип и длина упакованы в метаданные
+	length := int(meta)
+	if t == typeString && meta >= 256 {
+		b0, b1 := byte(meta>>8), byte(meta)
+		if b0&0x30 != 0x30 {
+			length = int(b1) | int((b0&0x30)^0x30)<<4
+			t = b0 | 0x30
+		} else {
+			length = int(b1)
+			t = b0
+		}
+	}
+
+	switch t {
+	case typeNull:
+		return 0, nil
+	case typeTiny, typeYear:
+		return 1, nil
+	case typeShort:
+		return 2, nil
+	case typeInt24, typeDate, typeNewDate, typeTime:
+		return 3, nil
+	case typeLong, typeFloat, typeTimestamp:
+		return 4, nil
+	case typeLongLong, typeDouble, typeDatetime:
+		return 8, nil
+	case typeTimestamp2:
+		return 4 + (int(meta)+1)/2, nil
+	case typeDatetime2:
+		return 5 + (int(meta)+1)/2, nil
+	case typeTime2:
+		return 3 + (int(meta)+1)/2, nil
+	case typeNewDecimal:
+		return decimalSize(int(meta>>8), int(meta&0xff)), nil
+	case typeBit:
+		return (int(meta>>8)*8 + int(meta&0xff) + 7) / 8, nil
+	case typeEnum, typeSet:
+		return int(meta & 0xff), nil
+	case typeVarchar, typeVarString, typeString:
+		if length < 256 {
+			return prefixed(data, 1)
+		}
+		return prefixed(data, 2)
+	case typeBlob, typeTinyBlob, typeMediumBlob, typeLongBlob, typeGeometry, typeJSON:
+		return prefixed(data, int(meta))
+	default:
+		return 0, fmt.Errorf("unsupported column type %d", t)
+	}
+}
+
+// prefixed возвращает размер значения с длиной в первых n байтах
+func prefixed(data []byte, n int) (int, error) {
+	if n < 1 || n > 4 || len(data) < n {
+		return 0, errMalformed
+	}
+	return n + int(leUint(data[:n])), nil
+}
+
+// decimalSize размер DECIMAL(precision, scale) в двоичном формате: целая и дробная части упаковываются
+// отдельно по 9 цифр в 4 байта
+func decimalSize(precision, scale int) int {
+	intg := precision - scale
+	return intg/9*4 + decimalBytes[intg%9] + scale/9*4 + decimalBytes[scale%9]
+}
+
+func bit(b []byte, i int) bool {
+	return i/8 < len(b) && b[i/8]&(1<<(i%8)) != 0
+}
@@ -0,0 +1,111 @@
+package budget
+
+import (
+	"context"
+	"sync"
+)
+
+// Budget ограничивает объем временных файлов, которые ждут загрузки на диске. Stage-воркер занимает слот
+// перед выгрузкой шарда и ждет, пока backlog превышает лимит; load-воркер освобождает слот после удаления файла.
+// Нулевые лимиты означают отсутствие ограничения, методы nil-бюджета ничего не делают
+type Budget struct {
+	mu       sync.Mutex
+	maxBytes uint64
+	maxFiles int
+	bytes    uint64
+	files    int
+	released chan struct{}
+}
+
+// New создает бюджет. Если оба лимита нулевые, возвращает nil
+func New(maxBytes uint64, maxFiles int) *Budget {
+	if maxBytes == 0 && maxFiles == 0 {
+		return nil
+	}
+
+	return &Budget{
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+		released: make(chan struct{}),
+	}
+}
+
+// Acquire ждет, пока backlog опустится ниже лимита, и занимает слот под один файл. Размер файла
+// неизвестен до конца выгрузки, поэтому байтовый лимит может быть превышен на объем файлов, которые
+// пишутся в этот момент
+func (b *Budget) Acquire(ctx context.Context) error {
+	if b == nil {
+		return nil
+	}
+
+	for {
+		b.mu.Lock()
+		if b.fits() {
+			b.files++
+			b.mu.Unlock()
+			return nil
+		}
+		released := b.released
+		b.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// Add учитывает размер записанного файла в занятом слоте
+func (b *Budget) Add(size uint64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.bytes += size
+	b.mu.Unlock()
+}
+
+// Release освобождает слот файла размером size (0, если файл не был записан) и будит ожидающих
+func (b *Budget) Release(size uint64) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.files > 0 {
+		b.files--
+	}
+	if size > b.bytes {
+		size = b.bytes
+	}
+	b.bytes -= size
+
+	close(b.released)
+	b.released = make(chan struct{})
+}
+
+// Usage возвращает текущий backlog: байты и количество файлов
+func (b *Budget) Usage() (uint64, int) {
+	if b == nil {
+		return 0, 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.bytes, b.files
+}
+
+func (b *Budget) fits() bool {
+	if b.maxFiles > 0 && b.files >= b.maxFiles {
+		return false
+	}
+	if b.maxBytes > 0 && b.bytes >= b.maxBytes {
+		return false
+	}
+	return true
+}
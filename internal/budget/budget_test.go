@@ -0,0 +1,94 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNew_Unlimited(t *testing.T) {
+	b := New(0, 0)
+	if b != nil {
+		t.Fatalf("New(0, 0) = %v, want nil", b)
+	}
+
+	// Методы nil-бюджета ничего не делают и не блокируют
+	if err := b.Acquire(context.Background()); err != nil {
+		t.Errorf("Acquire() on nil budget = %v", err)
+	}
+	b.Add(100)
+	b.Release(100)
+	if bytes, files := b.Usage(); bytes != 0 || files != 0 {
+		t.Errorf("Usage() on nil budget = %d, %d", bytes, files)
+	}
+}
+
+func TestBudget_MaxFiles(t *testing.T) {
+	b := New(0, 2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := b.Acquire(ctx); err != nil {
+			t.Fatalf("Acquire() #%d = %v", i+1, err)
+		}
+	}
+
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.Acquire(ctx) }()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("Acquire() over file limit returned %v, want block", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	b.Release(0)
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Acquire() after release = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Acquire() still blocked after release")
+	}
+
+	if _, files := b.Usage(); files != 2 {
+		t.Errorf("files = %d, want 2", files)
+	}
+}
+
+func TestBudget_MaxBytes(t *testing.T) {
+	b := New(100, 0)
+	ctx := context.Background()
+
+	// Пока лимит не достигнут, слоты выдаются даже если файл превысит лимит
+	if err := b.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.Add(60)
+	if err := b.Acquire(ctx); err != nil {
+		t.Fatal(err)
+	}
+	b.Add(60)
+
+	if bytes, files := b.Usage(); bytes != 120 || files != 2 {
+		t.Fatalf("Usage() = %d, %d, want 120, 2", bytes, files)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := b.Acquire(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() over byte limit = %v, want deadline exceeded", err)
+	}
+
+	b.Release(60)
+	if err := b.Acquire(ctx); err != nil {
+		t.Fatalf("Acquire() after release = %v", err)
+	}
+
+	if bytes, files := b.Usage(); bytes != 60 || files != 2 {
+		t.Errorf("Usage() = %d, %d, want 60, 2", bytes, files)
+	}
+}
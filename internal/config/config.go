@@ -1,14 +1,60 @@
 package config
 
 import (
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"math"
+	"os"
 	"runtime"
+	"slices"
+	"strings"
+	"time"
 
+	"logs-migrator/internal/binlog"
 	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/logx"
+	"logs-migrator/internal/redact"
+	"logs-migrator/internal/util"
+	"logs-migrator/internal/uuidv7"
+	"logs-migrator/pkg/transform"
 )
 
+// Способы разбиения диапазона ID на шарды
+const (
+	SplitUniform = "uniform"
+	SplitDensity = "density"
+)
+
+// UUIDFormatAuto формат UUID определяется по типу колонки UUID целевой таблицы
+const UUIDFormatAuto = "auto"
+
+// Переменные окружения с секретами, которые не стоит передавать флагами
+const (
+	EnvRedactKey = "MIGRATOR_REDACT_KEY"
+	EnvUUIDKey   = "MIGRATOR_UUID_KEY"
+)
+
+// Команды мигратора
+const (
+	CommandMigrate = "migrate"
+	CommandVerify  = "verify"
+	CommandPlan    = "plan"
+	CommandCheck   = "check"
+	CommandLookup  = "lookup"
+	CommandCDC     = "cdc"
+)
+
+// fatal завершает процесс при неверной конфигурации, тесты подменяют его, чтобы проверить валидацию
+var fatal = logx.Fatal
+
 type Config struct {
+	// Команда: migrate (по умолчанию), verify, plan, check, lookup или cdc
+	Command string
+
+	// Аргументы команды lookup: nid и UUID, которые нужно найти в карте UUID
+	LookupKeys []string
+
 	// БД-источник
 	SrcDSN    string
 	SrcTable  string
@@ -21,14 +67,49 @@ type Config struct {
 	DstNID   string
 	DstUuid  string
 
+	// Колонки таблиц, если заданы в файле заданий (пусто = все колонки таблицы по порядку)
+	SrcColumns []string
+	DstColumns []string
+
+	// Соответствие колонок из файла заданий: правила для колонок целевой таблицы и колонки источника,
+	// которые не переносятся. Пусто = соответствие по позиции
+	ColumnMap   []dbx.ColumnRule
+	DropColumns []string
+
+	// Трансформеры строк из файла заданий, применяются в stage-фазе по порядку
+	Transforms []transform.Spec
+
+	// Внешние ключи таблицы из файла заданий: колонки с nid строк родительских таблиц
+	ForeignKeys []ForeignKey
+
+	// Правила маскирования персональных данных из файла заданий и ключ HMAC для правил hmac
+	Redact    []redact.Rule
+	RedactKey string
+
+	// Файл заданий и задания на миграцию нескольких таблиц
+	JobsFile string
+	Jobs     []TableJob
+
 	// UUIDv7
 	TSColumnIdx int
+	TSColumn    string
 	UUIDTZ      string
+	// UUIDKey секрет для детерминированных UUIDv7: случайные биты берутся из HMAC от таблицы и nid
+	UUIDKey string
+	// UUIDMonotonic UUIDv7 сортируются по (ts, nid): доля миллисекунды в rand_a, nid в rand_b
+	UUIDMonotonic bool
+	// UUIDFormat формат UUID в CSV и целевой колонке (uuidv7.Formats) или auto
+	UUIDFormat string
+
+	// Карта UUID: пары (таблица-источник, nid, UUID) записываются в таблицу целевой БД или в локальный файл
+	UUIDMapTable string
+	UUIDMapFile  string
 
 	// Производительность
 	StageWorkers int
 	LoadWorkers  int
 	ChunkSize    int
+	SplitMode    string
 
 	// Оптимизация целевой БД, на момент миграции
 	InnodbBufferPoolSize uint64
@@ -38,12 +119,71 @@ type Config struct {
 	// Load mode
 	UseLocalInfile bool
 	UseFastLoad    bool
+	UseStream      bool
+	UseInsert      bool
+	InsertBatch    int
+
+	// Ограничение временных файлов, ожидающих загрузки (0 = без ограничения)
+	MaxStagedBytes uint64
+	MaxStagedFiles int
+
+	// Повтор шардов после временных ошибок MySQL
+	Retries         int
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+
+	// Журнал шардов для возобновления прерванной миграции
+	JournalDir string
+
+	// Поиск и восстановление пропущенных диапазонов ID в целевой таблице
+	RepairGaps bool
+
+	// Режим слежения: после основной миграции опрашивать источник с периодом PollInterval и переносить
+	// новые строки шардами по FollowChunk ID. FollowLag - сколько ждать, прежде чем перенести ID, увиденные
+	// опросом: транзакции с меньшими ID за это время успевают зафиксироваться
+	Follow       bool
+	PollInterval time.Duration
+	FollowChunk  int
+	FollowLag    time.Duration
+
+	// Перенос изменений из binlog (команда cdc): позиция, с которой читать binlog без контрольной точки,
+	// server-id реплики, количество измененных nid в одном применении, период применения и блокирующее
+	// чтение источника
+	BinlogStart      string
+	CDCServerID      uint
+	CDCBatch         int
+	CDCFlushInterval time.Duration
+	CDCLockReads     bool
+
+	// Сверка: путь до CSV-файла со списком расхождений
+	VerifyOut string
+
+	// Не проверять совместимость схем перед миграцией
+	SkipSchemaCheck bool
+
+	// Адрес HTTP-листенера с метриками Prometheus (пустая строка = выключен)
+	MetricsAddr string
+
+	// Период вывода прогресса (0 = выключен)
+	ProgressInterval time.Duration
+
+	// Логирование: уровень и формат (text или json)
+	LogLevel  string
+	LogFormat string
 }
 
 func ParseConfig(args []string) Config {
-	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
 	var c Config
 
+	// Первый аргумент без дефиса - команда
+	c.Command = CommandMigrate
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		c.Command = args[0]
+		args = args[1:]
+	}
+
+	fs := flag.NewFlagSet(c.Command, flag.ExitOnError)
+
 	fs.StringVar(&c.SrcDSN, "src-dsn", "", "MariaDB DSN for source database (required)")
 	fs.StringVar(&c.SrcTable, "src-table", "log", "Source table (default: log)")
 	fs.StringVar(&c.SrcFilter, "src-filter", "", "Optional filter for query requests (example: id % 100 = 0)")
@@ -54,12 +194,24 @@ func ParseConfig(args []string) Config {
 	fs.StringVar(&c.DstNID, "dst-nid", "nid", "Destination table numeric ID column name (default: nid)")
 	fs.StringVar(&c.DstUuid, "dst-uuid", "id", "Destination table UUID column name (default: id)")
 
+	fs.StringVar(&c.JobsFile, "jobs", "", "JSON job file with multiple tables to migrate in one run; table flags become defaults")
+	fs.StringVar(&c.RedactKey, "redact-key", "", "Secret key for hmac redact rules from the job file; visible in the process list, prefer -redact-key-file or $"+EnvRedactKey)
+	redactKeyFile := fs.String("redact-key-file", "", "File with the secret key for hmac redact rules")
+
 	fs.IntVar(&c.TSColumnIdx, "ts-idx", 2, "The position of the column in source table that contains the date used to generate the UUIDv7 (default: 2)")
+	fs.StringVar(&c.TSColumn, "ts-column", "", "Name of the source column with the date used to generate the UUIDv7; overrides -ts-idx")
 	fs.StringVar(&c.UUIDTZ, "uuid-tz", "UTC", "Destination table (default: UTC)")
+	fs.StringVar(&c.UUIDKey, "uuid-key", "", "Secret key for deterministic UUIDv7: random bits are derived from the source table and nid, so re-runs produce identical IDs; visible in the process list, prefer -uuid-key-file or $"+EnvUUIDKey)
+	uuidKeyFile := fs.String("uuid-key-file", "", "File with the secret key for deterministic UUIDv7")
+	fs.BoolVar(&c.UUIDMonotonic, "uuid-monotonic", false, "Make UUIDv7 sort by (timestamp, nid) within the same millisecond (RFC 9562 counter in rand_a/rand_b)")
+	fs.StringVar(&c.UUIDFormat, "uuid-format", UUIDFormatAuto, "UUID encoding: binary, hex, canonical, swapped (UUID_TO_BIN(uuid, 1)) or auto (detected from the destination column type)")
+	fs.StringVar(&c.UUIDMapTable, "uuid-map-table", "", "Record (source table, nid, UUID) of every staged row into this destination table, created if missing")
+	fs.StringVar(&c.UUIDMapFile, "uuid-map-file", "", "Record (source table, nid, UUID) of every staged row into this local CSV file")
 
 	fs.IntVar(&c.StageWorkers, "sw", runtime.NumCPU(), "Parallel stage workers")
 	fs.IntVar(&c.LoadWorkers, "lw", runtime.NumCPU(), "Parallel load workers")
 	fs.IntVar(&c.ChunkSize, "chunk", 100_000, "Rows per chunk file (default: 100 000)")
+	fs.StringVar(&c.SplitMode, "split", SplitUniform, "Shard split mode: uniform (equal ID spans) or density (about -chunk rows per shard, probed by PK index)")
 
 	// Database optimization
 	var bufferPoolGB float64
@@ -69,55 +221,278 @@ func ParseConfig(args []string) Config {
 
 	// Load mode
 	fs.BoolVar(&c.UseLocalInfile, "local-infile", false, "Use LOAD DATA LOCAL INFILE (files on client) instead of LOAD DATA INFILE (files on server)")
+	fs.BoolVar(&c.UseStream, "stream", false, "Stream rows straight into LOAD DATA LOCAL INFILE without temp files (requires -local-infile)")
+	fs.BoolVar(&c.UseInsert, "insert", false, "Load rows with batched multi-row INSERT (selected automatically when secure_file_priv is empty)")
+	fs.IntVar(&c.InsertBatch, "insert-batch", 1000, "Rows per INSERT statement in insert mode (default: 1000)")
 	fs.BoolVar(&c.UseFastLoad, "fast-load", true, "Enable fast load optimizations: disable unique/FK checks, binlog, redo log (default: true)")
 
-	_ = fs.Parse(args)
+	// Staged files budget
+	fs.Func("max-staged-bytes", "Pause stage workers while staged files waiting for load exceed this size, e.g. 200G (0 = unlimited, default: 0)", func(v string) error {
+		size, err := util.ParseBytes(v)
+		c.MaxStagedBytes = size
+		return err
+	})
+	fs.IntVar(&c.MaxStagedFiles, "max-staged-files", 0, "Pause stage workers while this many staged files wait for load (0 = unlimited, default: 0)")
+
+	// Retries
+	fs.IntVar(&c.Retries, "retries", 3, "Retries per shard after transient MySQL errors: deadlock, lock wait timeout, lost connection (0 = disabled, default: 3)")
+	fs.DurationVar(&c.RetryBackoff, "retry-backoff", time.Second, "Pause before the first retry, doubled on each next one (default: 1s)")
+	fs.DurationVar(&c.RetryMaxBackoff, "retry-max-backoff", 30*time.Second, "Maximum pause between retries (default: 30s)")
+
+	// Checkpoint journal
+	fs.StringVar(&c.JournalDir, "journal-dir", "", "Directory for the shard checkpoint journal used to resume interrupted runs (default: empty, journal disabled and destination must be empty)")
+
+	// Gap repair
+	fs.BoolVar(&c.RepairGaps, "repair-gaps", false, "Compare row counts per chunk in source and destination and re-migrate only ranges where destination is short")
+
+	// Follow
+	fs.BoolVar(&c.Follow, "follow", false, "After the initial run keep polling the source for new rows and migrate them until SIGTERM")
+	fs.DurationVar(&c.PollInterval, "poll-interval", 10*time.Second, "follow: pause between polls of the source for new rows (default: 10s)")
+	fs.IntVar(&c.FollowChunk, "follow-chunk", 10_000, "follow: IDs per shard for new rows (default: 10 000)")
+	fs.DurationVar(&c.FollowLag, "follow-lag", 30*time.Second, "follow: migrate IDs only after they were seen this long ago, so transactions holding lower IDs have committed (0 = immediately, default: 30s)")
+
+	// CDC
+	fs.StringVar(&c.BinlogStart, "binlog-start", "", "cdc: binlog position file:pos to start from when there is no checkpoint (empty = current position of the source)")
+	fs.UintVar(&c.CDCServerID, "cdc-server-id", 0, "cdc: replica server-id, unique among replicas of the source (required)")
+	fs.IntVar(&c.CDCBatch, "cdc-batch", 1000, "cdc: changed nids per table that trigger applying changes (default: 1000)")
+	fs.DurationVar(&c.CDCFlushInterval, "cdc-flush-interval", time.Second, "cdc: maximum delay before changes are applied to destination (default: 1s)")
+	fs.BoolVar(&c.CDCLockReads, "cdc-lock-reads", false, "cdc: re-read changed rows with LOCK IN SHARE MODE (default: false)")
+
+	// Verify
+	fs.StringVar(&c.VerifyOut, "verify-out", "", "verify: write mismatched ranges to this CSV file")
+
+	// Schema check
+	fs.BoolVar(&c.SkipSchemaCheck, "skip-schema-check", false, "Do not stop the migration on blocking schema incompatibilities found by the preflight check")
+
+	// Metrics
+	fs.StringVar(&c.MetricsAddr, "metrics-addr", "", "Listen address for Prometheus metrics at /metrics, e.g. :9108 (empty = disabled)")
+
+	// Progress
+	fs.DurationVar(&c.ProgressInterval, "progress-interval", 30*time.Second, "Log progress with percentage, throughput and ETA at this interval (0 = disabled, default: 30s)")
+
+	// Logging
+	fs.StringVar(&c.LogLevel, "log-level", "info", "Log level: debug, info, warn or error (default: info)")
+	fs.StringVar(&c.LogFormat, "log-format", logx.FormatText, "Log format: text or json (default: text)")
+
+	c.LookupKeys = parseArgs(fs, args)
+
+	// Секреты из аргументов видны в списке процессов, поэтому их можно передать файлом или переменной окружения
+	var err error
+	if c.RedactKey, err = readSecret(c.RedactKey, *redactKeyFile, EnvRedactKey); err != nil {
+		fatal("invalid redact key", "err", err)
+	}
+	if c.UUIDKey, err = readSecret(c.UUIDKey, *uuidKeyFile, EnvUUIDKey); err != nil {
+		fatal("invalid uuid key", "err", err)
+	}
 
 	// Convert GB to bytes
 	if bufferPoolGB > 0 {
 		c.InnodbBufferPoolSize = uint64(bufferPoolGB * 1024 * 1024 * 1024)
 	}
 
-	validateConfig(c)
+	// Задания из файла проверяются так же, как таблица из флагов
+	if c.JobsFile != "" {
+		jobs, err := LoadJobFile(c.JobsFile)
+		if err != nil {
+			fatal("invalid job file", "err", err)
+		}
+		c.Jobs = jobs
+	}
+
+	for _, table := range c.Tables() {
+		validateConfig(table)
+	}
 
 	return c
 }
 
+// parseArgs разбирает флаги вперемешку с аргументами и возвращает аргументы: flag останавливается на первом
+// аргументе без дефиса, поэтому разбор продолжается после каждого из них. После "--" все считается аргументами
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+	var out []string
+	for {
+		_ = fs.Parse(args)
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return out
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(out, rest...)
+		}
+		out = append(out, rest[0])
+		args = rest[1:]
+	}
+}
+
+// readSecret возвращает секрет из флага, из файла или из переменной окружения env, если не задано ни то ни другое.
+// Перевод строки в конце файла отбрасывается
+func readSecret(value, file, env string) (string, error) {
+	switch {
+	case value != "" && file != "":
+		return "", errors.New("secret is set both by flag and by file")
+	case value != "":
+		return value, nil
+	case file != "":
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("read secret file: %w", err)
+		}
+		secret := strings.TrimRight(string(data), "\r\n")
+		if secret == "" {
+			return "", fmt.Errorf("secret file %s is empty", file)
+		}
+		return secret, nil
+	default:
+		return os.Getenv(env), nil
+	}
+}
+
 func validateConfig(cfg Config) {
-	if cfg.SrcDSN == "" || cfg.DstDSN == "" {
-		log.Fatalln("src-dsn and dst-dsn are required")
+	switch cfg.Command {
+	case CommandMigrate, CommandVerify, CommandPlan, CommandCheck, CommandLookup, CommandCDC:
+	default:
+		fatal("unknown command", "command", cfg.Command, "expected", []string{CommandMigrate, CommandVerify, CommandPlan, CommandCheck, CommandLookup, CommandCDC})
+	}
+
+	// Поиск в карте UUID идет только по целевой БД или по файлу карты
+	if cfg.Command == CommandLookup {
+		if len(cfg.LookupKeys) == 0 {
+			fatal("lookup needs at least one nid or UUID argument")
+		}
+		if cfg.DstDSN == "" && cfg.UUIDMapFile == "" {
+			fatal("lookup requires dst-dsn or uuid-map-file")
+		}
+	} else if cfg.SrcDSN == "" || cfg.DstDSN == "" {
+		fatal("src-dsn and dst-dsn are required")
+	}
+	if len(cfg.LookupKeys) > 0 && cfg.Command != CommandLookup {
+		fatal("unexpected arguments", "command", cfg.Command, "args", cfg.LookupKeys)
+	}
+
+	// Карта UUID пишется в одно место
+	if cfg.UUIDMapTable != "" && cfg.UUIDMapFile != "" {
+		fatal("-uuid-map-table cannot be combined with -uuid-map-file")
 	}
 
 	// Валидируем врокеры
 	if cfg.StageWorkers < 1 {
-		log.Fatalln("stage workers must be at least 1")
+		fatal("stage workers must be at least 1")
 	}
 	if cfg.StageWorkers > 100 {
-		log.Fatalf("stage workers must be between 1 and 100, got %d", cfg.StageWorkers)
+		fatal("stage workers must be between 1 and 100", "got", cfg.StageWorkers)
 	}
 
 	if cfg.LoadWorkers < 1 {
-		log.Fatalln("load workers must be at least 1")
+		fatal("load workers must be at least 1")
 	}
 	if cfg.LoadWorkers > 100 {
-		log.Fatalf("load workers must be between 1 and 100, got %d", cfg.LoadWorkers)
+		fatal("load workers must be between 1 and 100", "got", cfg.LoadWorkers)
 	}
 
 	// Валидируем размер чанка
 	if cfg.ChunkSize < 1 {
-		log.Fatalln("chunk size must be at least 1")
+		fatal("chunk size must be at least 1")
 	}
 	if cfg.ChunkSize > 10_000_000 {
-		log.Fatalf("chunk size must be between 1 and 10,000,000, got %d", cfg.ChunkSize)
+		fatal("chunk size must be between 1 and 10,000,000", "got", cfg.ChunkSize)
+	}
+
+	// Валидируем способ разбиения
+	if cfg.SplitMode != SplitUniform && cfg.SplitMode != SplitDensity {
+		fatal("split must be "+SplitUniform+" or "+SplitDensity, "got", cfg.SplitMode)
+	}
+
+	// Валидируем формат UUID
+	if cfg.UUIDFormat != UUIDFormatAuto && !slices.Contains(uuidv7.Formats, cfg.UUIDFormat) {
+		fatal("invalid uuid format", "got", cfg.UUIDFormat, "expected", append([]string{UUIDFormatAuto}, uuidv7.Formats...))
+	}
+
+	// Потоковая загрузка работает только через LOCAL INFILE
+	if cfg.UseStream && !cfg.UseLocalInfile {
+		fatal("stream mode requires -local-infile")
+	}
+
+	// INSERT-загрузка - отдельный способ, не совместимый с LOAD DATA режимами
+	if cfg.UseInsert && (cfg.UseLocalInfile || cfg.UseStream) {
+		fatal("-insert cannot be combined with -local-infile or -stream")
+	}
+	if cfg.InsertBatch < 1 || cfg.InsertBatch > 100_000 {
+		fatal("insert batch must be between 1 and 100,000", "got", cfg.InsertBatch)
+	}
+
+	// Валидируем бюджет временных файлов
+	if cfg.MaxStagedFiles < 0 {
+		fatal("max staged files must not be negative", "got", cfg.MaxStagedFiles)
+	}
+
+	// Валидируем повторы
+	if cfg.Retries < 0 || cfg.Retries > 100 {
+		fatal("retries must be between 0 and 100", "got", cfg.Retries)
+	}
+	if cfg.RetryBackoff <= 0 || cfg.RetryMaxBackoff < cfg.RetryBackoff {
+		fatal("retry backoff must be positive and not greater than retry max backoff", "backoff", cfg.RetryBackoff, "max_backoff", cfg.RetryMaxBackoff)
+	}
+
+	// Слежение продолжает миграцию, поэтому имеет смысл только для нее
+	if cfg.Follow {
+		if cfg.Command != CommandMigrate {
+			fatal("-follow is supported only by the migrate command", "command", cfg.Command)
+		}
+		if cfg.RepairGaps {
+			fatal("-follow cannot be combined with -repair-gaps", "table", cfg.SrcTable)
+		}
+		if cfg.PollInterval <= 0 {
+			fatal("poll interval must be positive", "got", cfg.PollInterval)
+		}
+		if cfg.FollowChunk < 1 || cfg.FollowChunk > 10_000_000 {
+			fatal("follow chunk must be between 1 and 10,000,000", "got", cfg.FollowChunk)
+		}
+		if cfg.FollowLag < 0 {
+			fatal("follow lag must not be negative", "got", cfg.FollowLag)
+		}
+	}
+
+	// Перенос изменений применяет их по nid, поэтому восстановление пропусков с ним не совмещается
+	if cfg.Command == CommandCDC {
+		if cfg.RepairGaps {
+			fatal("cdc cannot be combined with -repair-gaps", "table", cfg.SrcTable)
+		}
+		if cfg.CDCServerID == 0 || cfg.CDCServerID > math.MaxUint32 {
+			fatal("cdc requires -cdc-server-id between 1 and 4294967295", "got", cfg.CDCServerID)
+		}
+		if cfg.BinlogStart != "" {
+			if _, err := binlog.ParsePosition(cfg.BinlogStart); err != nil {
+				fatal("invalid binlog start", "err", err)
+			}
+		}
+		if cfg.CDCBatch < 1 || cfg.CDCBatch > 100_000 {
+			fatal("cdc batch must be between 1 and 100,000", "got", cfg.CDCBatch)
+		}
+		if cfg.CDCFlushInterval <= 0 {
+			fatal("cdc flush interval must be positive", "got", cfg.CDCFlushInterval)
+		}
+	}
+
+	// Валидируем период вывода прогресса
+	if cfg.ProgressInterval < 0 {
+		fatal("progress interval must not be negative", "got", cfg.ProgressInterval)
+	}
+
+	// Валидируем настройки логирования
+	if _, err := logx.ParseLevel(cfg.LogLevel); err != nil {
+		fatal("invalid log level", "err", err)
+	}
+	if cfg.LogFormat != logx.FormatText && cfg.LogFormat != logx.FormatJSON {
+		fatal("log format must be "+logx.FormatText+" or "+logx.FormatJSON, "got", cfg.LogFormat)
 	}
 
 	// Валидируем SQL-инъекции
 	if err := dbx.ValidateWhereClause(cfg.SrcFilter); err != nil {
-		log.Fatalf("invalid source filter: %v", err)
+		fatal("invalid source filter", "err", err)
 	}
 
 	// Валидируем индекс колонки с TS
 	if cfg.TSColumnIdx < 1 {
-		log.Fatalln("ts-idx must be at least 1")
+		fatal("ts-idx must be at least 1")
 	}
 }
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestParseConfig(t *testing.T) {
@@ -47,12 +51,114 @@ func TestParseConfig(t *testing.T) {
 			checkField:    "UseLocalInfile",
 			expectedValue: true,
 		},
+		{
+			name:          "stream with local infile",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-local-infile", "-stream"},
+			checkField:    "UseStream",
+			expectedValue: true,
+		},
+		{
+			name:          "uniform split by default",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"},
+			checkField:    "SplitMode",
+			expectedValue: SplitUniform,
+		},
+		{
+			name:          "density split",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-split", "density"},
+			checkField:    "SplitMode",
+			expectedValue: SplitDensity,
+		},
 		{
 			name:          "fast load disabled",
 			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-fast-load=false"},
 			checkField:    "UseFastLoad",
 			expectedValue: false,
 		},
+		{
+			name:          "migrate command by default",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"},
+			checkField:    "Command",
+			expectedValue: CommandMigrate,
+		},
+		{
+			name:          "verify command",
+			args:          []string{"verify", "-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"},
+			checkField:    "Command",
+			expectedValue: CommandVerify,
+		},
+		{
+			name:          "plan command",
+			args:          []string{"plan", "-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"},
+			checkField:    "Command",
+			expectedValue: CommandPlan,
+		},
+		{
+			name:          "lookup with map file",
+			args:          []string{"lookup", "-uuid-map-file", "uuid_map.csv", "42", "0190c2a1-b2c3-7d4e-8f9a-0b1c2d3e4f50"},
+			checkField:    "LookupKeys",
+			expectedValue: []string{"42", "0190c2a1-b2c3-7d4e-8f9a-0b1c2d3e4f50"},
+		},
+		{
+			name:          "lookup flags after keys",
+			args:          []string{"lookup", "42", "-uuid-map-file", "uuid_map.csv", "43", "-src-table", "audit"},
+			checkField:    "LookupKeys",
+			expectedValue: []string{"42", "43"},
+		},
+		{
+			name:          "lookup keys after terminator",
+			args:          []string{"lookup", "-uuid-map-file", "uuid_map.csv", "42", "--", "-43"},
+			checkField:    "LookupKeys",
+			expectedValue: []string{"42", "-43"},
+		},
+		{
+			name:          "staged bytes budget",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-max-staged-bytes", "200G"},
+			checkField:    "MaxStagedBytes",
+			expectedValue: uint64(200 << 30),
+		},
+		{
+			name:          "retries disabled",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-retries", "0"},
+			checkField:    "Retries",
+			expectedValue: 0,
+		},
+		{
+			name:          "custom retry backoff",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-retry-backoff", "250ms"},
+			checkField:    "RetryBackoff",
+			expectedValue: 250 * time.Millisecond,
+		},
+		{
+			name:          "follow with poll interval",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-follow", "-poll-interval", "2s"},
+			checkField:    "PollInterval",
+			expectedValue: 2 * time.Second,
+		},
+		{
+			name:          "follow lag by default",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-follow"},
+			checkField:    "FollowLag",
+			expectedValue: 30 * time.Second,
+		},
+		{
+			name:          "cdc with binlog start",
+			args:          []string{"cdc", "-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-cdc-server-id", "4201", "-binlog-start", "mysql-bin.000042:154"},
+			checkField:    "BinlogStart",
+			expectedValue: "mysql-bin.000042:154",
+		},
+		{
+			name:          "journal disabled by default",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"},
+			checkField:    "JournalDir",
+			expectedValue: "",
+		},
+		{
+			name:          "uuid key from flag",
+			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db", "-uuid-key", "secret"},
+			checkField:    "UUIDKey",
+			expectedValue: "secret",
+		},
 		{
 			name:          "fast load enabled by default",
 			args:          []string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"},
@@ -66,6 +172,10 @@ func TestParseConfig(t *testing.T) {
 			cfg := ParseConfig(tt.args)
 
 			switch tt.checkField {
+			case "Command":
+				if cfg.Command != tt.expectedValue.(string) {
+					t.Errorf("Command = %v, want %v", cfg.Command, tt.expectedValue)
+				}
 			case "SrcTable":
 				if cfg.SrcTable != tt.expectedValue.(string) {
 					t.Errorf("SrcTable = %v, want %v", cfg.SrcTable, tt.expectedValue)
@@ -86,6 +196,50 @@ func TestParseConfig(t *testing.T) {
 				if cfg.UseLocalInfile != tt.expectedValue.(bool) {
 					t.Errorf("UseLocalInfile = %v, want %v", cfg.UseLocalInfile, tt.expectedValue)
 				}
+			case "SplitMode":
+				if cfg.SplitMode != tt.expectedValue.(string) {
+					t.Errorf("SplitMode = %v, want %v", cfg.SplitMode, tt.expectedValue)
+				}
+			case "UseStream":
+				if cfg.UseStream != tt.expectedValue.(bool) {
+					t.Errorf("UseStream = %v, want %v", cfg.UseStream, tt.expectedValue)
+				}
+			case "MaxStagedBytes":
+				if cfg.MaxStagedBytes != tt.expectedValue.(uint64) {
+					t.Errorf("MaxStagedBytes = %v, want %v", cfg.MaxStagedBytes, tt.expectedValue)
+				}
+			case "Retries":
+				if cfg.Retries != tt.expectedValue.(int) {
+					t.Errorf("Retries = %v, want %v", cfg.Retries, tt.expectedValue)
+				}
+			case "RetryBackoff":
+				if cfg.RetryBackoff != tt.expectedValue.(time.Duration) {
+					t.Errorf("RetryBackoff = %v, want %v", cfg.RetryBackoff, tt.expectedValue)
+				}
+			case "PollInterval":
+				if !cfg.Follow || cfg.PollInterval != tt.expectedValue.(time.Duration) {
+					t.Errorf("Follow = %v, PollInterval = %v, want true, %v", cfg.Follow, cfg.PollInterval, tt.expectedValue)
+				}
+			case "FollowLag":
+				if cfg.FollowLag != tt.expectedValue.(time.Duration) {
+					t.Errorf("FollowLag = %v, want %v", cfg.FollowLag, tt.expectedValue)
+				}
+			case "BinlogStart":
+				if cfg.Command != CommandCDC || cfg.CDCServerID != 4201 || cfg.BinlogStart != tt.expectedValue.(string) {
+					t.Errorf("Command = %v, CDCServerID = %v, BinlogStart = %v, want cdc, 4201, %v", cfg.Command, cfg.CDCServerID, cfg.BinlogStart, tt.expectedValue)
+				}
+			case "LookupKeys":
+				if !slices.Equal(cfg.LookupKeys, tt.expectedValue.([]string)) {
+					t.Errorf("LookupKeys = %v, want %v", cfg.LookupKeys, tt.expectedValue)
+				}
+			case "UUIDKey":
+				if cfg.UUIDKey != tt.expectedValue.(string) {
+					t.Errorf("UUIDKey = %q, want %q", cfg.UUIDKey, tt.expectedValue)
+				}
+			case "JournalDir":
+				if cfg.JournalDir != tt.expectedValue.(string) {
+					t.Errorf("JournalDir = %q, want %q", cfg.JournalDir, tt.expectedValue)
+				}
 			case "UseFastLoad":
 				if cfg.UseFastLoad != tt.expectedValue.(bool) {
 					t.Errorf("UseFastLoad = %v, want %v", cfg.UseFastLoad, tt.expectedValue)
@@ -98,140 +252,165 @@ func TestParseConfig(t *testing.T) {
 func TestValidateConfig(t *testing.T) {
 	tests := []struct {
 		name      string
-		cfg       Config
+		modify    func(c *Config)
 		shouldErr bool
 	}{
 		{
-			name: "valid config",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 4,
-				LoadWorkers:  2,
-				ChunkSize:    100000,
-				TSColumnIdx:  2,
-			},
-			shouldErr: false,
+			name:   "valid config",
+			modify: func(c *Config) {},
 		},
 		{
-			name: "missing src-dsn",
-			cfg: Config{
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 4,
-				LoadWorkers:  2,
-				ChunkSize:    100000,
-				TSColumnIdx:  2,
-			},
+			name:      "missing src-dsn",
+			modify:    func(c *Config) { c.SrcDSN = "" },
 			shouldErr: true,
 		},
 		{
-			name: "missing dst-dsn",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 4,
-				LoadWorkers:  2,
-				ChunkSize:    100000,
-				TSColumnIdx:  2,
-			},
+			name:      "missing dst-dsn",
+			modify:    func(c *Config) { c.DstDSN = "" },
 			shouldErr: true,
 		},
 		{
-			name: "invalid stage workers - zero",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 0,
-				LoadWorkers:  2,
-				ChunkSize:    100000,
-				TSColumnIdx:  2,
-			},
+			name:      "invalid stage workers - zero",
+			modify:    func(c *Config) { c.StageWorkers = 0 },
 			shouldErr: true,
 		},
 		{
-			name: "invalid stage workers - too many",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 101,
-				LoadWorkers:  2,
-				ChunkSize:    100000,
-				TSColumnIdx:  2,
-			},
+			name:      "invalid stage workers - too many",
+			modify:    func(c *Config) { c.StageWorkers = 101 },
 			shouldErr: true,
 		},
 		{
-			name: "invalid load workers - zero",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 4,
-				LoadWorkers:  0,
-				ChunkSize:    100000,
-				TSColumnIdx:  2,
-			},
+			name:      "invalid load workers - zero",
+			modify:    func(c *Config) { c.LoadWorkers = 0 },
 			shouldErr: true,
 		},
 		{
-			name: "invalid chunk size - zero",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 4,
-				LoadWorkers:  2,
-				ChunkSize:    0,
-				TSColumnIdx:  2,
-			},
+			name:      "invalid chunk size - zero",
+			modify:    func(c *Config) { c.ChunkSize = 0 },
 			shouldErr: true,
 		},
 		{
-			name: "invalid chunk size - too large",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 4,
-				LoadWorkers:  2,
-				ChunkSize:    20000000,
-				TSColumnIdx:  2,
-			},
+			name:      "invalid chunk size - too large",
+			modify:    func(c *Config) { c.ChunkSize = 20000000 },
 			shouldErr: true,
 		},
 		{
-			name: "invalid ts column index",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				StageWorkers: 4,
-				LoadWorkers:  2,
-				ChunkSize:    100000,
-				TSColumnIdx:  0,
-			},
+			name:      "invalid ts column index",
+			modify:    func(c *Config) { c.TSColumnIdx = 0 },
+			shouldErr: true,
+		},
+		{
+			name:      "stream without local infile",
+			modify:    func(c *Config) { c.UseStream = true },
 			shouldErr: true,
 		},
 		{
-			name: "invalid filter - SQL injection",
-			cfg: Config{
-				SrcDSN:       "user:pass@tcp(host:3306)/db",
-				DstDSN:       "user:pass@tcp(host:3306)/db",
-				SrcFilter:    "id > 1; DROP TABLE users",
-				StageWorkers: 4,
-				LoadWorkers:  2,
-				ChunkSize:    100000,
-				TSColumnIdx:  2,
+			name: "stream with local infile",
+			modify: func(c *Config) {
+				c.UseStream = true
+				c.UseLocalInfile = true
 			},
+		},
+		{
+			name:      "invalid filter - SQL injection",
+			modify:    func(c *Config) { c.SrcFilter = "id > 1; DROP TABLE users" },
+			shouldErr: true,
+		},
+		{
+			name:      "unknown command",
+			modify:    func(c *Config) { c.Command = "drop" },
+			shouldErr: true,
+		},
+		{
+			name:      "follow with repair gaps",
+			modify:    func(c *Config) { c.Follow, c.RepairGaps = true, true },
 			shouldErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// We can't directly test validateConfig since it calls log.Fatal
-			// Instead, we test the validation logic through ParseConfig
-			// or we could refactor validateConfig to return errors instead of calling log.Fatal
+			cfg := ParseConfig([]string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"})
+			tt.modify(&cfg)
+
+			if failed := validationFails(cfg); failed != tt.shouldErr {
+				t.Errorf("validateConfig() failed = %v, want %v", failed, tt.shouldErr)
+			}
+		})
+	}
+}
+
+// validationFails проверяет cfg, подменив завершение процесса паникой
+func validationFails(cfg Config) (failed bool) {
+	type fatalError struct{}
+
+	orig := fatal
+	fatal = func(string, ...any) { panic(fatalError{}) }
+	defer func() {
+		fatal = orig
+		if r := recover(); r != nil {
+			if _, ok := r.(fatalError); !ok {
+				panic(r)
+			}
+			failed = true
+		}
+	}()
+
+	validateConfig(cfg)
+	return false
+}
+
+func TestReadSecret(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	if err := os.WriteFile(keyFile, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty")
+	if err := os.WriteFile(emptyFile, []byte("\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	const env = "MIGRATOR_TEST_SECRET"
+	t.Setenv(env, "from-env")
 
-			// For now, just document that these configs would fail validation
-			if tt.shouldErr {
-				t.Logf("Config %q should fail validation", tt.name)
+	tests := []struct {
+		name    string
+		value   string
+		file    string
+		want    string
+		wantErr bool
+	}{
+		{name: "flag", value: "from-flag", want: "from-flag"},
+		{name: "file without trailing newline", file: keyFile, want: "from-file"},
+		{name: "environment", want: "from-env"},
+		{name: "flag and file", value: "from-flag", file: keyFile, wantErr: true},
+		{name: "empty file", file: emptyFile, wantErr: true},
+		{name: "missing file", file: filepath.Join(dir, "missing"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readSecret(tt.value, tt.file, env)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readSecret() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("readSecret() = %q, want %q", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestParseConfigSecretsFromEnv(t *testing.T) {
+	t.Setenv(EnvUUIDKey, "uuid-secret")
+	t.Setenv(EnvRedactKey, "redact-secret")
+
+	cfg := ParseConfig([]string{"-src-dsn", "user:pass@tcp(host:3306)/db", "-dst-dsn", "user:pass@tcp(host:3306)/db"})
+	if cfg.UUIDKey != "uuid-secret" {
+		t.Errorf("UUIDKey = %q, want %q", cfg.UUIDKey, "uuid-secret")
+	}
+	if cfg.RedactKey != "redact-secret" {
+		t.Errorf("RedactKey = %q, want %q", cfg.RedactKey, "redact-secret")
+	}
+}
@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/redact"
+	"logs-migrator/pkg/transform"
+	"os"
+)
+
+// JobFile файл заданий для миграции нескольких таблиц за один запуск
+type JobFile struct {
+	Tables []TableJob `json:"tables"`
+}
+
+// TableJob задание на миграцию одной таблицы. Пустые поля берутся из флагов командной строки,
+// кроме dst_table: по умолчанию целевая таблица называется так же, как таблица-источник. Колонки,
+// соответствие, трансформеры, маскирование и внешние ключи задаются только в файле и не наследуются
+// между таблицами
+type TableJob struct {
+	SrcTable   string   `json:"src_table"`
+	SrcFilter  string   `json:"src_filter,omitempty"`
+	SrcNID     string   `json:"src_nid,omitempty"`
+	SrcColumns []string `json:"src_columns,omitempty"`
+
+	DstTable   string   `json:"dst_table,omitempty"`
+	DstNID     string   `json:"dst_nid,omitempty"`
+	DstUuid    string   `json:"dst_uuid,omitempty"`
+	DstColumns []string `json:"dst_columns,omitempty"`
+
+	Map       []dbx.ColumnRule `json:"map,omitempty"`
+	Drop      []string         `json:"drop,omitempty"`
+	Transform []transform.Spec `json:"transform,omitempty"`
+	Redact    []redact.Rule    `json:"redact,omitempty"`
+
+	ForeignKeys []ForeignKey `json:"foreign_keys,omitempty"`
+
+	TSColumnIdx int    `json:"ts_idx,omitempty"`
+	TSColumn    string `json:"ts_column,omitempty"`
+	UUIDTZ      string `json:"uuid_tz,omitempty"`
+	UUIDFormat  string `json:"uuid_format,omitempty"`
+
+	ChunkSize int    `json:"chunk,omitempty"`
+	SplitMode string `json:"split,omitempty"`
+
+	UseInsert   *bool `json:"insert,omitempty"`
+	InsertBatch int   `json:"insert_batch,omitempty"`
+	RepairGaps  *bool `json:"repair_gaps,omitempty"`
+}
+
+// Действия с дочерними строками, у которых нет родительской строки
+const (
+	OrphanSkip = "skip"
+	OrphanNull = "null"
+	OrphanFail = "fail"
+)
+
+// ForeignKey внешний ключ дочерней таблицы: колонка источника Column хранит nid строки таблицы-источника
+// Parent из того же файла заданий. При миграции значение заменяется на UUID родительской строки. OnOrphan -
+// что делать со строкой без родителя: fail (по умолчанию), null или skip. skip оставляет в целевой таблице
+// меньше строк, чем в источнике, и verify и -repair-gaps видят в таких шардах расхождение, поэтому он только явный
+type ForeignKey struct {
+	Column   string `json:"column"`
+	Parent   string `json:"parent"`
+	OnOrphan string `json:"on_orphan,omitempty"`
+}
+
+// Validate проверяет внешний ключ без привязки к таблицам
+func (fk ForeignKey) Validate() error {
+	if fk.Column == "" || fk.Parent == "" {
+		return fmt.Errorf("foreign key must set column and parent")
+	}
+	switch fk.OnOrphan {
+	case "", OrphanSkip, OrphanNull, OrphanFail:
+	default:
+		return fmt.Errorf("foreign key %s: unknown on_orphan %q", fk.Column, fk.OnOrphan)
+	}
+	return nil
+}
+
+// Orphan возвращает действие со строками без родителя
+func (fk ForeignKey) Orphan() string {
+	if fk.OnOrphan == "" {
+		return OrphanFail
+	}
+	return fk.OnOrphan
+}
+
+// LoadJobFile читает файл заданий в формате JSON. Неизвестные поля считаются ошибкой, чтобы опечатка
+// в имени поля не приводила к молчаливой миграции с настройками по умолчанию
+func LoadJobFile(path string) ([]TableJob, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read job file: %w", err)
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var jf JobFile
+	if err := dec.Decode(&jf); err != nil {
+		return nil, fmt.Errorf("parse job file %s: %w", path, err)
+	}
+
+	if len(jf.Tables) == 0 {
+		return nil, fmt.Errorf("job file %s has no tables", path)
+	}
+
+	seen := make(map[string]int, len(jf.Tables))
+	for i, t := range jf.Tables {
+		if t.SrcTable == "" {
+			return nil, fmt.Errorf("job file %s: table #%d has no src_table", path, i+1)
+		}
+
+		dst := t.DstTable
+		if dst == "" {
+			dst = t.SrcTable
+		}
+		if prev, ok := seen[dst]; ok {
+			return nil, fmt.Errorf("job file %s: tables #%d and #%d both write to %s", path, prev, i+1, dst)
+		}
+		seen[dst] = i + 1
+
+		for _, r := range t.Map {
+			if err := r.Validate(); err != nil {
+				return nil, fmt.Errorf("job file %s: table %s: %w", path, t.SrcTable, err)
+			}
+		}
+		for _, s := range t.Transform {
+			if err := s.Validate(); err != nil {
+				return nil, fmt.Errorf("job file %s: table %s: %w", path, t.SrcTable, err)
+			}
+		}
+		for _, r := range t.Redact {
+			if err := r.Validate(); err != nil {
+				return nil, fmt.Errorf("job file %s: table %s: %w", path, t.SrcTable, err)
+			}
+		}
+		for _, fk := range t.ForeignKeys {
+			if err := fk.Validate(); err != nil {
+				return nil, fmt.Errorf("job file %s: table %s: %w", path, t.SrcTable, err)
+			}
+		}
+	}
+
+	if _, err := TableWaves(jf.Tables); err != nil {
+		return nil, fmt.Errorf("job file %s: %w", path, err)
+	}
+
+	return jf.Tables, nil
+}
+
+// TableWaves делит задания на волны: в первой таблицы без внешних ключей, в каждой следующей - таблицы,
+// родители которых мигрируют в предыдущих волнах. Возвращает номера заданий по волнам в порядке файла
+func TableWaves(jobs []TableJob) ([][]int, error) {
+	index := make(map[string]int, len(jobs))
+	for i, t := range jobs {
+		index[t.SrcTable] = i
+	}
+
+	for _, t := range jobs {
+		for _, fk := range t.ForeignKeys {
+			if _, ok := index[fk.Parent]; !ok {
+				return nil, fmt.Errorf("table %s: parent table %s is not in the job file", t.SrcTable, fk.Parent)
+			}
+		}
+	}
+
+	// Волна таблицы на единицу больше самой поздней волны ее родителей. Волна не может быть больше
+	// количества таблиц, иначе в ссылках есть цикл
+	wave := make([]int, len(jobs))
+	for changed := true; changed; {
+		changed = false
+		for i, t := range jobs {
+			for _, fk := range t.ForeignKeys {
+				if w := wave[index[fk.Parent]] + 1; w > wave[i] {
+					if w >= len(jobs) {
+						return nil, fmt.Errorf("table %s: foreign keys form a cycle", t.SrcTable)
+					}
+					wave[i] = w
+					changed = true
+				}
+			}
+		}
+	}
+
+	var waves [][]int
+	for i, w := range wave {
+		for len(waves) <= w {
+			waves = append(waves, nil)
+		}
+		waves[w] = append(waves[w], i)
+	}
+
+	return waves, nil
+}
+
+// Tables возвращает конфиги всех таблиц запуска: по одному на каждое задание из файла заданий
+// или единственный конфиг из флагов, если файл не задан
+func (c Config) Tables() []Config {
+	if len(c.Jobs) == 0 {
+		return []Config{c}
+	}
+
+	tables := make([]Config, 0, len(c.Jobs))
+	for _, job := range c.Jobs {
+		tables = append(tables, c.withTable(job))
+	}
+
+	return tables
+}
+
+// withTable накладывает задание таблицы на общий конфиг
+func (c Config) withTable(t TableJob) Config {
+	c.Jobs = nil
+
+	c.SrcTable = t.SrcTable
+	c.DstTable = t.SrcTable
+	c.SrcColumns = t.SrcColumns
+	c.DstColumns = t.DstColumns
+	c.ColumnMap = t.Map
+	c.DropColumns = t.Drop
+	c.Transforms = t.Transform
+	c.Redact = t.Redact
+	c.ForeignKeys = t.ForeignKeys
+
+	setString(&c.SrcFilter, t.SrcFilter)
+	setString(&c.SrcNID, t.SrcNID)
+	setString(&c.DstTable, t.DstTable)
+	setString(&c.DstNID, t.DstNID)
+	setString(&c.DstUuid, t.DstUuid)
+	setString(&c.UUIDTZ, t.UUIDTZ)
+	setString(&c.UUIDFormat, t.UUIDFormat)
+	setString(&c.SplitMode, t.SplitMode)
+	setInt(&c.TSColumnIdx, t.TSColumnIdx)
+	setString(&c.TSColumn, t.TSColumn)
+	setInt(&c.ChunkSize, t.ChunkSize)
+	setInt(&c.InsertBatch, t.InsertBatch)
+	setBool(&c.UseInsert, t.UseInsert)
+	setBool(&c.RepairGaps, t.RepairGaps)
+
+	return c
+}
+
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
+
+func setInt(dst *int, v int) {
+	if v != 0 {
+		*dst = v
+	}
+}
+
+func setBool(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
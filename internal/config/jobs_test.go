@@ -0,0 +1,260 @@
+package config
+
+import (
+	"logs-migrator/internal/dbx"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeJobFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoadJobFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		wantErr   string
+		wantCount int
+	}{
+		{
+			name: "valid",
+			content: `{"tables": [
+				{"src_table": "log_auth", "chunk": 50000, "insert": true},
+				{"src_table": "log_api", "dst_table": "api_log", "src_filter": "id % 2 = 0"}
+			]}`,
+			wantCount: 2,
+		},
+		{
+			name:    "unknown field",
+			content: `{"tables": [{"src_table": "log", "chunk_size": 10}]}`,
+			wantErr: "unknown field",
+		},
+		{
+			name: "column mapping",
+			content: `{"tables": [{
+				"src_table": "log",
+				"map": [{"dst": "nid", "src": "id"}, {"dst": "source", "const": "legacy"}, {"dst": "updated_at", "default": true}],
+				"drop": ["debug"],
+				"ts_column": "created_at"
+			}]}`,
+			wantCount: 1,
+		},
+		{
+			name:    "invalid column rule",
+			content: `{"tables": [{"src_table": "log", "map": [{"dst": "nid", "src": "id", "default": true}]}]}`,
+			wantErr: "table log: column rule for nid must set exactly one",
+		},
+		{
+			name: "transforms",
+			content: `{"tables": [{
+				"src_table": "log",
+				"transform": [{"type": "trim", "column": "msg"}, {"type": "truncate", "column": "msg", "params": {"length": 1000}}]
+			}]}`,
+			wantCount: 1,
+		},
+		{
+			name:    "unknown transform",
+			content: `{"tables": [{"src_table": "log", "transform": [{"type": "rot13", "column": "msg"}]}]}`,
+			wantErr: "table log: unknown transform type rot13",
+		},
+		{
+			name: "redact rules",
+			content: `{"tables": [{
+				"src_table": "log",
+				"redact": [{"name": "emails", "column": "msg", "action": "regex", "pattern": "\\S+@\\S+", "replacement": "[email]"}, {"column": "ip", "action": "ip_anonymize"}]
+			}]}`,
+			wantCount: 1,
+		},
+		{
+			name:    "invalid redact rule",
+			content: `{"tables": [{"src_table": "log", "redact": [{"column": "msg", "action": "truncate"}]}]}`,
+			wantErr: "table log: redact rule msg:truncate: truncate needs a positive length",
+		},
+		{
+			name: "foreign keys",
+			content: `{"tables": [
+				{"src_table": "log_tag", "foreign_keys": [{"column": "log_id", "parent": "log", "on_orphan": "null"}]},
+				{"src_table": "log"}
+			]}`,
+			wantCount: 2,
+		},
+		{
+			name:    "foreign key to unknown table",
+			content: `{"tables": [{"src_table": "log_tag", "foreign_keys": [{"column": "log_id", "parent": "log"}]}]}`,
+			wantErr: "parent table log is not in the job file",
+		},
+		{
+			name:    "invalid orphan action",
+			content: `{"tables": [{"src_table": "log"}, {"src_table": "log_tag", "foreign_keys": [{"column": "log_id", "parent": "log", "on_orphan": "drop"}]}]}`,
+			wantErr: `table log_tag: foreign key log_id: unknown on_orphan "drop"`,
+		},
+		{
+			name: "foreign key cycle",
+			content: `{"tables": [
+				{"src_table": "a", "foreign_keys": [{"column": "b_id", "parent": "b"}]},
+				{"src_table": "b", "foreign_keys": [{"column": "a_id", "parent": "a"}]}
+			]}`,
+			wantErr: "foreign keys form a cycle",
+		},
+		{
+			name:    "no tables",
+			content: `{"tables": []}`,
+			wantErr: "has no tables",
+		},
+		{
+			name:    "missing src table",
+			content: `{"tables": [{"dst_table": "log"}]}`,
+			wantErr: "has no src_table",
+		},
+		{
+			name:    "same destination twice",
+			content: `{"tables": [{"src_table": "log"}, {"src_table": "log_old", "dst_table": "log"}]}`,
+			wantErr: "both write to log",
+		},
+		{
+			name:    "invalid json",
+			content: `{"tables": [`,
+			wantErr: "parse job file",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs, err := LoadJobFile(writeJobFile(t, tt.content))
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadJobFile() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadJobFile() error = %v", err)
+			}
+			if len(jobs) != tt.wantCount {
+				t.Errorf("got %d jobs, want %d", len(jobs), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestConfig_Tables(t *testing.T) {
+	insert := true
+	base := Config{
+		SrcTable:    "log",
+		SrcNID:      "id",
+		DstTable:    "log",
+		DstNID:      "nid",
+		DstUuid:     "id",
+		TSColumnIdx: 2,
+		UUIDTZ:      "UTC",
+		ChunkSize:   100_000,
+		SplitMode:   SplitUniform,
+		InsertBatch: 1000,
+	}
+
+	t.Run("without job file", func(t *testing.T) {
+		tables := base.Tables()
+		if len(tables) != 1 || !reflect.DeepEqual(tables[0], base) {
+			t.Errorf("Tables() = %+v, want single base config", tables)
+		}
+	})
+
+	t.Run("job overrides", func(t *testing.T) {
+		cfg := base
+		cfg.Jobs = []TableJob{
+			{SrcTable: "log_auth"},
+			{
+				SrcTable:   "log_api",
+				DstTable:   "api_log",
+				SrcFilter:  "id > 10",
+				SrcColumns: []string{"id", "ins_ts"},
+				Map:        []dbx.ColumnRule{{Dst: "nid", Src: "id"}},
+				Drop:       []string{"debug"},
+				TSColumn:   "ins_ts",
+				ChunkSize:  5000,
+				SplitMode:  SplitDensity,
+				UseInsert:  &insert,
+			},
+		}
+
+		tables := cfg.Tables()
+		if len(tables) != 2 {
+			t.Fatalf("Tables() returned %d configs, want 2", len(tables))
+		}
+
+		auth := tables[0]
+		if auth.SrcTable != "log_auth" || auth.DstTable != "log_auth" || auth.ChunkSize != 100_000 || auth.UseInsert {
+			t.Errorf("log_auth config = %+v", auth)
+		}
+
+		api := tables[1]
+		if api.DstTable != "api_log" || api.SrcFilter != "id > 10" || api.ChunkSize != 5000 || api.SplitMode != SplitDensity || !api.UseInsert {
+			t.Errorf("log_api config = %+v", api)
+		}
+		if !reflect.DeepEqual(api.SrcColumns, []string{"id", "ins_ts"}) {
+			t.Errorf("SrcColumns = %v", api.SrcColumns)
+		}
+		if len(api.ColumnMap) != 1 || !reflect.DeepEqual(api.DropColumns, []string{"debug"}) || api.TSColumn != "ins_ts" {
+			t.Errorf("column mapping = %+v, drop = %v, ts column = %q", api.ColumnMap, api.DropColumns, api.TSColumn)
+		}
+		if auth.ColumnMap != nil || auth.TSColumn != "" {
+			t.Errorf("log_auth must not inherit column mapping, got %+v", auth.ColumnMap)
+		}
+		if api.Jobs != nil {
+			t.Errorf("table config must not carry jobs, got %d", len(api.Jobs))
+		}
+	})
+
+	t.Run("src filter flag is a default", func(t *testing.T) {
+		cfg := base
+		cfg.SrcFilter = "tenant_id = 1"
+		cfg.Jobs = []TableJob{
+			{SrcTable: "log_auth"},
+			{SrcTable: "log_api", SrcFilter: "id > 10"},
+		}
+
+		tables := cfg.Tables()
+		if got := tables[0].SrcFilter; got != "tenant_id = 1" {
+			t.Errorf("log_auth SrcFilter = %q, want flag filter", got)
+		}
+		if got := tables[1].SrcFilter; got != "id > 10" {
+			t.Errorf("log_api SrcFilter = %q, want job filter", got)
+		}
+	})
+}
+
+func TestTableWaves(t *testing.T) {
+	fk := func(parent string) []ForeignKey { return []ForeignKey{{Column: parent + "_id", Parent: parent}} }
+
+	jobs := []TableJob{
+		{SrcTable: "log_attachment", ForeignKeys: fk("log")},
+		{SrcTable: "log"},
+		{SrcTable: "attachment_meta", ForeignKeys: fk("log_attachment")},
+		{SrcTable: "log_tag", ForeignKeys: fk("log")},
+		{SrcTable: "audit"},
+	}
+
+	waves, err := TableWaves(jobs)
+	if err != nil {
+		t.Fatalf("TableWaves() error = %v", err)
+	}
+	if want := [][]int{{1, 4}, {0, 3}, {2}}; !reflect.DeepEqual(waves, want) {
+		t.Errorf("TableWaves() = %v, want %v", waves, want)
+	}
+
+	if _, err := TableWaves([]TableJob{{SrcTable: "log", ForeignKeys: fk("log")}}); err == nil {
+		t.Error("TableWaves() with self reference error = nil")
+	}
+}
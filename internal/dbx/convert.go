@@ -0,0 +1,139 @@
+package dbx
+
+import (
+	"fmt"
+	"logs-migrator/internal/uuidv7"
+	"strings"
+)
+
+// loadExpr возвращает SQL-выражение, которое превращает поле CSV ref (@переменная или ?) в значение колонки
+// типа t. Пустое поле - NULL. Без типа значение загружается строкой и MySQL приводит его сам
+func loadExpr(t *ColumnInfo, ref string) string {
+	value := fmt.Sprintf("NULLIF(%s,'')", ref)
+	if t == nil {
+		return value
+	}
+
+	switch t.DataType {
+	case "datetime", "timestamp":
+		// CAST разбирает и дробную часть секунд, STR_TO_DATE без %f ее бы отбросил
+		return fmt.Sprintf("CAST(%s AS DATETIME%s)", value, fsp(t.DatetimePrecision))
+	case "time":
+		return fmt.Sprintf("CAST(%s AS TIME%s)", value, fsp(t.DatetimePrecision))
+	case "date":
+		return fmt.Sprintf("CAST(%s AS DATE)", value)
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		// Бинарные значения выгружаются в CSV в hex (см. selectExpr): сырые байты ломают разбор CSV
+		return fmt.Sprintf("UNHEX(%s)", value)
+	case "bit":
+		return fmt.Sprintf("CAST(CONV(%s,16,10) AS UNSIGNED)", value)
+	case "json":
+		return fmt.Sprintf("CAST(%s AS JSON)", value)
+	case "decimal", "numeric":
+		return fmt.Sprintf("CAST(%s AS DECIMAL(%d,%d))", value, t.NumericPrecision, t.NumericScale)
+	default:
+		// Числа, строки, ENUM и SET: строковое значение MySQL приводит к типу колонки без потерь
+		return value
+	}
+}
+
+// selectExpr оборачивает выражение выгрузки поля, которое загружается в колонку типа t, если значение
+// нужно передать через CSV в hex: бинарные строки и BIT
+func selectExpr(t *ColumnInfo, expr string) string {
+	if t == nil {
+		return expr
+	}
+
+	switch t.DataType {
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		// CAST AS BINARY, чтобы числа выгружались байтами своей строковой записи, а не hex самого числа
+		return fmt.Sprintf("HEX(CAST(%s AS BINARY))", expr)
+	case "bit":
+		return fmt.Sprintf("HEX(%s)", expr)
+	default:
+		return expr
+	}
+}
+
+// uuidLoadExpr возвращает выражение для UUID в формате format: форматы BINARY(16) (binary, swapped) загружаются
+// через UNHEX, строковые (hex, canonical) - как есть
+func uuidLoadExpr(format, ref string) string {
+	switch format {
+	case uuidv7.FormatHex, uuidv7.FormatCanonical:
+		return ref
+	default:
+		return "UNHEX(" + ref + ")"
+	}
+}
+
+// uuidSelectExpr возвращает выражение, которое читает UUID колонки в формате format как 32 hex-символа
+// в нижнем регистре (для swapped - в порядке байт колонки)
+func uuidSelectExpr(format, col string) string {
+	switch format {
+	case uuidv7.FormatHex:
+		return "LOWER(" + col + ")"
+	case uuidv7.FormatCanonical:
+		return "LOWER(REPLACE(" + col + ",'-',''))"
+	default:
+		return "LOWER(HEX(" + col + "))"
+	}
+}
+
+// DetectUUIDFormat определяет формат UUID по типу колонки: BINARY(16) - binary, CHAR(32) - hex,
+// CHAR(36) и тип UUID MariaDB - canonical. Формат swapped по типу не отличить от binary, он задается явно
+func DetectUUIDFormat(c ColumnInfo) (string, error) {
+	switch {
+	case c.DataType == "uuid":
+		return uuidv7.FormatCanonical, nil
+	case isBinary(c) && c.MaxLength == 16:
+		return uuidv7.FormatBinary, nil
+	case isChar(c) && c.MaxLength == 32:
+		return uuidv7.FormatHex, nil
+	case isChar(c) && c.MaxLength >= 36:
+		return uuidv7.FormatCanonical, nil
+	}
+	return "", fmt.Errorf("cannot detect UUID format for column %s %s: set -uuid-format", c.Name, c.ColumnType)
+}
+
+// UUIDFormatFits возвращает true, если колонка может хранить UUID в формате format
+func UUIDFormatFits(format string, c ColumnInfo) bool {
+	switch format {
+	case uuidv7.FormatHex:
+		return isChar(c) && c.MaxLength >= 32
+	case uuidv7.FormatCanonical:
+		return c.DataType == "uuid" || isChar(c) && c.MaxLength >= 36
+	default:
+		return isBinary(c) && c.MaxLength >= 16
+	}
+}
+
+func isBinary(c ColumnInfo) bool {
+	return c.DataType == "binary" || c.DataType == "varbinary"
+}
+
+func isChar(c ColumnInfo) bool {
+	return c.DataType == "char" || c.DataType == "varchar"
+}
+
+// fsp возвращает точность дробной части секунд для CAST: пусто для 0
+func fsp(precision uint64) string {
+	if precision == 0 {
+		return ""
+	}
+	return fmt.Sprintf("(%d)", precision)
+}
+
+// SetTypes проставляет полям соответствия типы колонок целевой таблицы, по которым строятся выражения
+// выгрузки и загрузки. Колонки ищутся по имени без учета регистра
+func (m *ColumnMapping) SetTypes(dst []ColumnInfo) {
+	byName := make(map[string]*ColumnInfo, len(dst))
+	for i := range dst {
+		byName[strings.ToLower(dst[i].Name)] = &dst[i]
+	}
+
+	for i := range m.Fields {
+		if m.Fields[i].Dst != "" {
+			m.Fields[i].Type = byName[strings.ToLower(m.Fields[i].Dst)]
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package dbx
+
+import (
+	"logs-migrator/internal/uuidv7"
+	"strings"
+	"testing"
+)
+
+func TestLoadExpr(t *testing.T) {
+	tests := []struct {
+		name string
+		col  *ColumnInfo
+		want string
+	}{
+		{name: "unknown type", col: nil, want: "NULLIF(@v,'')"},
+		{name: "integer", col: &ColumnInfo{DataType: "bigint"}, want: "NULLIF(@v,'')"},
+		{name: "datetime", col: &ColumnInfo{DataType: "datetime"}, want: "CAST(NULLIF(@v,'') AS DATETIME)"},
+		{name: "timestamp with fractional seconds", col: &ColumnInfo{DataType: "timestamp", DatetimePrecision: 6}, want: "CAST(NULLIF(@v,'') AS DATETIME(6))"},
+		{name: "time", col: &ColumnInfo{DataType: "time", DatetimePrecision: 3}, want: "CAST(NULLIF(@v,'') AS TIME(3))"},
+		{name: "date", col: &ColumnInfo{DataType: "date"}, want: "CAST(NULLIF(@v,'') AS DATE)"},
+		{name: "blob", col: &ColumnInfo{DataType: "blob"}, want: "UNHEX(NULLIF(@v,''))"},
+		{name: "varbinary", col: &ColumnInfo{DataType: "varbinary"}, want: "UNHEX(NULLIF(@v,''))"},
+		{name: "bit", col: &ColumnInfo{DataType: "bit"}, want: "CAST(CONV(NULLIF(@v,''),16,10) AS UNSIGNED)"},
+		{name: "json", col: &ColumnInfo{DataType: "json"}, want: "CAST(NULLIF(@v,'') AS JSON)"},
+		{name: "decimal", col: &ColumnInfo{DataType: "decimal", NumericPrecision: 12, NumericScale: 2}, want: "CAST(NULLIF(@v,'') AS DECIMAL(12,2))"},
+		{name: "enum", col: &ColumnInfo{DataType: "enum"}, want: "NULLIF(@v,'')"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := loadExpr(tt.col, "@v"); got != tt.want {
+				t.Errorf("loadExpr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectExpr(t *testing.T) {
+	tests := []struct {
+		name string
+		col  *ColumnInfo
+		want string
+	}{
+		{name: "unknown type", col: nil, want: "`payload`"},
+		{name: "text", col: &ColumnInfo{DataType: "text"}, want: "`payload`"},
+		{name: "binary", col: &ColumnInfo{DataType: "longblob"}, want: "HEX(CAST(`payload` AS BINARY))"},
+		{name: "bit", col: &ColumnInfo{DataType: "bit"}, want: "HEX(`payload`)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectExpr(tt.col, "`payload`"); got != tt.want {
+				t.Errorf("selectExpr() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumnMapping_SetTypes(t *testing.T) {
+	m := PositionalMapping([]string{"id", "payload", "ins_ts"}, []string{"uuid", "nid", "PAYLOAD"})
+	m.SetTypes([]ColumnInfo{
+		{Name: "uuid", DataType: "binary"},
+		{Name: "nid", DataType: "bigint"},
+		{Name: "payload", DataType: "blob"},
+	})
+
+	if m.Fields[1].Type == nil || m.Fields[1].Type.DataType != "blob" {
+		t.Fatalf("SetTypes() payload type = %+v, want blob", m.Fields[1].Type)
+	}
+	if m.Fields[2].Type != nil {
+		t.Errorf("SetTypes() set type for field without destination: %+v", m.Fields[2].Type)
+	}
+
+	sel := BuildSelectByRange("log", m, "id", "")
+	if want := "SELECT `id`,HEX(CAST(`payload` AS BINARY)),`ins_ts` FROM"; !strings.HasPrefix(sel, want) {
+		t.Errorf("BuildSelectByRange() = %q, want prefix %q", sel, want)
+	}
+
+	insert := BuildInsertSQL("log", "uuid", m, 1)
+	if want := "VALUES (UNHEX(?),NULLIF(?,''),UNHEX(NULLIF(?,'')))"; !strings.HasSuffix(insert, want) {
+		t.Errorf("BuildInsertSQL() = %q, want suffix %q", insert, want)
+	}
+}
+
+func TestDetectUUIDFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		col     ColumnInfo
+		want    string
+		wantErr bool
+	}{
+		{name: "binary(16)", col: ColumnInfo{DataType: "binary", ColumnType: "binary(16)", MaxLength: 16}, want: uuidv7.FormatBinary},
+		{name: "char(32)", col: ColumnInfo{DataType: "char", ColumnType: "char(32)", MaxLength: 32}, want: uuidv7.FormatHex},
+		{name: "char(36)", col: ColumnInfo{DataType: "char", ColumnType: "char(36)", MaxLength: 36}, want: uuidv7.FormatCanonical},
+		{name: "mariadb uuid", col: ColumnInfo{DataType: "uuid", ColumnType: "uuid"}, want: uuidv7.FormatCanonical},
+		{name: "bigint", col: ColumnInfo{DataType: "bigint", ColumnType: "bigint"}, wantErr: true},
+		{name: "binary(8)", col: ColumnInfo{DataType: "binary", ColumnType: "binary(8)", MaxLength: 8}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectUUIDFormat(tt.col)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectUUIDFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DetectUUIDFormat() = %q, want %q", got, tt.want)
+			}
+			if !tt.wantErr && !UUIDFormatFits(got, tt.col) {
+				t.Errorf("UUIDFormatFits(%s, %s) = false for detected format", got, tt.col.ColumnType)
+			}
+		})
+	}
+
+	if UUIDFormatFits(uuidv7.FormatCanonical, ColumnInfo{DataType: "char", MaxLength: 32}) {
+		t.Error("UUIDFormatFits(canonical, char(32)) = true")
+	}
+}
+
+func TestUUIDLoadExpr(t *testing.T) {
+	m := dstMapping([]string{"id", "nid"})
+	for format, want := range map[string]string{
+		"":                     "`id`=UNHEX(@id_hex)",
+		uuidv7.FormatSwapped:   "`id`=UNHEX(@id_hex)",
+		uuidv7.FormatHex:       "`id`=@id_hex",
+		uuidv7.FormatCanonical: "`id`=@id_hex",
+	} {
+		m.UUIDFormat = format
+		if load := BuildLoadDataSQL("/tmp/stage.csv", "log", "id", m, false); !strings.Contains(load, "SET "+want+",") {
+			t.Errorf("format %q: BuildLoadDataSQL() = %q, want %q", format, load, want)
+		}
+	}
+}
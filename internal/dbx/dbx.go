@@ -3,10 +3,13 @@ package dbx
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"logs-migrator/internal/logx"
 	"logs-migrator/internal/util"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,12 +42,12 @@ func MustOpen(dsn string, workers int, enableLocalInfile bool) *sql.DB {
 		} else {
 			dsn += "?allowAllFiles=true"
 		}
-		log.Printf("[DEBUG] LOCAL INFILE enabled in DSN")
+		slog.Debug("LOCAL INFILE enabled in DSN")
 	}
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		log.Fatalf("open db: %v", err)
+		logx.Fatal("open db", "err", err)
 	}
 
 	db.SetMaxOpenConns(workers + 2)
@@ -54,19 +57,36 @@ func MustOpen(dsn string, workers int, enableLocalInfile bool) *sql.DB {
 	return db
 }
 
-func GetSecureFilePriv(ctx context.Context, db *sql.DB) string {
+// SecureFilePriv возвращает значение secure_file_priv. Для NULL или пустого значения возвращает пустую строку
+func SecureFilePriv(ctx context.Context, db *sql.DB) (string, error) {
 	var serverPriv sql.NullString
 
 	row := db.QueryRowContext(ctx, "SELECT @@secure_file_priv")
 	if err := row.Scan(&serverPriv); err != nil {
-		log.Fatalf("read secure_file_priv: %v", err)
+		return "", err
 	}
 
-	if !serverPriv.Valid || strings.TrimSpace(serverPriv.String) == "" {
-		log.Fatalf("secure_file_priv is NULL/empty; configure it in MySQL/MariaDB and restart")
+	if !serverPriv.Valid {
+		return "", nil
 	}
 
-	return strings.TrimSpace(serverPriv.String)
+	return strings.TrimSpace(serverPriv.String), nil
+}
+
+// EstimateRows возвращает оценку количества строк в таблице по статистике INFORMATION_SCHEMA.TABLES
+func EstimateRows(ctx context.Context, db *sql.DB, table string) (uint64, error) {
+	q := `
+		SELECT COALESCE(TABLE_ROWS, 0)
+		FROM INFORMATION_SCHEMA.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+	`
+
+	var rows uint64
+	if err := db.QueryRowContext(ctx, q, table).Scan(&rows); err != nil {
+		return 0, fmt.Errorf("estimate rows for %s: %w", table, err)
+	}
+
+	return rows, nil
 }
 
 func MustMaxPk(ctx context.Context, db *sql.DB, tableName, pkColumnName string) uint64 {
@@ -80,7 +100,7 @@ func MustMaxPk(ctx context.Context, db *sql.DB, tableName, pkColumnName string)
 	var empty uint64 = 0
 
 	if err := db.QueryRowContext(ctx, query).Scan(&nid); err != nil {
-		log.Fatalf("get max numeric id: %v", err)
+		logx.Fatal("get max numeric id", "table", tableName, "err", err)
 	}
 
 	if !nid.Valid {
@@ -93,8 +113,16 @@ func MustMaxPk(ctx context.Context, db *sql.DB, tableName, pkColumnName string)
 }
 
 func MustPKRange(ctx context.Context, db *sql.DB, tableName, pkColumnName, filter string) (uint64, uint64) {
-	var empty uint64 = 0
+	from, to, err := PKRange(ctx, db, tableName, pkColumnName, filter)
+	if err != nil {
+		logx.Fatal("pk range", "table", tableName, "err", err)
+	}
 
+	return from, to
+}
+
+// PKRange возвращает MIN и MAX числового ID строк таблицы, подходящих под фильтр. Для пустой таблицы - нули
+func PKRange(ctx context.Context, db *sql.DB, tableName, pkColumnName, filter string) (uint64, uint64, error) {
 	where := strings.TrimSpace(filter)
 
 	q := fmt.Sprintf(
@@ -111,17 +139,14 @@ func MustPKRange(ctx context.Context, db *sql.DB, tableName, pkColumnName, filte
 	var a, b sql.NullInt64
 
 	if err := db.QueryRowContext(ctx, q).Scan(&a, &b); err != nil {
-		log.Fatalf("pk range: %v", err)
+		return 0, 0, fmt.Errorf("pk range of %s: %w", tableName, err)
 	}
 
 	if !a.Valid || !b.Valid {
-		return empty, empty
+		return 0, 0, nil
 	}
 
-	from := uint64(a.Int64)
-	to := uint64(b.Int64)
-
-	return from, to
+	return uint64(a.Int64), uint64(b.Int64), nil
 }
 
 func MustTableColumns(ctx context.Context, db *sql.DB, table string) []string {
@@ -133,7 +158,7 @@ func MustTableColumns(ctx context.Context, db *sql.DB, table string) []string {
 	`
 	rows, err := db.QueryContext(ctx, q, table)
 	if err != nil {
-		log.Fatalf("get columns for %s: %v\n", table, err)
+		logx.Fatal("get columns", "table", table, "err", err)
 	}
 	defer rows.Close()
 
@@ -142,29 +167,31 @@ func MustTableColumns(ctx context.Context, db *sql.DB, table string) []string {
 	for rows.Next() {
 		var column string
 		if err := rows.Scan(&column); err != nil {
-			log.Fatalf("%v\n", err)
+			logx.Fatal("scan columns", "table", table, "err", err)
 		}
 		columns = append(columns, column)
 	}
 	if err := rows.Err(); err != nil {
-		log.Fatalf("%v\n", err)
+		logx.Fatal("read columns", "table", table, "err", err)
 	}
 
 	if len(columns) == 0 {
-		log.Fatalf("no columns found for %s\n", table)
+		logx.Fatal("no columns found", "table", table)
 	}
 
 	return columns
 }
 
+// BuildSelectByRange генерирует запрос выгрузки диапазона числовых ID (from, to]: колонки и выражения
+// источника в порядке полей соответствия
 func BuildSelectByRange(
 	tableName string,
-	columns []string,
+	m ColumnMapping,
 	pkColumn string,
 	where string,
 ) string {
 	selectColumns := strings.Join(
-		util.IdentAll(columns),
+		m.selectList(),
 		",",
 	)
 
@@ -185,8 +212,176 @@ func BuildSelectByRange(
 	)
 }
 
+// BuildChunkBoundary генерирует запрос, который находит ID строки, на которой после заданного ID набирается
+// нужное количество строк (параметры: after, offset). Запрос идет по индексу первичного ключа
+func BuildChunkBoundary(tableName, pkColumn, where string) string {
+	if strings.TrimSpace(where) != "" {
+		where = " AND (" + where + ")"
+	}
+
+	pkIdent := util.Ident(pkColumn)
+
+	return fmt.Sprintf(
+		"SELECT %s FROM %s WHERE %s > ?%s ORDER BY %s LIMIT ?,1",
+		pkIdent,
+		util.Ident(tableName),
+		pkIdent,
+		where,
+		pkIdent,
+	)
+}
+
+// NextChunkBoundary возвращает ID chunk-й строки после after. ok=false, если после after строк меньше chunk
+func NextChunkBoundary(ctx context.Context, db *sql.DB, tableName, pkColumn, where string, after uint64, chunk int) (uint64, bool, error) {
+	var id uint64
+
+	query := BuildChunkBoundary(tableName, pkColumn, where)
+	err := db.QueryRowContext(ctx, query, after, chunk-1).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("chunk boundary after %d: %w", after, err)
+	}
+
+	return id, true, nil
+}
+
+// BuildDistinctByRange генерирует запрос различных непустых значений колонки в диапазоне числовых ID (from, to]
+func BuildDistinctByRange(tableName, column, pkColumn, where string) string {
+	if strings.TrimSpace(where) != "" {
+		where = " AND (" + where + ")"
+	}
+
+	pkIdent, colIdent := util.Ident(pkColumn), util.Ident(column)
+
+	return fmt.Sprintf(
+		"SELECT DISTINCT %s FROM %s WHERE %s > ? AND %s <= ? AND %s IS NOT NULL%s",
+		colIdent,
+		util.Ident(tableName),
+		pkIdent,
+		pkIdent,
+		colIdent,
+		where,
+	)
+}
+
+// BuildCountByRange генерирует запрос для подсчета строк в диапазоне числовых ID (from, to]
+func BuildCountByRange(tableName, pkColumn, where string) string {
+	if strings.TrimSpace(where) != "" {
+		where = " AND (" + where + ")"
+	}
+
+	pkIdent := util.Ident(pkColumn)
+
+	return fmt.Sprintf(
+		"SELECT COUNT(*) FROM %s WHERE %s > ? AND %s <= ?%s",
+		util.Ident(tableName),
+		pkIdent,
+		pkIdent,
+		where,
+	)
+}
+
+// CountByRange считает строки в диапазоне числовых ID (from, to]
+func CountByRange(ctx context.Context, db *sql.DB, tableName, pkColumn, where string, from, to uint64) (uint64, error) {
+	var count uint64
+
+	query := BuildCountByRange(tableName, pkColumn, where)
+	if err := db.QueryRowContext(ctx, query, from, to).Scan(&count); err != nil {
+		return 0, fmt.Errorf("count %s in (%d, %d]: %w", tableName, from, to, err)
+	}
+
+	return count, nil
+}
+
+// BuildChecksumByRange генерирует запрос, который считает количество строк и не зависящую от порядка строк
+// контрольную сумму колонок в диапазоне числовых ID (from, to]. Сумма CRC32 по строкам не зависит от порядка,
+// а маска ISNULL в конце отличает NULL от пустых значений
+func BuildChecksumByRange(tableName string, columns []string, pkColumn, where string) string {
+	idents := util.IdentAll(columns)
+
+	nullFlags := make([]string, 0, len(idents))
+	for _, col := range idents {
+		nullFlags = append(nullFlags, "ISNULL("+col+")")
+	}
+
+	// Без колонок сверяется только количество строк
+	rowExpr := "0"
+	if len(idents) > 0 {
+		rowExpr = fmt.Sprintf(
+			"CRC32(CONCAT_WS('|',%s,CONCAT(%s)))",
+			strings.Join(idents, ","),
+			strings.Join(nullFlags, ","),
+		)
+	}
+
+	if strings.TrimSpace(where) != "" {
+		where = " AND (" + where + ")"
+	}
+
+	pkIdent := util.Ident(pkColumn)
+
+	return fmt.Sprintf(
+		"SELECT COUNT(*), COALESCE(SUM(%s),0) FROM %s WHERE %s > ? AND %s <= ?%s",
+		rowExpr,
+		util.Ident(tableName),
+		pkIdent,
+		pkIdent,
+		where,
+	)
+}
+
+// ChecksumByRange возвращает количество строк и контрольную сумму колонок в диапазоне числовых ID (from, to]
+func ChecksumByRange(ctx context.Context, db *sql.DB, tableName string, columns []string, pkColumn, where string, from, to uint64) (uint64, uint64, error) {
+	var count, sum uint64
+
+	query := BuildChecksumByRange(tableName, columns, pkColumn, where)
+	if err := db.QueryRowContext(ctx, query, from, to).Scan(&count, &sum); err != nil {
+		return 0, 0, fmt.Errorf("checksum %s in (%d, %d]: %w", tableName, from, to, err)
+	}
+
+	return count, sum, nil
+}
+
+// BuildDeleteByRange генерирует запрос для удаления строк в диапазоне числовых ID (from, to]
+func BuildDeleteByRange(tableName, pkColumn string) string {
+	pkIdent := util.Ident(pkColumn)
+
+	return fmt.Sprintf(
+		"DELETE FROM %s WHERE %s > ? AND %s <= ?",
+		util.Ident(tableName),
+		pkIdent,
+		pkIdent,
+	)
+}
+
+// BuildDeleteByIDs генерирует запрос для удаления строк по n значениям числового ID
+func BuildDeleteByIDs(tableName, pkColumn string, n int) string {
+	return fmt.Sprintf(
+		"DELETE FROM %s WHERE %s IN (%s)",
+		util.Ident(tableName),
+		util.Ident(pkColumn),
+		strings.TrimSuffix(strings.Repeat("?,", n), ","),
+	)
+}
+
+// IDsFilter генерирует условие на значения числового ID для параметра where запросов Build*ByRange.
+// Числа подставляются в текст запроса, пустой список не пропускает ни одной строки
+func IDsFilter(pkColumn string, ids []uint64) string {
+	if len(ids) == 0 {
+		return "FALSE"
+	}
+
+	list := make([]string, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, strconv.FormatUint(id, 10))
+	}
+	return util.Ident(pkColumn) + " IN (" + strings.Join(list, ",") + ")"
+}
+
 func EnableFastLoad(ctx context.Context, db *sql.DB, bufferPoolSize uint64, ioCapacity, ioCapacityMax int) *OriginalSettings {
-	log.Printf("[INFO] Enabling fast-load")
+	slog.Info("enabling fast-load")
 
 	// Сохраняем оригинальные значения
 	orig := &OriginalSettings{}
@@ -198,38 +393,56 @@ func EnableFastLoad(ctx context.Context, db *sql.DB, bufferPoolSize uint64, ioCa
 	orig.InnodbIOCapacityMax = getGlobalInt(ctx, db, "innodb_io_capacity_max")
 	orig.InnodbBufferPoolSize = getGlobalUint64(ctx, db, "innodb_buffer_pool_size")
 
-	log.Printf("[DEBUG] Original settings saved: unique_checks=%d, foreign_key_checks=%d, innodb_flush_log_at_trx_commit=%d, sync_binlog=%d, innodb_io_capacity=%d, innodb_io_capacity_max=%d, innodb_buffer_pool_size=%d",
-		orig.UniqueChecks, orig.ForeignKeyChecks, orig.InnodbFlushLogAtTrxCommit, orig.SyncBinlog, orig.InnodbIOCapacity, orig.InnodbIOCapacityMax, orig.InnodbBufferPoolSize)
+	slog.Debug("original settings saved",
+		"unique_checks", orig.UniqueChecks,
+		"foreign_key_checks", orig.ForeignKeyChecks,
+		"innodb_flush_log_at_trx_commit", orig.InnodbFlushLogAtTrxCommit,
+		"sync_binlog", orig.SyncBinlog,
+		"innodb_io_capacity", orig.InnodbIOCapacity,
+		"innodb_io_capacity_max", orig.InnodbIOCapacityMax,
+		"innodb_buffer_pool_size", orig.InnodbBufferPoolSize,
+	)
 
 	// Применяем оптимизации
-	logExec(ctx, db, "SET GLOBAL unique_checks = 0")
-	logExec(ctx, db, "SET GLOBAL foreign_key_checks = 0")
-	logExec(ctx, db, "SET GLOBAL innodb_flush_log_at_trx_commit = 2")
-	logExec(ctx, db, "SET GLOBAL sync_binlog = 0")
+	for _, query := range FastLoadStatements(bufferPoolSize, ioCapacity, ioCapacityMax) {
+		logExec(ctx, db, query)
+	}
+
+	slog.Info("fast-load enabled")
+	return orig
+}
+
+// FastLoadStatements возвращает список запросов, которые выполняет EnableFastLoad
+func FastLoadStatements(bufferPoolSize uint64, ioCapacity, ioCapacityMax int) []string {
+	statements := []string{
+		"SET GLOBAL unique_checks = 0",
+		"SET GLOBAL foreign_key_checks = 0",
+		"SET GLOBAL innodb_flush_log_at_trx_commit = 2",
+		"SET GLOBAL sync_binlog = 0",
+	}
 
 	// Применяем пользовательские настройки InnoDB если указаны
 	if bufferPoolSize > 0 {
-		logExec(ctx, db, fmt.Sprintf("SET GLOBAL innodb_buffer_pool_size = %d", bufferPoolSize))
+		statements = append(statements, fmt.Sprintf("SET GLOBAL innodb_buffer_pool_size = %d", bufferPoolSize))
 	}
 	if ioCapacity > 0 {
-		logExec(ctx, db, fmt.Sprintf("SET GLOBAL innodb_io_capacity = %d", ioCapacity))
+		statements = append(statements, fmt.Sprintf("SET GLOBAL innodb_io_capacity = %d", ioCapacity))
 	}
 	if ioCapacityMax > 0 {
-		logExec(ctx, db, fmt.Sprintf("SET GLOBAL innodb_io_capacity_max = %d", ioCapacityMax))
+		statements = append(statements, fmt.Sprintf("SET GLOBAL innodb_io_capacity_max = %d", ioCapacityMax))
 	}
 
 	// Отключаем REDO LOG
-	logExec(ctx, db, "ALTER INSTANCE DISABLE INNODB REDO_LOG")
+	statements = append(statements, "ALTER INSTANCE DISABLE INNODB REDO_LOG")
 
-	log.Printf("[INFO] fast-load enabled")
-	return orig
+	return statements
 }
 
 func DisableFastLoad(db *sql.DB, orig *OriginalSettings) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
 
-	log.Printf("[INFO] Disabling fast-load and restoring original settings")
+	slog.Info("disabling fast-load and restoring original settings")
 
 	// Включаем REDO LOG
 	logExec(ctx, db, "ALTER INSTANCE ENABLE INNODB REDO_LOG")
@@ -243,14 +456,14 @@ func DisableFastLoad(db *sql.DB, orig *OriginalSettings) {
 	logExec(ctx, db, fmt.Sprintf("SET GLOBAL unique_checks = %d", orig.UniqueChecks))
 	logExec(ctx, db, fmt.Sprintf("SET GLOBAL foreign_key_checks = %d", orig.ForeignKeyChecks))
 
-	log.Printf("[INFO] fast-load disabled (original settings restored)")
+	slog.Info("fast-load disabled, original settings restored")
 }
 
 func logExec(ctx context.Context, db *sql.DB, query string) {
 	if _, err := db.ExecContext(ctx, query); err != nil {
-		log.Printf("[WARN] fast-load: %s -> %v", strings.TrimSpace(query), err)
+		slog.Warn("fast-load statement failed", "query", strings.TrimSpace(query), "err", err)
 	} else {
-		log.Printf("[DEBUG] fast-load applied: %s", strings.TrimSpace(query))
+		slog.Debug("fast-load applied", "query", strings.TrimSpace(query))
 	}
 }
 
@@ -258,7 +471,7 @@ func getGlobalInt(ctx context.Context, db *sql.DB, varName string) int {
 	var val int
 	query := fmt.Sprintf("SELECT @@GLOBAL.%s", varName)
 	if err := db.QueryRowContext(ctx, query).Scan(&val); err != nil {
-		log.Printf("[WARN] failed to read %s: %v, using default 1", varName, err)
+		slog.Warn("failed to read global variable, using default", "variable", varName, "default", 1, "err", err)
 		return 1
 	}
 	return val
@@ -268,38 +481,43 @@ func getGlobalUint64(ctx context.Context, db *sql.DB, varName string) uint64 {
 	var val uint64
 	query := fmt.Sprintf("SELECT @@GLOBAL.%s", varName)
 	if err := db.QueryRowContext(ctx, query).Scan(&val); err != nil {
-		log.Printf("[WARN] failed to read %s: %v, using default 0", varName, err)
+		slog.Warn("failed to read global variable, using default", "variable", varName, "default", 0, "err", err)
 		return 0
 	}
 	return val
 }
 
-// BuildLoadDataSQL генерирует LOAD DATA INFILE SQL для файловой загрузки в БД
-func BuildLoadDataSQL(stagedPath, dstTable, uuidCol string, columns []string, useLocal bool) string {
-	if len(columns) == 0 {
+// BuildLoadDataSQL генерирует LOAD DATA INFILE SQL для файловой загрузки в БД. Поля CSV: UUID, затем поля
+// соответствия; поля без целевой колонки читаются в @dummy
+func BuildLoadDataSQL(stagedPath, dstTable, uuidCol string, m ColumnMapping, useLocal bool) string {
+	if len(m.Fields) == 0 {
 		return ""
 	}
 
-	// CSV переменные: @id_hex для UUID
-	vars := make([]string, 0, len(columns))
+	// CSV переменные: @id_hex для UUID (в формате m.UUIDFormat)
+	vars := make([]string, 0, len(m.Fields)+1)
 	vars = append(vars, "@id_hex")
-	for i := 1; i < len(columns); i++ {
-		vars = append(vars, "@"+columns[i])
-	}
-
-	// Преобразовать шестнадцатеричный UUID в BINARY(16), обработать временные метки (timestamps) и значения NULL
-	setClauses := []string{util.Ident(uuidCol) + "=UNHEX(@id_hex)"}
-	for i := 1; i < len(columns); i++ {
-		col := columns[i]
-		if strings.EqualFold(col, "ins_ts") {
-			setClauses = append(setClauses,
-				fmt.Sprintf("%s=STR_TO_DATE(@%s,'%%Y-%%m-%%d %%H:%%i:%%s')", util.Ident(col), col))
+	for _, f := range m.Fields {
+		if f.Dst == "" {
+			vars = append(vars, "@dummy")
 		} else {
-			setClauses = append(setClauses,
-				fmt.Sprintf("%s=NULLIF(@%s,'')", util.Ident(col), col))
+			vars = append(vars, "@"+f.Dst)
 		}
 	}
 
+	// Преобразовать UUID по его формату, остальные поля - по типам колонок целевой таблицы
+	refs := make([]string, 0, len(vars))
+	refs = append(refs, vars[0])
+	for _, i := range m.Loaded() {
+		refs = append(refs, vars[i+1])
+	}
+	dstColumns := loadTargetColumns(uuidCol, m)
+	exprs := loadValueExprs(m, refs)
+	setClauses := make([]string, 0, len(dstColumns))
+	for i := range dstColumns {
+		setClauses = append(setClauses, util.Ident(dstColumns[i])+"="+exprs[i])
+	}
+
 	// Экранируем путь к файлу
 	file := strings.ReplaceAll(stagedPath, `\`, `\\`)
 	file = strings.ReplaceAll(file, `'`, `\'`)
@@ -325,6 +543,85 @@ func BuildLoadDataSQL(stagedPath, dstTable, uuidCol string, columns []string, us
 	)
 }
 
+// BuildInsertSQL генерирует multi-row INSERT на rows строк. Значения передаются плейсхолдерами: UUID и загружаемые
+// поля CSV по порядку (см. ColumnMapping.Loaded), и преобразуются теми же выражениями, что и в LOAD DATA
+func BuildInsertSQL(dstTable, uuidCol string, m ColumnMapping, rows int) string {
+	if len(m.Fields) == 0 || rows < 1 {
+		return ""
+	}
+
+	placeholders := make([]string, len(m.Loaded())+1)
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+
+	tuple := "(" + strings.Join(loadValueExprs(m, placeholders), ",") + ")"
+	tuples := make([]string, rows)
+	for i := range tuples {
+		tuples[i] = tuple
+	}
+
+	return fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES %s",
+		util.Ident(dstTable),
+		strings.Join(util.IdentAll(loadTargetColumns(uuidCol, m)), ","),
+		strings.Join(tuples, ","),
+	)
+}
+
+// loadTargetColumns возвращает колонки целевой таблицы в порядке загрузки: UUID-колонка, колонки загружаемых
+// полей CSV, колонки-константы
+func loadTargetColumns(uuidCol string, m ColumnMapping) []string {
+	out := make([]string, 0, len(m.Fields)+len(m.Consts)+1)
+	out = append(out, uuidCol)
+	for _, i := range m.Loaded() {
+		out = append(out, m.Fields[i].Dst)
+	}
+	for _, c := range m.Consts {
+		out = append(out, c.Dst)
+	}
+	return out
+}
+
+// loadValueExprs возвращает SQL-выражения, которые превращают поле CSV в значение колонки по ее типу (см. loadExpr),
+// в порядке loadTargetColumns. refs - ссылки на UUID и загружаемые поля CSV (@переменные для LOAD DATA или ? для INSERT)
+func loadValueExprs(m ColumnMapping, refs []string) []string {
+	exprs := make([]string, 0, len(refs)+len(m.Consts))
+	exprs = append(exprs, uuidLoadExpr(m.UUIDFormat, refs[0]))
+	for n, i := range m.Loaded() {
+		exprs = append(exprs, loadExpr(m.Fields[i].Type, refs[n+1]))
+	}
+	for _, c := range m.Consts {
+		exprs = append(exprs, util.Quote(c.Value))
+	}
+	return exprs
+}
+
+// BuildUUIDLookup генерирует запрос, который читает nid и UUID строк целевой таблицы по n значениям nid или,
+// если byUUID, по n значениям UUID в формате format. UUID возвращается как 32 hex-символа (см. uuidSelectExpr)
+func BuildUUIDLookup(tableName, nidCol, uuidCol, format string, byUUID bool, n int) string {
+	nidIdent, uuidIdent := util.Ident(nidCol), util.Ident(uuidCol)
+
+	key, ref := nidIdent, "?"
+	if byUUID {
+		key, ref = uuidIdent, uuidLoadExpr(format, "?")
+	}
+	refs := make([]string, n)
+	for i := range refs {
+		refs[i] = ref
+	}
+
+	return fmt.Sprintf(
+		"SELECT %s, %s FROM %s WHERE %s IN (%s) ORDER BY %s",
+		nidIdent,
+		uuidSelectExpr(format, uuidIdent),
+		util.Ident(tableName),
+		key,
+		strings.Join(refs, ","),
+		nidIdent,
+	)
+}
+
 // ValidateWhereClause проверяем есть ли в фильтре потенциальные SQL-инъекции
 func ValidateWhereClause(where string) error {
 	if strings.TrimSpace(where) == "" {
@@ -1,6 +1,8 @@
 package dbx
 
 import (
+	"logs-migrator/internal/uuidv7"
+	"strings"
 	"testing"
 )
 
@@ -162,7 +164,7 @@ func TestBuildSelectByRange(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := BuildSelectByRange(tt.tableName, tt.columns, tt.pkColumn, tt.where)
+			result := BuildSelectByRange(tt.tableName, PositionalMapping(tt.columns, nil), tt.pkColumn, tt.where)
 			if result != tt.expected {
 				t.Errorf("BuildSelectByRange() = %q, want %q", result, tt.expected)
 			}
@@ -170,6 +172,220 @@ func TestBuildSelectByRange(t *testing.T) {
 	}
 }
 
+func TestBuildChunkBoundary(t *testing.T) {
+	tests := []struct {
+		name     string
+		where    string
+		expected string
+	}{
+		{
+			name:     "without where",
+			where:    "",
+			expected: "SELECT `id` FROM `log` WHERE `id` > ? ORDER BY `id` LIMIT ?,1",
+		},
+		{
+			name:     "with where clause",
+			where:    "id % 100 = 0",
+			expected: "SELECT `id` FROM `log` WHERE `id` > ? AND (id % 100 = 0) ORDER BY `id` LIMIT ?,1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := BuildChunkBoundary("log", "id", tt.where)
+			if result != tt.expected {
+				t.Errorf("BuildChunkBoundary() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildCountByRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		tableName string
+		pkColumn  string
+		where     string
+		expected  string
+	}{
+		{
+			name:      "without where",
+			tableName: "log",
+			pkColumn:  "id",
+			where:     "",
+			expected:  "SELECT COUNT(*) FROM `log` WHERE `id` > ? AND `id` <= ?",
+		},
+		{
+			name:      "with where clause",
+			tableName: "log",
+			pkColumn:  "nid",
+			where:     "id % 100 = 0",
+			expected:  "SELECT COUNT(*) FROM `log` WHERE `nid` > ? AND `nid` <= ? AND (id % 100 = 0)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := BuildCountByRange(tt.tableName, tt.pkColumn, tt.where)
+			if result != tt.expected {
+				t.Errorf("BuildCountByRange() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildDistinctByRange(t *testing.T) {
+	got := BuildDistinctByRange("log_tag", "log_id", "id", "id % 2 = 0")
+	want := "SELECT DISTINCT `log_id` FROM `log_tag` WHERE `id` > ? AND `id` <= ? AND `log_id` IS NOT NULL AND (id % 2 = 0)"
+	if got != want {
+		t.Errorf("BuildDistinctByRange() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildChecksumByRange(t *testing.T) {
+	tests := []struct {
+		name      string
+		tableName string
+		columns   []string
+		pkColumn  string
+		where     string
+		expected  string
+	}{
+		{
+			name:      "without where",
+			tableName: "log",
+			columns:   []string{"id", "msg"},
+			pkColumn:  "id",
+			where:     "",
+			expected:  "SELECT COUNT(*), COALESCE(SUM(CRC32(CONCAT_WS('|',`id`,`msg`,CONCAT(ISNULL(`id`),ISNULL(`msg`))))),0) FROM `log` WHERE `id` > ? AND `id` <= ?",
+		},
+		{
+			name:      "with where clause",
+			tableName: "log",
+			columns:   []string{"nid"},
+			pkColumn:  "nid",
+			where:     "id % 100 = 0",
+			expected:  "SELECT COUNT(*), COALESCE(SUM(CRC32(CONCAT_WS('|',`nid`,CONCAT(ISNULL(`nid`))))),0) FROM `log` WHERE `nid` > ? AND `nid` <= ? AND (id % 100 = 0)",
+		},
+		{
+			name:      "count only without columns",
+			tableName: "log",
+			pkColumn:  "nid",
+			expected:  "SELECT COUNT(*), COALESCE(SUM(0),0) FROM `log` WHERE `nid` > ? AND `nid` <= ?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := BuildChecksumByRange(tt.tableName, tt.columns, tt.pkColumn, tt.where)
+			if result != tt.expected {
+				t.Errorf("BuildChecksumByRange() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildDeleteByRange(t *testing.T) {
+	expected := "DELETE FROM `log` WHERE `nid` > ? AND `nid` <= ?"
+	if result := BuildDeleteByRange("log", "nid"); result != expected {
+		t.Errorf("BuildDeleteByRange() = %q, want %q", result, expected)
+	}
+}
+
+func TestBuildDeleteByIDs(t *testing.T) {
+	expected := "DELETE FROM `log` WHERE `nid` IN (?,?,?)"
+	if result := BuildDeleteByIDs("log", "nid", 3); result != expected {
+		t.Errorf("BuildDeleteByIDs() = %q, want %q", result, expected)
+	}
+}
+
+func TestIDsFilter(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  []uint64
+		want string
+	}{
+		{"empty", nil, "FALSE"},
+		{"single", []uint64{7}, "`nid` IN (7)"},
+		{"several", []uint64{1, 20, 18446744073709551615}, "`nid` IN (1,20,18446744073709551615)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IDsFilter("nid", tt.ids); got != tt.want {
+				t.Errorf("IDsFilter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildUUIDLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		byUUID bool
+		want   string
+	}{
+		{
+			name:   "binary by nid",
+			format: uuidv7.FormatBinary,
+			want:   "SELECT `nid`, LOWER(HEX(`id`)) FROM `log` WHERE `nid` IN (?,?) ORDER BY `nid`",
+		},
+		{
+			name:   "binary by uuid",
+			format: uuidv7.FormatBinary,
+			byUUID: true,
+			want:   "SELECT `nid`, LOWER(HEX(`id`)) FROM `log` WHERE `id` IN (UNHEX(?),UNHEX(?)) ORDER BY `nid`",
+		},
+		{
+			name:   "canonical by uuid",
+			format: uuidv7.FormatCanonical,
+			byUUID: true,
+			want:   "SELECT `nid`, LOWER(REPLACE(`id`,'-','')) FROM `log` WHERE `id` IN (?,?) ORDER BY `nid`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := BuildUUIDLookup("log", "nid", "id", tt.format, tt.byUUID, 2); got != tt.want {
+				t.Errorf("BuildUUIDLookup() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFastLoadStatements(t *testing.T) {
+	t.Run("without InnoDB overrides", func(t *testing.T) {
+		statements := FastLoadStatements(0, 0, 0)
+		if len(statements) != 5 {
+			t.Fatalf("FastLoadStatements() returned %d statements, want 5: %v", len(statements), statements)
+		}
+		if statements[len(statements)-1] != "ALTER INSTANCE DISABLE INNODB REDO_LOG" {
+			t.Errorf("last statement = %q, want REDO_LOG disable", statements[len(statements)-1])
+		}
+	})
+
+	t.Run("with InnoDB overrides", func(t *testing.T) {
+		statements := FastLoadStatements(1024, 2000, 4000)
+		want := []string{
+			"SET GLOBAL innodb_buffer_pool_size = 1024",
+			"SET GLOBAL innodb_io_capacity = 2000",
+			"SET GLOBAL innodb_io_capacity_max = 4000",
+		}
+		for _, w := range want {
+			found := false
+			for _, s := range statements {
+				if s == w {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("FastLoadStatements() missing %q", w)
+			}
+		}
+	})
+}
+
 func TestBuildLoadDataSQL(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -211,7 +427,7 @@ func TestBuildLoadDataSQL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			result := BuildLoadDataSQL(tt.stagedPath, tt.dstTable, tt.uuidCol, tt.columns, tt.useLocal)
+			result := BuildLoadDataSQL(tt.stagedPath, tt.dstTable, tt.uuidCol, dstMapping(tt.columns), tt.useLocal)
 
 			if tt.wantPrefix == "" {
 				if result != "" {
@@ -231,3 +447,67 @@ func TestBuildLoadDataSQL(t *testing.T) {
 		})
 	}
 }
+
+func TestBuildLoadDataSQLSetClauses(t *testing.T) {
+	m := dstMapping([]string{"id", "nid", "ins_ts", "user_id"})
+	m.SetTypes([]ColumnInfo{
+		{Name: "nid", DataType: "bigint"},
+		{Name: "ins_ts", DataType: "datetime"},
+		{Name: "user_id", DataType: "int"},
+	})
+	result := BuildLoadDataSQL("/tmp/stage.csv", "log", "id", m, false)
+
+	want := "SET `id`=UNHEX(@id_hex), `nid`=NULLIF(@nid,''), `ins_ts`=CAST(NULLIF(@ins_ts,'') AS DATETIME), `user_id`=NULLIF(@user_id,'')"
+	if !strings.HasSuffix(result, want) {
+		t.Errorf("BuildLoadDataSQL() = %q, want suffix %q", result, want)
+	}
+
+	if !strings.Contains(result, "(@id_hex,@nid,@ins_ts,@user_id)") {
+		t.Errorf("BuildLoadDataSQL() = %q, want variables list", result)
+	}
+}
+
+func TestBuildInsertSQL(t *testing.T) {
+	tests := []struct {
+		name     string
+		columns  []string
+		rows     int
+		expected string
+	}{
+		{
+			name:     "single row",
+			columns:  []string{"id", "nid", "ins_ts"},
+			rows:     1,
+			expected: "INSERT INTO `log` (`id`,`nid`,`ins_ts`) VALUES (UNHEX(?),NULLIF(?,''),NULLIF(?,''))",
+		},
+		{
+			name:     "multiple rows",
+			columns:  []string{"id", "nid"},
+			rows:     2,
+			expected: "INSERT INTO `log` (`id`,`nid`) VALUES (UNHEX(?),NULLIF(?,'')),(UNHEX(?),NULLIF(?,''))",
+		},
+		{
+			name:     "empty columns",
+			columns:  []string{},
+			rows:     1,
+			expected: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := BuildInsertSQL("log", "id", dstMapping(tt.columns), tt.rows)
+			if result != tt.expected {
+				t.Errorf("BuildInsertSQL() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
+// dstMapping возвращает соответствие, при котором колонки источника называются так же, как колонки целевой таблицы
+func dstMapping(columns []string) ColumnMapping {
+	if len(columns) == 0 {
+		return ColumnMapping{}
+	}
+	return PositionalMapping(columns[1:], columns)
+}
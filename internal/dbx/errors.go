@@ -0,0 +1,41 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Коды ошибок MySQL, после которых операцию имеет смысл повторить
+var transientErrorCodes = map[uint16]struct{}{
+	1205: {}, // ER_LOCK_WAIT_TIMEOUT
+	1213: {}, // ER_LOCK_DEADLOCK
+	2006: {}, // CR_SERVER_GONE_ERROR
+	2013: {}, // CR_SERVER_LOST
+}
+
+// IsTransient сообщает, что ошибка временная: дедлок, таймаут ожидания блокировки, потеря соединения
+// или сетевой таймаут. Остальные ошибки (синтаксис, схема, данные, отмена контекста, прочие сетевые ошибки
+// и голый EOF) считаются фатальными
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		_, ok := transientErrorCodes[myErr.Number]
+		return ok
+	}
+
+	// Соединение, на котором запрос не отправлялся, драйвер возвращает без кода ошибки MySQL
+	if errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,48 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"deadlock", &mysql.MySQLError{Number: 1213, Message: "Deadlock found"}, true},
+		{"lock wait timeout", &mysql.MySQLError{Number: 1205}, true},
+		{"server gone", &mysql.MySQLError{Number: 2006}, true},
+		{"server lost", &mysql.MySQLError{Number: 2013}, true},
+		{"wrapped deadlock", fmt.Errorf("load: %w", &mysql.MySQLError{Number: 1213}), true},
+		{"syntax error", &mysql.MySQLError{Number: 1064}, false},
+		{"unknown column", &mysql.MySQLError{Number: 1054}, false},
+		{"bad conn", driver.ErrBadConn, true},
+		{"too many connections", &mysql.MySQLError{Number: 1040}, false},
+		{"invalid conn", fmt.Errorf("query error: %w", mysql.ErrInvalidConn), false},
+		{"eof", io.EOF, false},
+		{"unexpected eof", io.ErrUnexpectedEOF, false},
+		{"net error", &net.OpError{Op: "read", Err: fmt.Errorf("connection reset by peer")}, false},
+		{"net timeout", &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, true},
+		{"canceled", context.Canceled, false},
+		{"deadline", fmt.Errorf("load: %w", context.DeadlineExceeded), false},
+		{"plain error", fmt.Errorf("destination table has no columns"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.want {
+				t.Errorf("IsTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
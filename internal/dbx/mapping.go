@@ -0,0 +1,254 @@
+package dbx
+
+import (
+	"errors"
+	"fmt"
+	"logs-migrator/internal/util"
+	"strings"
+)
+
+// ColumnRule правило для одной колонки целевой таблицы. Значение колонки берется ровно из одного источника:
+// колонки источника, SQL-выражения над колонками источника, константы или значения по умолчанию
+type ColumnRule struct {
+	Dst     string  `json:"dst"`
+	Src     string  `json:"src,omitempty"`
+	Expr    string  `json:"expr,omitempty"`
+	Const   *string `json:"const,omitempty"`
+	Default bool    `json:"default,omitempty"`
+}
+
+// Validate проверяет, что у правила задана целевая колонка и ровно один источник значения
+func (r ColumnRule) Validate() error {
+	if strings.TrimSpace(r.Dst) == "" {
+		return errors.New("column rule has no dst")
+	}
+
+	sources := 0
+	for _, set := range []bool{r.Src != "", r.Expr != "", r.Const != nil, r.Default} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("column rule for %s must set exactly one of src, expr, const, default", r.Dst)
+	}
+
+	if r.Expr != "" {
+		if err := ValidateWhereClause(r.Expr); err != nil {
+			return fmt.Errorf("column rule for %s: %w", r.Dst, err)
+		}
+	}
+
+	return nil
+}
+
+// MappedField поле, которое выгружается из источника. Значение берется из колонки Src или выражения Expr
+// и загружается в колонку Dst. Поле без Dst выгружается только для генерации UUID и не загружается
+type MappedField struct {
+	Src  string
+	Expr string
+	Dst  string
+
+	// Type тип колонки Dst (см. SetTypes). nil - тип неизвестен, значение загружается строкой
+	Type *ColumnInfo
+
+	// Ref поле - внешний ключ (см. SetRef): выгружается nid родительской строки, загружается ее UUID
+	Ref bool
+}
+
+// ConstColumn колонка целевой таблицы, которая при загрузке заполняется константой
+type ConstColumn struct {
+	Dst   string
+	Value string
+}
+
+// ColumnMapping соответствие колонок источника и целевой таблицы. Поля CSV идут в порядке Fields после UUID.
+// Колонки Consts заполняются константами, колонки Defaults не загружаются и получают значение по умолчанию
+type ColumnMapping struct {
+	Fields   []MappedField
+	Consts   []ConstColumn
+	Defaults []string
+
+	// UUIDFormat формат UUID в CSV и в колонке UUID (см. uuidv7.Formats). Пусто - binary
+	UUIDFormat string
+}
+
+// PositionalMapping возвращает соответствие по позиции: первая колонка целевой таблицы - UUID, остальные
+// по порядку получают колонки источника. Лишние колонки источника выгружаются, но не загружаются
+func PositionalMapping(src, dst []string) ColumnMapping {
+	var m ColumnMapping
+	for i, col := range src {
+		f := MappedField{Src: col}
+		if i+1 < len(dst) {
+			f.Dst = dst[i+1]
+		}
+		m.Fields = append(m.Fields, f)
+	}
+
+	return m
+}
+
+// BuildColumnMapping строит соответствие колонок по правилам. Колонки целевой таблицы без правила получают
+// одноименную колонку источника. Каждая колонка целевой таблицы, кроме UUID, должна получить значение,
+// а каждая колонка источника - попасть в целевую таблицу или быть перечисленной в drop: иначе данные
+// молча потерялись бы при загрузке
+func BuildColumnMapping(src, dst []string, uuidCol string, rules []ColumnRule, drop []string) (ColumnMapping, error) {
+	srcNames := make(map[string]string, len(src))
+	for _, col := range src {
+		srcNames[strings.ToLower(col)] = col
+	}
+
+	dropped := make(map[string]bool, len(drop))
+	for _, col := range drop {
+		if _, ok := srcNames[strings.ToLower(col)]; !ok {
+			return ColumnMapping{}, fmt.Errorf("drop: source has no column %s", col)
+		}
+		dropped[strings.ToLower(col)] = true
+	}
+
+	dstNames := make(map[string]bool, len(dst))
+	hasUUID := false
+	for _, col := range dst {
+		dstNames[strings.ToLower(col)] = true
+		if strings.EqualFold(col, uuidCol) {
+			hasUUID = true
+		}
+	}
+	if !hasUUID {
+		return ColumnMapping{}, fmt.Errorf("destination has no UUID column %s", uuidCol)
+	}
+
+	byDst := make(map[string]ColumnRule, len(rules))
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return ColumnMapping{}, err
+		}
+
+		key := strings.ToLower(r.Dst)
+		switch {
+		case strings.EqualFold(r.Dst, uuidCol):
+			return ColumnMapping{}, fmt.Errorf("column rule for %s: UUID column is generated by the migrator", r.Dst)
+		case !dstNames[key]:
+			return ColumnMapping{}, fmt.Errorf("column rule for %s: destination has no such column", r.Dst)
+		}
+		if _, dup := byDst[key]; dup {
+			return ColumnMapping{}, fmt.Errorf("column rule for %s is set twice", r.Dst)
+		}
+
+		if r.Src != "" {
+			name, ok := srcNames[strings.ToLower(r.Src)]
+			switch {
+			case !ok:
+				return ColumnMapping{}, fmt.Errorf("column rule for %s: source has no column %s", r.Dst, r.Src)
+			case dropped[strings.ToLower(r.Src)]:
+				return ColumnMapping{}, fmt.Errorf("column rule for %s: source column %s is dropped", r.Dst, r.Src)
+			}
+			r.Src = name
+		}
+		byDst[key] = r
+	}
+
+	var m ColumnMapping
+	used := make(map[string]bool, len(src))
+	for _, col := range dst {
+		if strings.EqualFold(col, uuidCol) {
+			continue
+		}
+
+		r, ok := byDst[strings.ToLower(col)]
+		if !ok {
+			name, found := srcNames[strings.ToLower(col)]
+			if !found || dropped[strings.ToLower(col)] {
+				return ColumnMapping{}, fmt.Errorf("destination column %s has no source: add a column rule or mark it default", col)
+			}
+			r = ColumnRule{Dst: col, Src: name}
+		}
+
+		switch {
+		case r.Src != "":
+			used[strings.ToLower(r.Src)] = true
+			m.Fields = append(m.Fields, MappedField{Src: r.Src, Dst: col})
+		case r.Expr != "":
+			m.Fields = append(m.Fields, MappedField{Expr: r.Expr, Dst: col})
+		case r.Const != nil:
+			m.Consts = append(m.Consts, ConstColumn{Dst: col, Value: *r.Const})
+		default:
+			m.Defaults = append(m.Defaults, col)
+		}
+	}
+
+	for _, col := range src {
+		if !used[strings.ToLower(col)] && !dropped[strings.ToLower(col)] {
+			return ColumnMapping{}, fmt.Errorf("source column %s is not mapped: add a column rule or list it in drop", col)
+		}
+	}
+
+	return m, nil
+}
+
+// SourceField возвращает индекс поля, которое выгружает колонку источника src. Если колонки среди полей нет,
+// она добавляется полем без целевой колонки
+func (m *ColumnMapping) SourceField(src string) int {
+	for i, f := range m.Fields {
+		if f.Src != "" && strings.EqualFold(f.Src, src) {
+			return i
+		}
+	}
+
+	m.Fields = append(m.Fields, MappedField{Src: src})
+	return len(m.Fields) - 1
+}
+
+// SetRef помечает поле, которое выгружает колонку источника src, как внешний ключ: его значение
+// выгружается как есть, без преобразования по типу колонки Dst, и заменяется на UUID до записи в CSV
+func (m *ColumnMapping) SetRef(src string) (int, error) {
+	for i, f := range m.Fields {
+		if f.Src != "" && strings.EqualFold(f.Src, src) {
+			if f.Dst == "" {
+				return 0, fmt.Errorf("foreign key column %s is not loaded", src)
+			}
+			m.Fields[i].Ref = true
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("foreign key column %s not found in source", src)
+}
+
+// Loaded возвращает индексы полей, которые загружаются в целевую таблицу
+func (m ColumnMapping) Loaded() []int {
+	out := make([]int, 0, len(m.Fields))
+	for i, f := range m.Fields {
+		if f.Dst != "" {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Pairs возвращает колонки источника и целевой таблицы, которые копируются без преобразования
+func (m ColumnMapping) Pairs() ([]string, []string) {
+	var src, dst []string
+	for _, f := range m.Fields {
+		if f.Src != "" && f.Dst != "" && !f.Ref {
+			src = append(src, f.Src)
+			dst = append(dst, f.Dst)
+		}
+	}
+	return src, dst
+}
+
+// selectList возвращает список выражений SELECT в порядке полей
+func (m ColumnMapping) selectList() []string {
+	out := make([]string, 0, len(m.Fields))
+	for _, f := range m.Fields {
+		expr := util.Ident(f.Src)
+		if f.Expr != "" {
+			expr = "(" + f.Expr + ")"
+		}
+		if !f.Ref {
+			expr = selectExpr(f.Type, expr)
+		}
+		out = append(out, expr)
+	}
+	return out
+}
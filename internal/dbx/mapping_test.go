@@ -0,0 +1,241 @@
+package dbx
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestColumnRule_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    ColumnRule
+		wantErr bool
+	}{
+		{name: "source column", rule: ColumnRule{Dst: "nid", Src: "id"}},
+		{name: "expression", rule: ColumnRule{Dst: "msg", Expr: "LEFT(`message`, 100)"}},
+		{name: "empty constant", rule: ColumnRule{Dst: "source", Const: strPtr("")}},
+		{name: "default", rule: ColumnRule{Dst: "updated_at", Default: true}},
+		{name: "no dst", rule: ColumnRule{Src: "id"}, wantErr: true},
+		{name: "no source", rule: ColumnRule{Dst: "nid"}, wantErr: true},
+		{name: "two sources", rule: ColumnRule{Dst: "nid", Src: "id", Default: true}, wantErr: true},
+		{name: "dangerous expression", rule: ColumnRule{Dst: "msg", Expr: "1; DROP TABLE log"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPositionalMapping(t *testing.T) {
+	m := PositionalMapping([]string{"id", "ins_ts", "msg"}, []string{"uuid", "nid", "ins_ts"})
+
+	want := []MappedField{
+		{Src: "id", Dst: "nid"},
+		{Src: "ins_ts", Dst: "ins_ts"},
+		{Src: "msg"},
+	}
+	if !reflect.DeepEqual(m.Fields, want) {
+		t.Errorf("PositionalMapping() = %+v, want %+v", m.Fields, want)
+	}
+	if got := m.Loaded(); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("Loaded() = %v, want [0 1]", got)
+	}
+}
+
+func TestBuildColumnMapping(t *testing.T) {
+	src := []string{"id", "ins_ts", "message", "debug"}
+	dst := []string{"uuid", "nid", "ins_ts", "msg", "source", "updated_at"}
+
+	rules := []ColumnRule{
+		{Dst: "nid", Src: "ID"},
+		{Dst: "msg", Expr: "LEFT(`message`, 100)"},
+		{Dst: "source", Const: strPtr("legacy")},
+		{Dst: "updated_at", Default: true},
+	}
+
+	m, err := BuildColumnMapping(src, dst, "uuid", rules, []string{"message", "debug"})
+	if err != nil {
+		t.Fatalf("BuildColumnMapping() error = %v", err)
+	}
+
+	want := ColumnMapping{
+		Fields: []MappedField{
+			{Src: "id", Dst: "nid"},
+			{Src: "ins_ts", Dst: "ins_ts"},
+			{Expr: "LEFT(`message`, 100)", Dst: "msg"},
+		},
+		Consts:   []ConstColumn{{Dst: "source", Value: "legacy"}},
+		Defaults: []string{"updated_at"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("BuildColumnMapping() = %+v, want %+v", m, want)
+	}
+}
+
+func TestBuildColumnMapping_Errors(t *testing.T) {
+	src := []string{"id", "ins_ts", "msg"}
+	dst := []string{"uuid", "nid", "ins_ts", "msg"}
+	nid := ColumnRule{Dst: "nid", Src: "id"}
+
+	tests := []struct {
+		name    string
+		dst     []string
+		rules   []ColumnRule
+		drop    []string
+		wantErr string
+	}{
+		{name: "destination column without source", rules: nil, wantErr: "destination column nid has no source"},
+		{name: "source column not mapped", dst: []string{"uuid", "nid", "ins_ts"}, rules: []ColumnRule{nid}, wantErr: "source column msg is not mapped"},
+		{name: "unknown drop", rules: []ColumnRule{nid}, drop: []string{"missing"}, wantErr: "drop: source has no column missing"},
+		{name: "unknown destination", rules: []ColumnRule{nid, {Dst: "missing", Default: true}}, wantErr: "destination has no such column"},
+		{name: "unknown source", rules: []ColumnRule{{Dst: "nid", Src: "missing"}}, wantErr: "source has no column missing"},
+		{name: "rule for uuid", rules: []ColumnRule{nid, {Dst: "uuid", Src: "id"}}, wantErr: "UUID column is generated"},
+		{name: "duplicate rule", rules: []ColumnRule{nid, nid}, wantErr: "is set twice"},
+		{name: "dropped source", rules: []ColumnRule{nid, {Dst: "msg", Src: "msg"}}, drop: []string{"msg"}, wantErr: "source column msg is dropped"},
+		{name: "no uuid column", dst: []string{"nid", "ins_ts", "msg"}, rules: []ColumnRule{nid}, wantErr: "destination has no UUID column uuid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := dst
+			if tt.dst != nil {
+				d = tt.dst
+			}
+
+			_, err := BuildColumnMapping(src, d, "uuid", tt.rules, tt.drop)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("BuildColumnMapping() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestColumnMapping_SourceField(t *testing.T) {
+	m := ColumnMapping{Fields: []MappedField{{Src: "id", Dst: "nid"}, {Expr: "1", Dst: "flag"}}}
+
+	if got := m.SourceField("ID"); got != 0 {
+		t.Errorf("SourceField(ID) = %d, want 0", got)
+	}
+	if got := m.SourceField("ins_ts"); got != 2 {
+		t.Errorf("SourceField(ins_ts) = %d, want 2", got)
+	}
+	if got := m.Loaded(); !reflect.DeepEqual(got, []int{0, 1}) {
+		t.Errorf("Loaded() = %v, want [0 1]: ts-only field must not be loaded", got)
+	}
+}
+
+func TestColumnMapping_SetRef(t *testing.T) {
+	m := PositionalMapping([]string{"id", "log_id", "ins_ts"}, []string{"id", "nid", "log_uuid"})
+	m.SetTypes([]ColumnInfo{{Name: "nid", DataType: "bigint"}, {Name: "log_uuid", DataType: "binary", MaxLength: 16}})
+
+	i, err := m.SetRef("LOG_ID")
+	if err != nil || i != 1 {
+		t.Fatalf("SetRef(LOG_ID) = %d, %v, want 1", i, err)
+	}
+
+	// nid родителя выгружается как есть, а загружается UUID в hex
+	sel := BuildSelectByRange("log_tag", m, "id", "")
+	if want := "SELECT `id`,`log_id`,`ins_ts` FROM"; !strings.HasPrefix(sel, want) {
+		t.Errorf("BuildSelectByRange() = %q, want prefix %q", sel, want)
+	}
+	if load := BuildLoadDataSQL("/tmp/stage.csv", "log_tag", "id", m, false); !strings.Contains(load, "`log_uuid`=UNHEX(NULLIF(@log_uuid,''))") {
+		t.Errorf("BuildLoadDataSQL() = %q, want UNHEX for foreign key", load)
+	}
+	if src, dst := m.Pairs(); !reflect.DeepEqual(src, []string{"id"}) || !reflect.DeepEqual(dst, []string{"nid"}) {
+		t.Errorf("Pairs() = %v, %v, want foreign key excluded", src, dst)
+	}
+
+	if _, err := m.SetRef("ins_ts"); err == nil || !strings.Contains(err.Error(), "is not loaded") {
+		t.Errorf("SetRef(ins_ts) error = %v, want not loaded", err)
+	}
+	if _, err := m.SetRef("tag_id"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("SetRef(tag_id) error = %v, want not found", err)
+	}
+}
+
+func TestMappedSQL(t *testing.T) {
+	m := ColumnMapping{
+		Fields: []MappedField{
+			{Src: "id", Dst: "nid"},
+			{Expr: "LEFT(`message`, 100)", Dst: "msg"},
+			{Src: "ins_ts"},
+		},
+		Consts:   []ConstColumn{{Dst: "source", Value: "legacy"}},
+		Defaults: []string{"updated_at"},
+	}
+
+	sel := BuildSelectByRange("log", m, "id", "")
+	if want := "SELECT `id`,(LEFT(`message`, 100)),`ins_ts` FROM `log`"; !strings.HasPrefix(sel, want) {
+		t.Errorf("BuildSelectByRange() = %q, want prefix %q", sel, want)
+	}
+
+	load := BuildLoadDataSQL("/tmp/stage.csv", "log", "id", m, false)
+	if !strings.Contains(load, "(@id_hex,@nid,@msg,@dummy)") {
+		t.Errorf("BuildLoadDataSQL() = %q, want variables with @dummy for ts-only field", load)
+	}
+	if want := "SET `id`=UNHEX(@id_hex), `nid`=NULLIF(@nid,''), `msg`=NULLIF(@msg,''), `source`='legacy'"; !strings.HasSuffix(load, want) {
+		t.Errorf("BuildLoadDataSQL() = %q, want suffix %q", load, want)
+	}
+
+	insert := BuildInsertSQL("log", "id", m, 1)
+	if want := "INSERT INTO `log` (`id`,`nid`,`msg`,`source`) VALUES (UNHEX(?),NULLIF(?,''),NULLIF(?,''),'legacy')"; insert != want {
+		t.Errorf("BuildInsertSQL() = %q, want %q", insert, want)
+	}
+}
+
+func TestColumnMapping_Pairs(t *testing.T) {
+	tests := []struct {
+		name    string
+		m       ColumnMapping
+		wantSrc []string
+		wantDst []string
+	}{
+		{
+			name:    "destination has uuid and renamed nid",
+			m:       PositionalMapping([]string{"id", "ins_ts", "msg"}, []string{"id", "nid", "ins_ts", "msg"}),
+			wantSrc: []string{"id", "ins_ts", "msg"},
+			wantDst: []string{"nid", "ins_ts", "msg"},
+		},
+		{
+			name:    "destination has fewer columns",
+			m:       PositionalMapping([]string{"id", "ins_ts", "msg"}, []string{"id", "nid", "ins_ts"}),
+			wantSrc: []string{"id", "ins_ts"},
+			wantDst: []string{"nid", "ins_ts"},
+		},
+		{
+			name:    "empty destination",
+			m:       PositionalMapping([]string{"id"}, nil),
+			wantSrc: nil,
+			wantDst: nil,
+		},
+		{
+			name: "expressions and constants are skipped",
+			m: ColumnMapping{
+				Fields: []MappedField{{Src: "id", Dst: "nid"}, {Expr: "UPPER(`msg`)", Dst: "msg"}},
+				Consts: []ConstColumn{{Dst: "source", Value: "legacy"}},
+			},
+			wantSrc: []string{"id"},
+			wantDst: []string{"nid"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSrc, gotDst := tt.m.Pairs()
+			if !reflect.DeepEqual(gotSrc, tt.wantSrc) {
+				t.Errorf("Pairs() src = %v, want %v", gotSrc, tt.wantSrc)
+			}
+			if !reflect.DeepEqual(gotDst, tt.wantDst) {
+				t.Errorf("Pairs() dst = %v, want %v", gotDst, tt.wantDst)
+			}
+		})
+	}
+}
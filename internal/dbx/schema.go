@@ -0,0 +1,87 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// ColumnInfo описание колонки из INFORMATION_SCHEMA.COLUMNS
+type ColumnInfo struct {
+	Name     string
+	Position int
+
+	// DataType тип без параметров (bigint, varchar), ColumnType - полный тип (bigint unsigned, varchar(255))
+	DataType   string
+	ColumnType string
+
+	Nullable bool
+	Default  sql.NullString
+	Extra    string
+
+	// MaxLength максимальная длина строки в символах или бинарной строки в байтах, 0 для других типов
+	MaxLength         uint64
+	NumericPrecision  uint64
+	NumericScale      uint64
+	DatetimePrecision uint64
+	Charset           string
+}
+
+// Unsigned возвращает true для беззнаковых числовых колонок
+func (c ColumnInfo) Unsigned() bool {
+	return strings.Contains(strings.ToLower(c.ColumnType), "unsigned")
+}
+
+// Generated возвращает true, если значение колонки вычисляет сервер: AUTO_INCREMENT или генерируемая колонка
+func (c ColumnInfo) Generated() bool {
+	extra := strings.ToLower(c.Extra)
+	if strings.Contains(extra, "auto_increment") {
+		return true
+	}
+	// DEFAULT_GENERATED - обычная колонка с выражением в DEFAULT, ее значение можно загрузить
+	return strings.Contains(extra, "generated") && !strings.Contains(extra, "default_generated")
+}
+
+// TableSchema читает описание колонок таблицы в порядке ORDINAL_POSITION
+func TableSchema(ctx context.Context, db *sql.DB, table string) ([]ColumnInfo, error) {
+	q := `
+		SELECT COLUMN_NAME, ORDINAL_POSITION, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE, COLUMN_DEFAULT, EXTRA,
+			COALESCE(CHARACTER_MAXIMUM_LENGTH, 0), COALESCE(NUMERIC_PRECISION, 0), COALESCE(NUMERIC_SCALE, 0),
+			COALESCE(DATETIME_PRECISION, 0), COALESCE(CHARACTER_SET_NAME, '')
+		FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION
+	`
+	rows, err := db.QueryContext(ctx, q, table)
+	if err != nil {
+		return nil, fmt.Errorf("read schema of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var (
+			c        ColumnInfo
+			nullable string
+		)
+		if err := rows.Scan(
+			&c.Name, &c.Position, &c.DataType, &c.ColumnType, &nullable, &c.Default, &c.Extra,
+			&c.MaxLength, &c.NumericPrecision, &c.NumericScale, &c.DatetimePrecision, &c.Charset,
+		); err != nil {
+			return nil, fmt.Errorf("scan schema of %s: %w", table, err)
+		}
+		c.DataType = strings.ToLower(c.DataType)
+		c.Nullable = nullable == "YES"
+		columns = append(columns, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read schema of %s: %w", table, err)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("table %s not found or has no columns", table)
+	}
+
+	return columns, nil
+}
@@ -0,0 +1,301 @@
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"logs-migrator/internal/ranger"
+)
+
+// State состояние шарда в журнале
+type State string
+
+const (
+	StatePlanned State = "planned"
+	StateStaged  State = "staged"
+	StateLoaded  State = "loaded"
+)
+
+// Key набор параметров миграции, по которому определяется файл журнала.
+// Разные таблицы и фильтры пишут в разные журналы
+type Key struct {
+	SrcTable  string
+	SrcNID    string
+	SrcFilter string
+	DstTable  string
+	DstNID    string
+}
+
+// FileName возвращает имя файла журнала для ключа
+func (k Key) FileName() string {
+	sum := sha256.Sum256([]byte(k.SrcTable + "\x00" + k.SrcNID + "\x00" + k.SrcFilter + "\x00" + k.DstTable + "\x00" + k.DstNID))
+	return fmt.Sprintf("journal_%s_%s_%s.jsonl", k.SrcTable, k.DstTable, hex.EncodeToString(sum[:4]))
+}
+
+// entry одна строка журнала
+type entry struct {
+	State State  `json:"state"`
+	From  uint64 `json:"from"`
+	To    uint64 `json:"to"`
+	Rows  uint64 `json:"rows,omitempty"`
+}
+
+// Journal append-only журнал шардов на диске. Каждая смена состояния шарда дописывается отдельной
+// строкой и сразу синхронизируется на диск, поэтому после падения процесса журнал отражает
+// последнее зафиксированное состояние.
+//
+// Методы безопасны для конкурентного вызова. Методы nil-журнала ничего не делают, это позволяет
+// не проверять, включен ли журнал, в местах вызова.
+type Journal struct {
+	mu     sync.Mutex
+	file   *os.File
+	path   string
+	states map[ranger.Range]State
+	order  []ranger.Range
+}
+
+// Open открывает (или создает) журнал для ключа в директории dir и восстанавливает из него состояние шардов
+func Open(dir string, key Key) (*Journal, error) {
+	path := filepath.Join(dir, key.FileName())
+
+	j := &Journal{
+		path:   path,
+		states: make(map[ranger.Range]State),
+	}
+
+	if err := j.replay(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open journal: %w", err)
+	}
+	j.file = file
+
+	// Если процесс упал посреди записи, последняя строка осталась без перевода строки.
+	// Завершаем её, чтобы следующая запись не склеилась с мусором
+	if err := j.terminateLastLine(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return j, nil
+}
+
+func (j *Journal) terminateLastLine() error {
+	info, err := j.file.Stat()
+	if err != nil {
+		return fmt.Errorf("stat journal: %w", err)
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+
+	last := make([]byte, 1)
+	if _, err := j.file.ReadAt(last, info.Size()-1); err != nil {
+		return fmt.Errorf("read journal: %w", err)
+	}
+	if last[0] == '\n' {
+		return nil
+	}
+
+	if _, err := j.file.Write([]byte{'\n'}); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	return nil
+}
+
+// Read загружает журнал только для чтения: файл не создается, запись в такой журнал возвращает ошибку
+func Read(dir string, key Key) (*Journal, error) {
+	j := &Journal{
+		path:   filepath.Join(dir, key.FileName()),
+		states: make(map[ranger.Range]State),
+	}
+
+	if err := j.replay(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// replay читает существующий файл журнала. Отсутствие файла не является ошибкой
+func (j *Journal) replay() error {
+	file, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open journal: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// Последняя строка могла быть недописана в момент падения, такое пропускаем
+			continue
+		}
+
+		j.apply(e)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read journal %s: %w", j.path, err)
+	}
+
+	return nil
+}
+
+func (j *Journal) apply(e entry) {
+	r := ranger.Range{From: e.From, To: e.To}
+	if _, ok := j.states[r]; !ok {
+		j.order = append(j.order, r)
+	}
+	j.states[r] = e.State
+}
+
+// Path возвращает путь до файла журнала
+func (j *Journal) Path() string {
+	if j == nil {
+		return ""
+	}
+	return j.path
+}
+
+// Empty возвращает true, если в журнале нет ни одного шарда
+func (j *Journal) Empty() bool {
+	if j == nil {
+		return true
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return len(j.order) == 0
+}
+
+// Pending возвращает шарды, которые были запланированы, но не загружены, в порядке планирования
+func (j *Journal) Pending() []ranger.Range {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var out []ranger.Range
+	for _, r := range j.order {
+		if j.states[r] != StateLoaded {
+			out = append(out, r)
+		}
+	}
+
+	return out
+}
+
+// MaxTo возвращает верхнюю границу самого дальнего запланированного шарда
+func (j *Journal) MaxTo() uint64 {
+	if j == nil {
+		return 0
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var maxTo uint64
+	for _, r := range j.order {
+		if r.To > maxTo {
+			maxTo = r.To
+		}
+	}
+
+	return maxTo
+}
+
+// Plan записывает в журнал новые шарды
+func (j *Journal) Plan(ranges []ranger.Range) error {
+	if j == nil || len(ranges) == 0 {
+		return nil
+	}
+
+	entries := make([]entry, 0, len(ranges))
+	for _, r := range ranges {
+		entries = append(entries, entry{State: StatePlanned, From: r.From, To: r.To})
+	}
+
+	return j.write(entries...)
+}
+
+// MarkStaged отмечает, что шард выгружен во временный файл
+func (j *Journal) MarkStaged(r ranger.Range, rows uint64) error {
+	if j == nil {
+		return nil
+	}
+	return j.write(entry{State: StateStaged, From: r.From, To: r.To, Rows: rows})
+}
+
+// MarkLoaded отмечает, что шард полностью загружен в целевую БД
+func (j *Journal) MarkLoaded(r ranger.Range, rows uint64) error {
+	if j == nil {
+		return nil
+	}
+	return j.write(entry{State: StateLoaded, From: r.From, To: r.To, Rows: rows})
+}
+
+func (j *Journal) write(entries ...entry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file == nil {
+		return fmt.Errorf("journal %s is opened read-only", j.path)
+	}
+
+	w := bufio.NewWriter(j.file)
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("encode journal entry: %w", err)
+		}
+		line = append(line, '\n')
+		if _, err := w.Write(line); err != nil {
+			return fmt.Errorf("write journal: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("sync journal: %w", err)
+	}
+
+	for _, e := range entries {
+		j.apply(e)
+	}
+
+	return nil
+}
+
+// Close закрывает файл журнала
+func (j *Journal) Close() error {
+	if j == nil || j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
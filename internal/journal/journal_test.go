@@ -0,0 +1,187 @@
+package journal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"logs-migrator/internal/ranger"
+)
+
+func testKey() Key {
+	return Key{SrcTable: "log", SrcNID: "id", DstTable: "log", DstNID: "nid"}
+}
+
+func TestKeyFileName(t *testing.T) {
+	t.Run("contains table names", func(t *testing.T) {
+		name := testKey().FileName()
+		if !strings.HasPrefix(name, "journal_log_log_") || !strings.HasSuffix(name, ".jsonl") {
+			t.Errorf("FileName() = %q, want journal_log_log_*.jsonl", name)
+		}
+	})
+
+	t.Run("different filters give different files", func(t *testing.T) {
+		a := testKey()
+		b := testKey()
+		b.SrcFilter = "id % 100 = 0"
+
+		if a.FileName() == b.FileName() {
+			t.Errorf("FileName() should differ for different filters, got %q", a.FileName())
+		}
+	})
+}
+
+func TestJournal(t *testing.T) {
+	t.Run("new journal is empty", func(t *testing.T) {
+		j, err := Open(t.TempDir(), testKey())
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		defer j.Close()
+
+		if !j.Empty() {
+			t.Error("Empty() = false for new journal")
+		}
+		if len(j.Pending()) != 0 {
+			t.Errorf("Pending() = %v, want empty", j.Pending())
+		}
+	})
+
+	t.Run("resumes unfinished shards after reopen", func(t *testing.T) {
+		dir := t.TempDir()
+
+		j, err := Open(dir, testKey())
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+
+		shards := []ranger.Range{{From: 0, To: 10}, {From: 10, To: 20}, {From: 20, To: 30}}
+		if err := j.Plan(shards); err != nil {
+			t.Fatalf("Plan() error: %v", err)
+		}
+		// Загрузка завершилась не по порядку: второй шард загружен, первый только выгружен
+		if err := j.MarkStaged(shards[0], 5); err != nil {
+			t.Fatalf("MarkStaged() error: %v", err)
+		}
+		if err := j.MarkStaged(shards[1], 7); err != nil {
+			t.Fatalf("MarkStaged() error: %v", err)
+		}
+		if err := j.MarkLoaded(shards[1], 7); err != nil {
+			t.Fatalf("MarkLoaded() error: %v", err)
+		}
+		_ = j.Close()
+
+		j, err = Open(dir, testKey())
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		defer j.Close()
+
+		pending := j.Pending()
+		want := []ranger.Range{shards[0], shards[2]}
+		if len(pending) != len(want) {
+			t.Fatalf("Pending() = %v, want %v", pending, want)
+		}
+		for i := range want {
+			if pending[i] != want[i] {
+				t.Errorf("Pending()[%d] = %v, want %v", i, pending[i], want[i])
+			}
+		}
+
+		if j.MaxTo() != 30 {
+			t.Errorf("MaxTo() = %d, want 30", j.MaxTo())
+		}
+	})
+
+	t.Run("ignores truncated last line", func(t *testing.T) {
+		dir := t.TempDir()
+
+		j, err := Open(dir, testKey())
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		if err := j.Plan([]ranger.Range{{From: 0, To: 10}}); err != nil {
+			t.Fatalf("Plan() error: %v", err)
+		}
+		path := j.Path()
+		_ = j.Close()
+
+		// Имитируем падение посреди записи
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			t.Fatalf("open: %v", err)
+		}
+		_, _ = f.WriteString(`{"state":"loa`)
+		_ = f.Close()
+
+		j, err = Open(dir, testKey())
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		if err := j.MarkLoaded(ranger.Range{From: 0, To: 10}, 3); err != nil {
+			t.Fatalf("MarkLoaded() error: %v", err)
+		}
+		_ = j.Close()
+
+		j, err = Open(dir, testKey())
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		defer j.Close()
+
+		if len(j.Pending()) != 0 {
+			t.Errorf("Pending() = %v, want empty", j.Pending())
+		}
+	})
+
+	t.Run("journal file is created in dir", func(t *testing.T) {
+		dir := t.TempDir()
+
+		j, err := Open(dir, testKey())
+		if err != nil {
+			t.Fatalf("Open() error: %v", err)
+		}
+		defer j.Close()
+
+		if filepath.Dir(j.Path()) != dir {
+			t.Errorf("Path() = %q, want in %q", j.Path(), dir)
+		}
+		if _, err := os.Stat(j.Path()); err != nil {
+			t.Errorf("journal file not created: %v", err)
+		}
+	})
+
+	t.Run("read-only journal does not create file", func(t *testing.T) {
+		dir := t.TempDir()
+
+		j, err := Read(dir, testKey())
+		if err != nil {
+			t.Fatalf("Read() error: %v", err)
+		}
+
+		if _, err := os.Stat(j.Path()); !os.IsNotExist(err) {
+			t.Errorf("Read() should not create journal file")
+		}
+		if err := j.Plan([]ranger.Range{{From: 0, To: 1}}); err == nil {
+			t.Error("Plan() on read-only journal should fail")
+		}
+	})
+
+	t.Run("nil journal is a no-op", func(t *testing.T) {
+		var j *Journal
+
+		if err := j.Plan([]ranger.Range{{From: 0, To: 1}}); err != nil {
+			t.Errorf("Plan() error: %v", err)
+		}
+		if err := j.MarkLoaded(ranger.Range{From: 0, To: 1}, 1); err != nil {
+			t.Errorf("MarkLoaded() error: %v", err)
+		}
+		if !j.Empty() {
+			t.Error("Empty() = false for nil journal")
+		}
+		if err := j.Close(); err != nil {
+			t.Errorf("Close() error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package logx
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input     string
+		want      slog.Level
+		wantError bool
+	}{
+		{input: "debug", want: slog.LevelDebug},
+		{input: "INFO", want: slog.LevelInfo},
+		{input: "warn", want: slog.LevelWarn},
+		{input: "error", want: slog.LevelError},
+		{input: "verbose", wantError: true},
+		{input: "", wantError: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.input)
+		if (err != nil) != tt.wantError {
+			t.Errorf("ParseLevel(%q) error = %v, wantError %v", tt.input, err, tt.wantError)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	defaultLogger := slog.Default()
+	defer slog.SetDefault(defaultLogger)
+
+	t.Run("json with fields", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := Setup(&buf, "info", FormatJSON); err != nil {
+			t.Fatal(err)
+		}
+
+		slog.Debug("hidden")
+		slog.Info("loaded", "worker", 2, "rows", 100)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 1 {
+			t.Fatalf("got %d lines, want 1: %q", len(lines), buf.String())
+		}
+
+		var entry map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+			t.Fatalf("invalid JSON %q: %v", lines[0], err)
+		}
+		if entry["msg"] != "loaded" || entry["worker"] != float64(2) || entry["rows"] != float64(100) {
+			t.Errorf("entry = %v", entry)
+		}
+	})
+
+	t.Run("text debug", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := Setup(&buf, "debug", FormatText); err != nil {
+			t.Fatal(err)
+		}
+
+		slog.Debug("fast-load applied", "query", "SET GLOBAL unique_checks = 0")
+		if !strings.Contains(buf.String(), `level=DEBUG msg="fast-load applied" query="SET GLOBAL unique_checks = 0"`) {
+			t.Errorf("output = %q", buf.String())
+		}
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		if err := Setup(&bytes.Buffer{}, "info", "xml"); err == nil {
+			t.Error("Setup() with unknown format should fail")
+		}
+	})
+}
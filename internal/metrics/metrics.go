@@ -0,0 +1,303 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Default реестр, метрики которого отдает Handler
+var Default = NewRegistry()
+
+// DurationBuckets границы гистограмм длительности в секундах: от 10 мс до ~20 минут
+var DurationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1200}
+
+// metric метрика, которая умеет записать себя в текстовом формате Prometheus
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+// Registry набор метрик в порядке регистрации
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// register добавляет метрику. Метрика с тем же именем заменяется: так функции-датчики можно
+// перерегистрировать для каждого запуска миграции
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.metrics {
+		if existing.name() == m.name() {
+			r.metrics[i] = m
+			return
+		}
+	}
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText пишет все метрики в текстовом формате Prometheus (version 0.0.4)
+func (r *Registry) WriteText(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Counter монотонный счетчик с необязательными метками
+type Counter struct {
+	desc
+	mu     sync.Mutex
+	values map[string]*atomic.Uint64
+}
+
+// Counter регистрирует счетчик с метками labelNames
+func (r *Registry) Counter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{desc: desc{metricName: name, help: help, labelNames: labelNames}, values: make(map[string]*atomic.Uint64)}
+	r.register(c)
+	return c
+}
+
+// Add увеличивает счетчик с заданными значениями меток на n
+func (c *Counter) Add(n uint64, labelValues ...string) {
+	key := c.key(labelValues)
+
+	c.mu.Lock()
+	v, ok := c.values[key]
+	if !ok {
+		v = new(atomic.Uint64)
+		c.values[key] = v
+	}
+	c.mu.Unlock()
+
+	v.Add(n)
+}
+
+// Inc увеличивает счетчик с заданными значениями меток на единицу
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value возвращает значение счетчика с заданными значениями меток
+func (c *Counter) Value(labelValues ...string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if v, ok := c.values[c.key(labelValues)]; ok {
+		return v.Load()
+	}
+	return 0
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w, "counter")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %d\n", c.metricName, key, c.values[key].Load())
+	}
+}
+
+// Gauge значение, которое может расти и уменьшаться
+type Gauge struct {
+	desc
+	value atomic.Int64
+}
+
+// Gauge регистрирует целочисленный датчик без меток
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{metricName: name, help: help}}
+	r.register(g)
+	return g
+}
+
+// Add изменяет значение датчика на delta
+func (g *Gauge) Add(delta int64) {
+	g.value.Add(delta)
+}
+
+// Set устанавливает значение датчика
+func (g *Gauge) Set(v int64) {
+	g.value.Store(v)
+}
+
+// Value возвращает текущее значение датчика
+func (g *Gauge) Value() int64 {
+	return g.value.Load()
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.header(w, "gauge")
+	fmt.Fprintf(w, "%s %d\n", g.metricName, g.value.Load())
+}
+
+// gaugeFunc датчик, значение которого вычисляется при каждом запросе
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+// GaugeFunc регистрирует датчик, значение которого возвращает fn
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(&gaugeFunc{desc: desc{metricName: name, help: help}, fn: fn})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	g.header(w, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.metricName, formatFloat(g.fn()))
+}
+
+// Histogram гистограмма наблюдений с фиксированными границами и необязательными метками
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Histogram регистрирует гистограмму с границами buckets (по возрастанию) и метками labelNames
+func (r *Registry) Histogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{metricName: name, help: help, labelNames: labelNames},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(h)
+	return h
+}
+
+// Observe добавляет наблюдение v в серию с заданными значениями меток
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.header(w, "histogram")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, withLabel(key, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName, withLabel(key, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, key, formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, key, s.count)
+	}
+}
+
+// desc имя, описание и имена меток метрики
+type desc struct {
+	metricName string
+	help       string
+	labelNames []string
+}
+
+func (d *desc) name() string {
+	return d.metricName
+}
+
+func (d *desc) header(w io.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.metricName, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.metricName, typ)
+}
+
+// key строит набор меток в формате {a="1",b="2"}, он же ключ серии. Недостающие значения меток пустые
+func (d *desc) key(labelValues []string) string {
+	if len(d.labelNames) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, len(d.labelNames))
+	for i, labelName := range d.labelNames {
+		var value string
+		if i < len(labelValues) {
+			value = labelValues[i]
+		}
+		pairs[i] = labelName + `="` + escapeLabel(value) + `"`
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel добавляет метку к набору меток key
+func withLabel(key, labelName, value string) string {
+	pair := labelName + `="` + escapeLabel(value) + `"`
+	if key == "" {
+		return "{" + pair + "}"
+	}
+	return strings.TrimSuffix(key, "}") + "," + pair + "}"
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+
+	rows := r.Counter("rows_total", "Rows processed", "phase")
+	rows.Add(10, "stage")
+	rows.Add(5, "load")
+	rows.Inc("stage")
+
+	inflight := r.Gauge("inflight", "Files on disk")
+	inflight.Add(3)
+	inflight.Add(-1)
+
+	r.GaugeFunc("queue_depth", "Queue depth", func() float64 { return 7 })
+
+	latency := r.Histogram("latency_seconds", "Latency", []float64{0.1, 1}, "phase")
+	latency.Observe(0.05, "load")
+	latency.Observe(0.5, "load")
+	latency.Observe(2, "load")
+
+	var sb strings.Builder
+	r.WriteText(&sb)
+
+	want := `# HELP rows_total Rows processed
+# TYPE rows_total counter
+rows_total{phase="load"} 5
+rows_total{phase="stage"} 11
+# HELP inflight Files on disk
+# TYPE inflight gauge
+inflight 2
+# HELP queue_depth Queue depth
+# TYPE queue_depth gauge
+queue_depth 7
+# HELP latency_seconds Latency
+# TYPE latency_seconds histogram
+latency_seconds_bucket{phase="load",le="0.1"} 1
+latency_seconds_bucket{phase="load",le="1"} 2
+latency_seconds_bucket{phase="load",le="+Inf"} 3
+latency_seconds_sum{phase="load"} 2.55
+latency_seconds_count{phase="load"} 3
+`
+	if got := sb.String(); got != want {
+		t.Errorf("WriteText() =\n%s\nwant:\n%s", got, want)
+	}
+
+	if v := rows.Value("stage"); v != 11 {
+		t.Errorf("rows.Value(stage) = %d, want 11", v)
+	}
+}
+
+func TestRegistry_ReplaceByName(t *testing.T) {
+	r := NewRegistry()
+	r.GaugeFunc("queue_depth", "Queue depth", func() float64 { return 1 })
+	r.GaugeFunc("queue_depth", "Queue depth", func() float64 { return 2 })
+
+	var sb strings.Builder
+	r.WriteText(&sb)
+
+	if got := strings.Count(sb.String(), "# TYPE queue_depth"); got != 1 {
+		t.Errorf("queue_depth registered %d times, want 1", got)
+	}
+	if !strings.Contains(sb.String(), "queue_depth 2\n") {
+		t.Errorf("WriteText() = %q, want replaced value", sb.String())
+	}
+}
+
+func TestEscapeLabel(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("errors_total", "Errors", "table")
+	c.Inc("a\"b\\c\nd")
+
+	var sb strings.Builder
+	r.WriteText(&sb)
+
+	if want := `errors_total{table="a\"b\\c\nd"} 1`; !strings.Contains(sb.String(), want) {
+		t.Errorf("WriteText() = %q, want %q", sb.String(), want)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("rows_total", "Rows processed").Add(3)
+
+	rec := httptest.NewRecorder()
+	Handler(r).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	if !strings.Contains(string(body), "rows_total 3\n") {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestServe(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("loopback listener is not available: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, ln) }()
+
+	resp, err := http.Get("http://" + ln.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /metrics status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() error = %v", err)
+	}
+}
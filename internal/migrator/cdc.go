@@ -0,0 +1,541 @@
+package migrator
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"logs-migrator/internal/binlog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/ranger"
+	"logs-migrator/internal/stagewriter"
+	"logs-migrator/internal/util"
+	"logs-migrator/internal/uuidv7"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// cdcGap наибольший промежуток между измененными nid, которые переносятся одним диапазоном. Строки внутри
+// промежутка переносятся заново вместе с измененными, зато диапазонов и транзакций меньше
+const cdcGap = 16
+
+// cdcTable таблица запуска, изменения которой переносятся из binlog
+type cdcTable struct {
+	task *tableTask
+
+	// nidColumn индекс колонки nid в образах строк binlog: образ содержит все колонки таблицы по порядку,
+	// columns - их количество в схеме источника
+	nidColumn int
+	columns   int
+
+	// resolver ищет UUID строк, уже загруженных в целевую таблицу
+	resolver *dstResolver
+
+	// pending измененные nid, которые еще не перенесены
+	pending map[uint64]struct{}
+}
+
+// CDC подключается к источнику как реплика и переносит изменения строк таблиц запуска из binlog: вставки,
+// обновления и удаления. Изменение служит только сигналом: строки с измененными nid перечитываются из
+// источника и заменяют строки целевой таблицы с тем же -dst-nid, строки, которых в источнике больше нет,
+// удаляются. UUID уже загруженных строк сохраняются. После применения изменений позиция binlog
+// записывается в контрольную точку в -journal-dir, и следующий запуск продолжает с нее.
+// Отмена ctx (SIGINT, SIGTERM) останавливает перенос без ошибки
+func CDC(ctx context.Context, srcDb, dstDb *sql.DB, secureDir string, cfg config.Config) error {
+	var tasks []*tableTask
+	defer func() {
+		for _, t := range tasks {
+			t.close()
+		}
+	}()
+
+	uuidMap, err := openUUIDMap(ctx, dstDb, cfg)
+	if err != nil {
+		return err
+	}
+	if uuidMap != nil {
+		defer func() {
+			if err := uuidMap.Close(); err != nil {
+				slog.Warn("failed to close UUID map", "err", err)
+			}
+		}()
+	}
+
+	for _, tableCfg := range cfg.Tables() {
+		// Изменения загружаются небольшими диапазонами, INSERT для них дешевле и не требует доступа к файлам на сервере
+		tableCfg.UseInsert = true
+
+		t, err := prepareTable(ctx, srcDb, dstDb, tableCfg)
+		if t != nil {
+			tasks = append(tasks, t)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", tableCfg.SrcTable, err)
+		}
+		t.uuidMap = uuidMap
+	}
+
+	if err := linkForeignKeys(ctx, dstDb, cfg, tasks); err != nil {
+		return err
+	}
+
+	// Родительские таблицы применяются раньше дочерних: внешние ключи дочерних строк ищут UUID родителей
+	// в целевой БД
+	waves, err := taskWaves(cfg, tasks)
+	if err != nil {
+		return err
+	}
+
+	checksum, err := checkBinlog(ctx, srcDb)
+	if err != nil {
+		return err
+	}
+
+	var schema string
+	if err := srcDb.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&schema); err != nil {
+		return fmt.Errorf("read source database: %w", err)
+	}
+
+	tables := make(map[string][]*cdcTable, len(tasks))
+	var order []*cdcTable
+	for _, wave := range waves {
+		for _, t := range wave {
+			c, err := newCDCTable(ctx, srcDb, dstDb, t)
+			if err != nil {
+				return fmt.Errorf("%s: %w", t.cfg.SrcTable, err)
+			}
+			key := strings.ToLower(t.cfg.SrcTable)
+			tables[key] = append(tables[key], c)
+			order = append(order, c)
+		}
+	}
+
+	path := checkpointPath(cfg)
+	if path == "" {
+		slog.Warn("binlog checkpoint disabled, -journal-dir is empty: a restart begins from -binlog-start or the current position")
+	}
+
+	pos, err := cdcStart(ctx, srcDb, cfg, path)
+	if err != nil {
+		return err
+	}
+
+	conn, err := binlog.Dial(ctx, cfg.SrcDSN, binlog.Options{
+		ServerID:  uint32(cfg.CDCServerID),
+		Checksum:  checksum,
+		Heartbeat: cfg.CDCFlushInterval,
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Чтение события не принимает контекст: отмена закрывает соединение и прерывает ожидание
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	stream, err := conn.Dump(pos)
+	if err != nil {
+		return fmt.Errorf("start binlog dump from %s: %w", pos, err)
+	}
+	stream.Match(func(s, table string) bool {
+		return strings.EqualFold(s, schema) && tables[strings.ToLower(table)] != nil
+	})
+
+	slog.Info("capturing changes from binlog", "position", pos, "server_id", cfg.CDCServerID,
+		"batch", cfg.CDCBatch, "flush_interval", cfg.CDCFlushInterval)
+
+	var (
+		// committed позиция после последней прочитанной транзакции, saved - записанная в контрольную точку
+		committed, saved = pos, pos
+		lastFlush        = time.Now()
+		changes, rows    uint64
+	)
+	for {
+		ev, err := stream.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return fmt.Errorf("read binlog after %s: %w", stream.Pos(), err)
+		}
+
+		if ev.Rows != nil {
+			for _, c := range tables[strings.ToLower(ev.Rows.Table.Table)] {
+				if err := c.collect(ev.Rows); err != nil {
+					return fmt.Errorf("%s: %w", c.task.cfg.SrcTable, err)
+				}
+			}
+		}
+		if ev.Commit() {
+			committed = ev.Pos
+		}
+
+		// Изменения применяются на границе транзакции, когда набралась пачка или прошел период, а в простое -
+		// по heartbeat. Контрольная точка сдвигается только после применения
+		due := time.Since(lastFlush) >= cfg.CDCFlushInterval
+		full := slices.ContainsFunc(order, func(c *cdcTable) bool { return len(c.pending) >= cfg.CDCBatch })
+		if !(ev.Commit() && (full || due)) && !(ev.Type == binlog.HeartbeatEvent && due) {
+			continue
+		}
+
+		n, loaded, err := applyChanges(ctx, srcDb, dstDb, secureDir, order)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+		changes += n
+		rows += loaded
+		lastFlush = time.Now()
+
+		if path != "" && committed != saved {
+			if err := binlog.WriteCheckpoint(path, committed); err != nil {
+				return err
+			}
+			saved = committed
+		}
+	}
+
+	slog.Info("cdc stopped", "position", saved, "changes", changes, "rows_loaded", rows)
+	return nil
+}
+
+// newCDCTable находит колонку nid таблицы в образах строк binlog и готовит поиск UUID загруженных строк
+func newCDCTable(ctx context.Context, srcDb, dstDb *sql.DB, t *tableTask) (*cdcTable, error) {
+	columns := dbx.MustTableColumns(ctx, srcDb, t.cfg.SrcTable)
+	nidColumn := slices.IndexFunc(columns, func(col string) bool { return strings.EqualFold(col, t.cfg.SrcNID) })
+	if nidColumn < 0 {
+		return nil, fmt.Errorf("source has no nid column %s", t.cfg.SrcNID)
+	}
+
+	return &cdcTable{
+		task:      t,
+		nidColumn: nidColumn,
+		columns:   len(columns),
+		resolver:  &dstResolver{db: dstDb, cfg: t.cfg, format: t.mapping.UUIDFormat},
+		pending:   make(map[uint64]struct{}),
+	}, nil
+}
+
+// collect запоминает nid строк события. У обновления учитываются оба образа: строка могла сменить nid
+func (c *cdcTable) collect(ev *binlog.RowsEvent) error {
+	if len(ev.Table.Types) != c.columns {
+		return fmt.Errorf("binlog row has %d columns, source table has %d: schema changed while capturing",
+			len(ev.Table.Types), c.columns)
+	}
+
+	for _, row := range ev.Rows {
+		found := false
+		for _, img := range []binlog.Image{row.Before, row.After} {
+			if img == nil {
+				continue
+			}
+			nid, ok, err := ev.Uint(img, c.nidColumn)
+			if err != nil {
+				return err
+			}
+			if ok {
+				c.pending[nid] = struct{}{}
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("binlog row has no %s value, set binlog_row_image = FULL on the source", c.task.cfg.SrcNID)
+		}
+	}
+	return nil
+}
+
+// applyChanges переносит накопленные изменения таблиц в порядке волн. Возвращает количество измененных nid
+// и загруженных строк
+func applyChanges(ctx context.Context, srcDb, dstDb *sql.DB, secureDir string, tables []*cdcTable) (uint64, uint64, error) {
+	var changes, loaded uint64
+	for _, c := range tables {
+		if len(c.pending) == 0 {
+			continue
+		}
+
+		start := time.Now()
+		nids := make([]uint64, 0, len(c.pending))
+		for nid := range c.pending {
+			nids = append(nids, nid)
+		}
+		slices.Sort(nids)
+
+		ranges := nidRanges(nids, cdcGap, refBatch)
+		var rows uint64
+		rest := nids
+		for _, r := range ranges {
+			// nid упорядочены, изменения диапазона идут первыми в остатке
+			k := 0
+			for k < len(rest) && rest[k] <= r.To {
+				k++
+			}
+			changed := rest[:k]
+			rest = rest[k:]
+
+			n, err := c.applyRange(ctx, srcDb, dstDb, secureDir, r, changed)
+			if err != nil {
+				return changes, loaded, fmt.Errorf("%s: apply changes (%d, %d]: %w", c.task.cfg.SrcTable, r.From, r.To, err)
+			}
+			rows += n
+		}
+
+		slog.Info("changes applied", "table", c.task.cfg.SrcTable, "nids", len(nids), "ranges", len(ranges),
+			"rows_loaded", rows, "duration", time.Since(start).Truncate(time.Millisecond))
+		clear(c.pending)
+		changes += uint64(len(nids))
+		loaded += rows
+	}
+	return changes, loaded, nil
+}
+
+// applyRange перечитывает диапазон из источника и заменяет им диапазон целевой таблицы в одной транзакции.
+// Если в источнике строк диапазона не осталось, диапазон удаляется. С -src-filter вместо диапазона заменяются
+// измененные строки changed и перечитанные строки: остальные строки диапазона в целевой таблице этот запуск не ведет
+func (c *cdcTable) applyRange(ctx context.Context, srcDb, dstDb *sql.DB, secureDir string, r ranger.Range, changed []uint64) (uint64, error) {
+	t := c.task
+	cfg, st := t.cfg, &t.stats
+	logger := slog.With("phase", phaseLoad, "table", cfg.SrcTable)
+
+	var rows uint64
+	retries, err := retryPolicy(cfg, logger, r).Do(ctx, func(int) error {
+		gen, err := c.keepUUIDs(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		rec := newUUIDRecorder(t)
+		path, written, err := processShardToCSV(ctx, srcDb, t, r.From, r.To, secureDir, gen, rec)
+		if err != nil {
+			return err
+		}
+
+		job := loadJob{task: t, Range: r, Path: path, Rows: written, Replace: true}
+		if cfg.SrcFilter != "" {
+			job.NIDs = slices.Clone(changed)
+		}
+
+		if written == 0 {
+			rows = 0
+			return deleteChanges(ctx, dstDb, cfg, job)
+		}
+		defer func() {
+			if err := util.SafeRemove(path, secureDir); err != nil {
+				logger.Warn("failed to remove staged file", "file", path, "err", err)
+			}
+		}()
+		st.staged(written)
+
+		if cfg.SrcFilter != "" {
+			staged, err := stagedNIDs(path, t.nidIndex+1)
+			if err != nil {
+				return err
+			}
+			job.NIDs = append(job.NIDs, staged...)
+			slices.Sort(job.NIDs)
+			job.NIDs = slices.Compact(job.NIDs)
+		}
+
+		if rows, err = insertFile(ctx, dstDb, job, cfg, t.mapping); err != nil {
+			return err
+		}
+		return rec.record(ctx)
+	})
+	st.retried(phaseLoad, retries)
+	if err != nil {
+		metricErrors.Inc(cfg.SrcTable, phaseLoad)
+		return 0, err
+	}
+
+	if rows > 0 {
+		st.loaded(rows)
+	}
+	return rows, nil
+}
+
+// deleteChanges удаляет из целевой таблицы строки диапазона, которых в источнике не осталось
+func deleteChanges(ctx context.Context, db *sql.DB, cfg config.Config, j loadJob) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := deleteReplaced(ctx, tx, cfg, j); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// keepUUIDs читает UUID строк диапазона, уже загруженных в целевую таблицу, и возвращает генератор UUID,
+// который их сохраняет
+func (c *cdcTable) keepUUIDs(ctx context.Context, r ranger.Range) (stagewriter.UUIDFunc, error) {
+	nids := make([]uint64, 0, r.To-r.From)
+	for nid := r.From + 1; nid <= r.To; nid++ {
+		nids = append(nids, nid)
+	}
+
+	entries, err := c.resolver.Resolve(ctx, c.task.cfg.SrcTable, nids, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := make(map[uint64]string, len(entries))
+	for _, e := range entries {
+		existing[e.NID] = e.UUID
+	}
+	return keepUUIDs(existing, c.task.mapping.UUIDFormat, c.task.nidIndex, c.task.uuidFunc), nil
+}
+
+// keepUUIDs возвращает генератор UUID, который строкам из existing (nid -> UUID в 32 hex-символах) оставляет
+// их UUID в формате format, а остальным формирует UUID через gen. Без этого обновленная строка получила бы
+// новый UUID, и ссылки на нее потерялись бы
+func keepUUIDs(existing map[uint64]string, format string, nidIndex int, gen stagewriter.UUIDFunc) stagewriter.UUIDFunc {
+	if gen == nil {
+		gen = randomUUID
+	}
+
+	return func(ts time.Time, values []any) (string, error) {
+		nid, err := nidValue(values[nidIndex])
+		if err != nil {
+			return "", err
+		}
+		if uuid, ok := existing[nid]; ok {
+			return uuidv7.Encode(uuid, format), nil
+		}
+		return gen(ts, values)
+	}
+}
+
+// nidRanges объединяет отсортированные nid в диапазоны (From, To]: соседние nid попадают в один диапазон,
+// если промежуток между ними не больше gap, а диапазон не длиннее span
+func nidRanges(nids []uint64, gap, span uint64) []ranger.Range {
+	var out []ranger.Range
+	for _, nid := range nids {
+		if n := len(out); n > 0 {
+			last := &out[n-1]
+			if nid == last.To {
+				continue
+			}
+			if nid-last.To <= gap && nid-last.From <= span {
+				last.To = nid
+				continue
+			}
+		}
+		out = append(out, ranger.Range{From: nid - 1, To: nid})
+	}
+	return out
+}
+
+// checkBinlog проверяет, что источник пишет binlog в формате ROW, и возвращает, есть ли у событий CRC32
+func checkBinlog(ctx context.Context, db *sql.DB) (bool, error) {
+	var format, checksum string
+	if err := db.QueryRowContext(ctx, "SELECT @@global.binlog_format, @@global.binlog_checksum").Scan(&format, &checksum); err != nil {
+		return false, fmt.Errorf("read binlog settings: %w", err)
+	}
+	if !strings.EqualFold(format, "ROW") {
+		return false, fmt.Errorf("binlog_format is %s, cdc requires ROW", format)
+	}
+	return strings.EqualFold(checksum, "CRC32"), nil
+}
+
+// checkpointPath возвращает путь к контрольной точке binlog запуска или пустую строку, если -journal-dir
+// не задан. Имя файла зависит от таблиц запуска так же, как имя журнала шардов
+func checkpointPath(cfg config.Config) string {
+	if cfg.JournalDir == "" {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, t := range cfg.Tables() {
+		k := journalKey(t)
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00%s\x00", k.SrcTable, k.SrcNID, k.SrcFilter, k.DstTable, k.DstNID)
+	}
+	return filepath.Join(cfg.JournalDir, "binlog_"+hex.EncodeToString(h.Sum(nil)[:4])+".json")
+}
+
+// cdcStart возвращает позицию, с которой читается binlog: из контрольной точки, из -binlog-start или текущую
+// позицию источника
+func cdcStart(ctx context.Context, db *sql.DB, cfg config.Config, path string) (binlog.Position, error) {
+	if path != "" {
+		pos, ok, err := binlog.ReadCheckpoint(path)
+		if err != nil {
+			return binlog.Position{}, err
+		}
+		if ok {
+			slog.Info("resuming from binlog checkpoint", "file", path, "position", pos)
+			return pos, nil
+		}
+	}
+
+	if cfg.BinlogStart != "" {
+		return binlog.ParsePosition(cfg.BinlogStart)
+	}
+
+	pos, err := binlogStatus(ctx, db)
+	if err != nil {
+		return binlog.Position{}, err
+	}
+	slog.Warn("starting from the current binlog position, earlier changes are not captured", "position", pos)
+	return pos, nil
+}
+
+// binlogStatus возвращает текущую позицию binlog источника. MySQL 8.4 заменил SHOW MASTER STATUS
+// на SHOW BINARY LOG STATUS
+func binlogStatus(ctx context.Context, db *sql.DB) (binlog.Position, error) {
+	var errs []error
+	for _, q := range []string{"SHOW MASTER STATUS", "SHOW BINARY LOG STATUS"} {
+		pos, err := queryBinlogStatus(ctx, db, q)
+		if err == nil {
+			return pos, nil
+		}
+		errs = append(errs, err)
+	}
+	return binlog.Position{}, fmt.Errorf("read binlog position: %w", errors.Join(errs...))
+}
+
+func queryBinlogStatus(ctx context.Context, db *sql.DB, q string) (binlog.Position, error) {
+	rows, err := db.QueryContext(ctx, q)
+	if err != nil {
+		return binlog.Position{}, err
+	}
+	defer rows.Close()
+
+	// Количество колонок зависит от версии сервера, нужны первые две: File и Position
+	cols, err := rows.Columns()
+	if err != nil {
+		return binlog.Position{}, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return binlog.Position{}, err
+		}
+		return binlog.Position{}, fmt.Errorf("binary logging is disabled on the source")
+	}
+
+	values := make([]sql.RawBytes, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return binlog.Position{}, err
+	}
+	if len(values) < 2 {
+		return binlog.Position{}, fmt.Errorf("unexpected %s result", q)
+	}
+
+	return binlog.ParsePosition(string(values[0]) + ":" + string(values[1]))
+}
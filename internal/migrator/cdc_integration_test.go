@@ -0,0 +1,142 @@
+//go:build integration
+
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Тест переноса изменений на живом MySQL: источник должен писать binlog в формате ROW, пользователь
+// источника - иметь права REPLICATION SLAVE и REPLICATION CLIENT. Запуск:
+//
+//	MIGRATOR_TEST_SRC_DSN='root:secret@tcp(127.0.0.1:3306)/cdc_src' \
+//	MIGRATOR_TEST_DST_DSN='root:secret@tcp(127.0.0.1:3306)/cdc_dst' \
+//	go test -tags integration ./internal/migrator -run CDC
+func TestCDCIntegration(t *testing.T) {
+	srcDSN, dstDSN := os.Getenv("MIGRATOR_TEST_SRC_DSN"), os.Getenv("MIGRATOR_TEST_DST_DSN")
+	if srcDSN == "" || dstDSN == "" {
+		t.Skip("MIGRATOR_TEST_SRC_DSN and MIGRATOR_TEST_DST_DSN are not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	srcDb := dbx.MustOpen(srcDSN, 4, false)
+	defer srcDb.Close()
+	dstDb := dbx.MustOpen(dstDSN, 4, false)
+	defer dstDb.Close()
+
+	mustExec(t, srcDb,
+		"DROP TABLE IF EXISTS cdc_log",
+		"CREATE TABLE cdc_log (id BIGINT NOT NULL PRIMARY KEY, created_at DATETIME NOT NULL, msg VARCHAR(100))",
+	)
+	mustExec(t, dstDb,
+		"DROP TABLE IF EXISTS cdc_log",
+		"CREATE TABLE cdc_log (id BINARY(16) NOT NULL PRIMARY KEY, nid BIGINT NOT NULL UNIQUE, created_at DATETIME NOT NULL, msg VARCHAR(100))",
+	)
+
+	// Изменения переносятся с позиции до первой вставки
+	pos, err := binlogStatus(ctx, srcDb)
+	if err != nil {
+		t.Fatalf("binlogStatus() error = %v", err)
+	}
+
+	journalDir := t.TempDir()
+	cfg := config.ParseConfig([]string{
+		"cdc",
+		"-src-dsn", srcDSN, "-dst-dsn", dstDSN,
+		"-src-table", "cdc_log", "-dst-table", "cdc_log",
+		"-cdc-server-id", "4242", "-binlog-start", pos.String(),
+		"-cdc-flush-interval", "200ms", "-journal-dir", journalDir,
+		"-progress-interval", "0",
+	})
+
+	cdcCtx, stop := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() { done <- CDC(cdcCtx, srcDb, dstDb, t.TempDir(), cfg) }()
+
+	mustExec(t, srcDb,
+		"INSERT INTO cdc_log VALUES (1, '2024-01-01 00:00:01', 'a'), (2, '2024-01-01 00:00:02', 'b'), (3, '2024-01-01 00:00:03', 'c')",
+	)
+	waitRows(t, dstDb, map[uint64]string{1: "a", 2: "b", 3: "c"})
+	uuid := rowUUID(t, dstDb, 2)
+
+	mustExec(t, srcDb,
+		"UPDATE cdc_log SET msg = 'b2' WHERE id = 2",
+		"DELETE FROM cdc_log WHERE id = 3",
+		"INSERT INTO cdc_log VALUES (4, '2024-01-01 00:00:04', 'd')",
+	)
+	waitRows(t, dstDb, map[uint64]string{1: "a", 2: "b2", 4: "d"})
+
+	if got := rowUUID(t, dstDb, 2); got != uuid {
+		t.Errorf("updated row UUID = %s, want %s", got, uuid)
+	}
+
+	stop()
+	if err := <-done; err != nil {
+		t.Fatalf("CDC() error = %v", err)
+	}
+
+	matches, _ := filepath.Glob(filepath.Join(journalDir, "binlog_*.json"))
+	if len(matches) != 1 {
+		t.Errorf("binlog checkpoints = %v, want one", matches)
+	}
+}
+
+func mustExec(t *testing.T, db *sql.DB, queries ...string) {
+	t.Helper()
+	for _, q := range queries {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+}
+
+// waitRows ждет, пока целевая таблица не совпадет с want (nid -> msg)
+func waitRows(t *testing.T, db *sql.DB, want map[uint64]string) {
+	t.Helper()
+
+	var got map[uint64]string
+	for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		got = make(map[uint64]string)
+		rows, err := db.Query("SELECT nid, msg FROM cdc_log")
+		if err != nil {
+			t.Fatalf("select: %v", err)
+		}
+		for rows.Next() {
+			var (
+				nid uint64
+				msg string
+			)
+			if err := rows.Scan(&nid, &msg); err != nil {
+				t.Fatalf("scan: %v", err)
+			}
+			got[nid] = msg
+		}
+		rows.Close()
+
+		if maps.Equal(got, want) {
+			return
+		}
+	}
+	t.Fatalf("destination rows = %v, want %v", got, want)
+}
+
+func rowUUID(t *testing.T, db *sql.DB, nid uint64) string {
+	t.Helper()
+
+	var uuid []byte
+	if err := db.QueryRow("SELECT id FROM cdc_log WHERE nid = ?", nid).Scan(&uuid); err != nil {
+		t.Fatalf("select UUID of %d: %v", nid, err)
+	}
+	return fmt.Sprintf("%x", uuid)
+}
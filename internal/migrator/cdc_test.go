@@ -0,0 +1,150 @@
+package migrator
+
+import (
+	"logs-migrator/internal/binlog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/ranger"
+	"logs-migrator/internal/uuidv7"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNIDRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		nids []uint64
+		gap  uint64
+		span uint64
+		want []ranger.Range
+	}{
+		{
+			name: "single nid",
+			nids: []uint64{42},
+			gap:  16,
+			span: 1000,
+			want: []ranger.Range{{From: 41, To: 42}},
+		},
+		{
+			name: "close nids share a range",
+			nids: []uint64{10, 11, 20, 36},
+			gap:  16,
+			span: 1000,
+			want: []ranger.Range{{From: 9, To: 36}},
+		},
+		{
+			name: "gap splits ranges",
+			nids: []uint64{10, 11, 100, 101},
+			gap:  16,
+			span: 1000,
+			want: []ranger.Range{{From: 9, To: 11}, {From: 99, To: 101}},
+		},
+		{
+			name: "span limits range length",
+			nids: []uint64{1, 2, 3, 4, 5},
+			gap:  16,
+			span: 3,
+			want: []ranger.Range{{From: 0, To: 3}, {From: 3, To: 5}},
+		},
+		{
+			name: "no nids",
+			gap:  16,
+			span: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nidRanges(tt.nids, tt.gap, tt.span); !slices.Equal(got, tt.want) {
+				t.Errorf("nidRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeepUUIDs(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	existing := map[uint64]string{1: "018cc251f4007000800000000000abcd"}
+
+	tests := []struct {
+		name   string
+		format string
+		nid    int64
+		check  func(string) bool
+	}{
+		{
+			name:   "loaded row keeps its UUID",
+			format: uuidv7.FormatHex,
+			nid:    1,
+			check:  func(u string) bool { return u == existing[1] },
+		},
+		{
+			name:   "loaded row keeps its UUID in column format",
+			format: uuidv7.FormatCanonical,
+			nid:    1,
+			check:  func(u string) bool { return u == uuidv7.Encode(existing[1], uuidv7.FormatCanonical) },
+		},
+		{
+			name:   "new row gets a fresh UUID",
+			format: uuidv7.FormatHex,
+			nid:    2,
+			check:  func(u string) bool { return len(u) == 32 && u != existing[1] && strings.HasPrefix(u, "018cc") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			uuid, err := keepUUIDs(existing, tt.format, 0, nil)(ts, []any{tt.nid})
+			if err != nil {
+				t.Fatalf("uuid func error = %v", err)
+			}
+			if !tt.check(uuid) {
+				t.Errorf("uuid = %s", uuid)
+			}
+		})
+	}
+
+	if _, err := keepUUIDs(existing, uuidv7.FormatHex, 0, nil)(ts, []any{nil}); err == nil {
+		t.Error("uuid func with NULL nid should fail")
+	}
+}
+
+func TestCDCCollect(t *testing.T) {
+	tm := &binlog.TableMap{Schema: "shop", Table: "log", Types: []byte{3, 15}, Meta: []uint16{0, 80}}
+	c := &cdcTable{
+		task:      &tableTask{cfg: config.Config{SrcTable: "log", SrcNID: "id"}},
+		nidColumn: 0,
+		columns:   2,
+		pending:   make(map[uint64]struct{}),
+	}
+
+	ev := &binlog.RowsEvent{Change: binlog.Update, Table: tm, Rows: []binlog.RowChange{
+		// Строка сменила nid: переносятся оба
+		{Before: binlog.Image{{5, 0, 0, 0}, []byte("\x01a")}, After: binlog.Image{{7, 0, 0, 0}, []byte("\x01a")}},
+		// binlog_row_image = MINIMAL: после изменения nid нет в образе
+		{Before: binlog.Image{{9, 0, 0, 0}, nil}, After: binlog.Image{nil, []byte("\x01b")}},
+	}}
+	if err := c.collect(ev); err != nil {
+		t.Fatalf("collect() error = %v", err)
+	}
+
+	var got []uint64
+	for nid := range c.pending {
+		got = append(got, nid)
+	}
+	slices.Sort(got)
+	if want := []uint64{5, 7, 9}; !slices.Equal(got, want) {
+		t.Errorf("pending = %v, want %v", got, want)
+	}
+
+	ev.Rows = []binlog.RowChange{{After: binlog.Image{nil, []byte("\x01c")}}}
+	if err := c.collect(ev); err == nil || !strings.Contains(err.Error(), "binlog_row_image") {
+		t.Errorf("collect() without nid error = %v", err)
+	}
+
+	c.columns = 3
+	if err := c.collect(ev); err == nil || !strings.Contains(err.Error(), "schema changed") {
+		t.Errorf("collect() with other column count error = %v", err)
+	}
+}
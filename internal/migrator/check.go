@@ -0,0 +1,133 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/schema"
+	"strings"
+)
+
+// Check проверяет совместимость схем таблиц запуска и печатает найденные расхождения. Возвращает ошибку,
+// если хотя бы в одной таблице есть блокирующие расхождения
+func Check(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+	w io.Writer,
+) error {
+	var errs []error
+	for _, tableCfg := range cfg.Tables() {
+		fmt.Fprintf(w, "%s -> %s\n", tableCfg.SrcTable, tableCfg.DstTable)
+
+		issues, err := checkTable(ctx, srcDb, dstDb, tableCfg)
+		if err != nil {
+			fmt.Fprintf(w, "  [error] %v\n", err)
+			errs = append(errs, fmt.Errorf("%s: %w", tableCfg.SrcTable, err))
+			continue
+		}
+
+		printIssues(w, issues)
+		if n := schema.CountBlocking(issues); n > 0 {
+			errs = append(errs, fmt.Errorf("%s: %d blocking schema issues", tableCfg.SrcTable, n))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// checkTable строит соответствие колонок таблицы и сравнивает схемы
+func checkTable(ctx context.Context, srcDb, dstDb *sql.DB, cfg config.Config) ([]schema.Issue, error) {
+	m, _, err := tableMapping(ctx, srcDb, dstDb, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return compareSchema(ctx, srcDb, dstDb, cfg, m)
+}
+
+// compareSchema читает схемы таблиц из INFORMATION_SCHEMA и сравнивает их по соответствию колонок
+func compareSchema(ctx context.Context, srcDb, dstDb *sql.DB, cfg config.Config, m dbx.ColumnMapping) ([]schema.Issue, error) {
+	src, err := dbx.TableSchema(ctx, srcDb, cfg.SrcTable)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err := dbx.TableSchema(ctx, dstDb, cfg.DstTable)
+	if err != nil {
+		return nil, err
+	}
+
+	return schema.Compare(schema.Tables{
+		Src:        pickColumns(src, cfg.SrcColumns),
+		Dst:        pickColumns(dst, cfg.DstColumns),
+		Mapping:    m,
+		Positional: len(cfg.ColumnMap) == 0 && len(cfg.DropColumns) == 0,
+		UUIDColumn: cfg.DstUuid,
+		SrcNID:     cfg.SrcNID,
+		DstNID:     cfg.DstNID,
+	}), nil
+}
+
+// preflightSchema проверяет схемы перед миграцией таблицы: расхождения пишутся в лог, блокирующие
+// останавливают миграцию, если не задан -skip-schema-check
+func preflightSchema(ctx context.Context, srcDb, dstDb *sql.DB, cfg config.Config, m dbx.ColumnMapping) error {
+	issues, err := compareSchema(ctx, srcDb, dstDb, cfg, m)
+	if err != nil {
+		return fmt.Errorf("schema check: %w", err)
+	}
+
+	for _, i := range issues {
+		level := slog.LevelWarn
+		if i.Severity == schema.Blocking {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "schema issue", "table", cfg.SrcTable, "column", i.Column, "issue", i.Message)
+	}
+
+	n := schema.CountBlocking(issues)
+	switch {
+	case n == 0:
+		return nil
+	case cfg.SkipSchemaCheck:
+		slog.Warn("blocking schema issues ignored", "table", cfg.SrcTable, "issues", n)
+		return nil
+	default:
+		return fmt.Errorf("schema check: %d blocking issues, see log or run the check command", n)
+	}
+}
+
+// pickColumns оставляет колонки из списка names в его порядке. Пустой список - все колонки таблицы
+func pickColumns(columns []dbx.ColumnInfo, names []string) []dbx.ColumnInfo {
+	if len(names) == 0 {
+		return columns
+	}
+
+	out := make([]dbx.ColumnInfo, 0, len(names))
+	for _, name := range names {
+		for _, c := range columns {
+			if strings.EqualFold(c.Name, name) {
+				out = append(out, c)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// printIssues печатает расхождения схем с отступом
+func printIssues(w io.Writer, issues []schema.Issue) {
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "  compatible")
+		return
+	}
+	for _, i := range issues {
+		fmt.Fprintf(w, "  %s\n", i)
+	}
+}
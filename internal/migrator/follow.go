@@ -0,0 +1,209 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"logs-migrator/internal/budget"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/ranger"
+	"logs-migrator/internal/retry"
+	"time"
+)
+
+// followIdleTime сколько простаивающее между опросами соединение остается в пуле. При редких опросах
+// соединения закрываются раньше, чем их оборвет wait_timeout сервера
+const followIdleTime = time.Minute
+
+// follow после основной миграции опрашивает источник с периодом -poll-interval и переносит строки с ID за
+// последним запланированным шардом каждой таблицы. Отмена ctx (SIGINT, SIGTERM) останавливает слежение без
+// ошибки: шарды, прерванные посреди загрузки, остаются в журнале и догружаются при следующем запуске
+func follow(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	secureDir string,
+	cfg config.Config,
+	bud *budget.Budget,
+	tasks []*tableTask,
+) error {
+	waves, err := taskWaves(cfg, tasks)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tasks {
+		t.followFrom = followStart(ctx, dstDb, t)
+	}
+
+	srcDb.SetConnMaxIdleTime(followIdleTime)
+	dstDb.SetConnMaxIdleTime(followIdleTime)
+
+	slog.Info("following source for new rows", "poll_interval", cfg.PollInterval, "chunk", cfg.FollowChunk)
+
+	var polls, rows uint64
+	for {
+		n, err := followPoll(ctx, srcDb, dstDb, secureDir, cfg, bud, waves)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return err
+		}
+		polls++
+		rows += n
+
+		timer := time.NewTimer(cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	slog.Info("follow stopped", "polls", polls, "rows_loaded", rows)
+	return nil
+}
+
+// followStart возвращает ID, после которого начинается слежение за таблицей: граница последнего шарда
+// основной миграции или журнала, а если их нет - MAX(nid) целевой таблицы
+func followStart(ctx context.Context, dstDb *sql.DB, t *tableTask) uint64 {
+	from := t.jr.MaxTo()
+	for _, sh := range t.shards {
+		from = max(from, sh.To)
+	}
+	if from > 0 {
+		return from
+	}
+
+	return dbx.MustMaxPk(ctx, dstDb, t.cfg.DstTable, t.cfg.DstNID)
+}
+
+// followPoll планирует шарды по новым строкам таблиц и мигрирует их волнами. Возвращает количество
+// загруженных строк
+func followPoll(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	secureDir string,
+	cfg config.Config,
+	bud *budget.Budget,
+	waves [][]*tableTask,
+) (uint64, error) {
+	start := time.Now()
+
+	// MAX(nid) дочерних таблиц читается раньше родительских: строка, которую увидел опрос дочерней таблицы,
+	// ссылается на родителя, уже видимого опросу родительской
+	var shards int
+	for i := len(waves) - 1; i >= 0; i-- {
+		for _, t := range waves[i] {
+			fresh, err := followShards(ctx, srcDb, cfg, t)
+			if err != nil {
+				return 0, fmt.Errorf("%s: %w", t.cfg.SrcTable, err)
+			}
+			t.shards = fresh
+			shards += len(fresh)
+		}
+	}
+	if shards == 0 {
+		slog.Debug("no new rows to follow")
+		return 0, nil
+	}
+
+	var before uint64
+	for _, wave := range waves {
+		for _, t := range wave {
+			before += t.stats.rowsLoaded.Load()
+		}
+	}
+
+	for _, wave := range waves {
+		if err := runWave(ctx, srcDb, dstDb, secureDir, cfg, bud, wave); err != nil {
+			return 0, err
+		}
+	}
+
+	var after uint64
+	for _, wave := range waves {
+		for _, t := range wave {
+			after += t.stats.rowsLoaded.Load()
+		}
+	}
+
+	slog.Info("follow poll done", "shards", shards, "rows_loaded", after-before, "duration", time.Since(start).Truncate(time.Millisecond))
+	return after - before, nil
+}
+
+// followMark MAX(nid) источника и время опроса, который его увидел
+type followMark struct {
+	id uint64
+	at time.Time
+}
+
+// followTarget запоминает MAX(nid) очередного опроса и возвращает ID, до которого можно переносить строки:
+// последний MAX(nid), увиденный не позже чем lag назад. Автоинкремент выдается до фиксации транзакции, поэтому
+// строка с меньшим ID может стать видна позже строки с большим; за lag такие транзакции успевают
+// зафиксироваться. Возвращает и оставшиеся отметки
+func followTarget(seen []followMark, maxID uint64, now time.Time, lag time.Duration) (uint64, []followMark) {
+	if n := len(seen); n == 0 || maxID > seen[n-1].id {
+		seen = append(seen, followMark{id: maxID, at: now})
+	}
+
+	var target uint64
+	keep := 0
+	for i, m := range seen {
+		if now.Sub(m.at) < lag {
+			break
+		}
+		target, keep = m.id, i
+	}
+	return target, seen[keep:]
+}
+
+// followShards делит новые ID таблицы на шарды по -follow-chunk и записывает их в журнал
+func followShards(ctx context.Context, srcDb *sql.DB, cfg config.Config, t *tableTask) ([]ranger.Range, error) {
+	// Опрос повторяется после временных ошибок так же, как шарды, чтобы обрыв соединения не останавливал слежение
+	policy := retry.Policy{
+		Attempts:   cfg.Retries,
+		Backoff:    cfg.RetryBackoff,
+		MaxBackoff: cfg.RetryMaxBackoff,
+		Retryable:  dbx.IsTransient,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			slog.Warn("transient error, retrying poll",
+				"table", t.cfg.SrcTable, "attempt", attempt, "retries", cfg.Retries, "delay", delay, "err", err)
+		},
+	}
+
+	var maxID uint64
+	if _, err := policy.Do(ctx, func(int) error {
+		var err error
+		_, maxID, err = dbx.PKRange(ctx, srcDb, t.cfg.SrcTable, t.cfg.SrcNID, t.cfg.SrcFilter)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if maxID <= t.followFrom {
+		return nil, nil
+	}
+
+	var target uint64
+	target, t.followSeen = followTarget(t.followSeen, maxID, time.Now(), cfg.FollowLag)
+	if target <= t.followFrom {
+		slog.Debug("new rows wait for follow lag", "table", t.cfg.SrcTable, "from", t.followFrom, "max", maxID, "lag", cfg.FollowLag)
+		return nil, nil
+	}
+
+	fresh := ranger.Split(t.followFrom+1, target, uint64(cfg.FollowChunk))
+	if err := t.jr.Plan(fresh); err != nil {
+		return nil, err
+	}
+	slog.Info("new rows to follow", "table", t.cfg.SrcTable, "from", t.followFrom, "to", target, "max", maxID, "shards", len(fresh))
+	t.followFrom = target
+
+	return fresh, nil
+}
@@ -0,0 +1,120 @@
+package migrator
+
+import (
+	"context"
+	"logs-migrator/internal/journal"
+	"logs-migrator/internal/ranger"
+	"testing"
+	"time"
+)
+
+func TestFollowStart(t *testing.T) {
+	jr, err := journal.Open(t.TempDir(), journal.Key{SrcTable: "log", SrcNID: "id", DstTable: "log", DstNID: "nid"})
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	defer jr.Close()
+	if err := jr.Plan([]ranger.Range{{From: 0, To: 100}, {From: 100, To: 200}}); err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		task *tableTask
+		want uint64
+	}{
+		{
+			name: "last shard of the run",
+			task: &tableTask{shards: []ranger.Range{{From: 200, To: 300}, {From: 100, To: 150}}},
+			want: 300,
+		},
+		{
+			name: "journal without new shards",
+			task: &tableTask{jr: jr},
+			want: 200,
+		},
+		{
+			name: "pending shards below the journal",
+			task: &tableTask{jr: jr, shards: []ranger.Range{{From: 100, To: 200}}},
+			want: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Целевая БД нужна, только если нет ни журнала, ни шардов
+			if got := followStart(context.Background(), nil, tt.task); got != tt.want {
+				t.Errorf("followStart() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowTarget(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		seen     []followMark
+		maxID    uint64
+		now      time.Time
+		lag      time.Duration
+		want     uint64
+		wantSeen int
+	}{
+		{
+			name:     "no lag migrates up to MAX",
+			maxID:    100,
+			now:      t0,
+			want:     100,
+			wantSeen: 1,
+		},
+		{
+			name:     "fresh MAX waits for lag",
+			maxID:    100,
+			now:      t0,
+			lag:      30 * time.Second,
+			want:     0,
+			wantSeen: 1,
+		},
+		{
+			name:     "MAX seen before lag is migrated",
+			seen:     []followMark{{id: 100, at: t0}, {id: 150, at: t0.Add(20 * time.Second)}},
+			maxID:    200,
+			now:      t0.Add(40 * time.Second),
+			lag:      30 * time.Second,
+			want:     100,
+			wantSeen: 3,
+		},
+		{
+			name:     "older marks are dropped",
+			seen:     []followMark{{id: 100, at: t0}, {id: 150, at: t0.Add(20 * time.Second)}},
+			maxID:    200,
+			now:      t0.Add(55 * time.Second),
+			lag:      30 * time.Second,
+			want:     150,
+			wantSeen: 2,
+		},
+		{
+			name:     "same MAX is not recorded twice",
+			seen:     []followMark{{id: 100, at: t0}},
+			maxID:    100,
+			now:      t0.Add(10 * time.Second),
+			lag:      30 * time.Second,
+			want:     0,
+			wantSeen: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, seen := followTarget(tt.seen, tt.maxID, tt.now, tt.lag)
+			if got != tt.want {
+				t.Errorf("followTarget() = %d, want %d", got, tt.want)
+			}
+			if len(seen) != tt.wantSeen {
+				t.Errorf("followTarget() kept %d marks, want %d", len(seen), tt.wantSeen)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/uuidmap"
+	"logs-migrator/internal/uuidv7"
+	"strings"
+	"sync/atomic"
+)
+
+// refBatch nid родительских строк в одном запросе поиска UUID
+const refBatch = 1000
+
+// orphanSample сколько nid строк без родителя шарда попадает в лог
+const orphanSample = 10
+
+// foreignKey внешний ключ дочерней таблицы, привязанный к родительской таблице запуска
+type foreignKey struct {
+	config.ForeignKey
+
+	// index индекс поля с nid родительской строки
+	index int
+
+	// format формат UUID родителя, в котором значение попадает в CSV, resolver ищет UUID родительских строк
+	// в карте UUID или в целевой таблице родителя
+	format   string
+	resolver uuidmap.Resolver
+
+	// orphans количество строк без родителя, повторы шардов учитываются повторно
+	orphans atomic.Uint64
+}
+
+// foreignKeys находит поля внешних ключей таблицы. tableMapping уже пометил их в соответствии
+func foreignKeys(cfg config.Config, m *dbx.ColumnMapping) ([]*foreignKey, error) {
+	fks := make([]*foreignKey, 0, len(cfg.ForeignKeys))
+	for _, fk := range cfg.ForeignKeys {
+		i, err := m.SetRef(fk.Column)
+		if err != nil {
+			return nil, err
+		}
+		fks = append(fks, &foreignKey{ForeignKey: fk, index: i})
+	}
+	return fks, nil
+}
+
+// linkForeignKeys привязывает внешние ключи таблиц к родительским таблицам: определяет формат UUID родителя
+// и где искать UUID его строк. С -uuid-map-table UUID ищутся в карте UUID, иначе - в целевой таблице родителя
+// по колонке -dst-nid
+func linkForeignKeys(ctx context.Context, dstDb *sql.DB, cfg config.Config, tasks []*tableTask) error {
+	for _, t := range tasks {
+		for _, fk := range t.fks {
+			parent := findTask(tasks, fk.Parent)
+			if parent == nil {
+				return fmt.Errorf("%s: parent table %s is not migrated in this run", t.cfg.SrcTable, fk.Parent)
+			}
+
+			dstSchema, err := dbx.TableSchema(ctx, dstDb, parent.cfg.DstTable)
+			if err != nil {
+				return err
+			}
+			if fk.format, err = uuidFormat(parent.cfg, dstSchema); err != nil {
+				return fmt.Errorf("%s: %w", parent.cfg.SrcTable, err)
+			}
+
+			// Внешний ключ хранит UUID родителя в том же формате, что и колонка UUID родителя
+			f := t.mapping.Fields[fk.index]
+			if f.Type == nil {
+				return fmt.Errorf("%s: destination %s has no column %s", t.cfg.SrcTable, t.cfg.DstTable, f.Dst)
+			}
+			if !dbx.UUIDFormatFits(fk.format, *f.Type) {
+				return fmt.Errorf("%s: foreign key column %s %s cannot store %s UUIDs of %s",
+					t.cfg.SrcTable, f.Dst, f.Type.ColumnType, fk.format, parent.cfg.DstTable)
+			}
+
+			if cfg.UUIDMapTable != "" {
+				fk.resolver = uuidmap.NewTable(dstDb, cfg.UUIDMapTable)
+			} else {
+				fk.resolver = &dstResolver{db: dstDb, cfg: parent.cfg, format: fk.format}
+			}
+		}
+	}
+	return nil
+}
+
+func findTask(tasks []*tableTask, srcTable string) *tableTask {
+	for _, t := range tasks {
+		if t.cfg.SrcTable == srcTable {
+			return t
+		}
+	}
+	return nil
+}
+
+// shardRefs UUID родительских строк, на которые ссылаются строки шарда по внешнему ключу fk, и строки без родителя
+type shardRefs struct {
+	fk      *foreignKey
+	uuids   map[uint64]string
+	orphans uint64
+	sample  []uint64
+}
+
+// resolveRefs находит UUID родительских строк, на которые ссылаются строки шарда (from, to]: собирает различные
+// nid родителей запросом к источнику и ищет их UUID пачками по refBatch
+func resolveRefs(ctx context.Context, db *sql.DB, t *tableTask, from, to uint64) ([]*shardRefs, error) {
+	cfg := t.cfg
+	refs := make([]*shardRefs, 0, len(t.fks))
+
+	for _, fk := range t.fks {
+		nids, err := distinctNIDs(ctx, db, cfg, t.mapping.Fields[fk.index].Src, from, to)
+		if err != nil {
+			return nil, fmt.Errorf("foreign key %s: %w", fk.Column, err)
+		}
+
+		r := &shardRefs{fk: fk, uuids: make(map[uint64]string, len(nids))}
+		for len(nids) > 0 {
+			n := min(len(nids), refBatch)
+			entries, err := fk.resolver.Resolve(ctx, fk.Parent, nids[:n], nil)
+			if err != nil {
+				return nil, fmt.Errorf("foreign key %s: %w", fk.Column, err)
+			}
+			for _, e := range entries {
+				r.uuids[e.NID] = uuidv7.Encode(e.UUID, fk.format)
+			}
+			nids = nids[n:]
+		}
+		refs = append(refs, r)
+	}
+
+	return refs, nil
+}
+
+// distinctNIDs возвращает различные непустые значения колонки column в шарде (from, to]
+func distinctNIDs(ctx context.Context, db *sql.DB, cfg config.Config, column string, from, to uint64) ([]uint64, error) {
+	rows, err := db.QueryContext(ctx, dbx.BuildDistinctByRange(cfg.SrcTable, column, cfg.SrcNID, cfg.SrcFilter), from, to)
+	if err != nil {
+		return nil, fmt.Errorf("query parent nids: %w", err)
+	}
+	defer rows.Close()
+
+	var nids []uint64
+	for rows.Next() {
+		var v any
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("scan parent nid: %w", err)
+		}
+		nid, err := nidValue(v)
+		if err != nil {
+			return nil, err
+		}
+		nids = append(nids, nid)
+	}
+	return nids, rows.Err()
+}
+
+// rewriteRefs заменяет nid родителей в строке на их UUID. Строку без родителя по on_orphan внешнего ключа
+// пропускает (keep = false), загружает с NULL или останавливает миграцию ошибкой
+func rewriteRefs(refs []*shardRefs, values []any) (keep bool, err error) {
+	for _, r := range refs {
+		v := values[r.fk.index]
+		if v == nil {
+			continue
+		}
+
+		nid, err := nidValue(v)
+		if err != nil {
+			return false, fmt.Errorf("foreign key %s: %w", r.fk.Column, err)
+		}
+		if uuid, ok := r.uuids[nid]; ok {
+			values[r.fk.index] = uuid
+			continue
+		}
+
+		r.orphans++
+		if len(r.sample) < orphanSample {
+			r.sample = append(r.sample, nid)
+		}
+
+		switch r.fk.Orphan() {
+		case config.OrphanFail:
+			return false, fmt.Errorf("foreign key %s: %s has no row with nid %d, set on_orphan to null or skip to continue", r.fk.Column, r.fk.Parent, nid)
+		case config.OrphanNull:
+			values[r.fk.index] = nil
+		default:
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// reportOrphans учитывает строки без родителя выгруженного шарда и пишет их в лог
+func reportOrphans(table string, from, to uint64, refs []*shardRefs) {
+	for _, r := range refs {
+		if r.orphans == 0 {
+			continue
+		}
+		r.fk.orphans.Add(r.orphans)
+
+		sample := make([]string, 0, len(r.sample))
+		for _, nid := range r.sample {
+			sample = append(sample, fmt.Sprint(nid))
+		}
+		slog.Warn("rows without parent",
+			"table", table, "column", r.fk.Column, "parent", r.fk.Parent, "from", from, "to", to,
+			"rows", r.orphans, "action", r.fk.Orphan(), "parent_nids", strings.Join(sample, ","))
+	}
+}
@@ -0,0 +1,75 @@
+package migrator
+
+import (
+	"logs-migrator/internal/config"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteRefs(t *testing.T) {
+	const parentUUID = "0190c2a1-b2c3-7d4e-8f9a-0b1c2d3e4f50"
+
+	tests := []struct {
+		name        string
+		orphan      string
+		row         []any
+		want        []any
+		wantKeep    bool
+		wantOrphans uint64
+		wantErr     string
+	}{
+		{name: "parent found", row: []any{int64(1), []byte("7")}, want: []any{int64(1), parentUUID}, wantKeep: true},
+		{name: "NULL reference", row: []any{int64(1), nil}, want: []any{int64(1), nil}, wantKeep: true},
+		{name: "orphan skipped", orphan: config.OrphanSkip, row: []any{int64(1), int64(8)}, want: []any{int64(1), int64(8)}, wantOrphans: 1},
+		{name: "orphan with NULL", orphan: config.OrphanNull, row: []any{int64(1), int64(8)}, want: []any{int64(1), nil}, wantKeep: true, wantOrphans: 1},
+		{name: "orphan fails", orphan: config.OrphanFail, row: []any{int64(1), int64(8)}, wantErr: "log has no row with nid 8"},
+		{name: "orphan fails by default", row: []any{int64(1), int64(8)}, wantErr: "log has no row with nid 8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fk := &foreignKey{ForeignKey: config.ForeignKey{Column: "log_id", Parent: "log", OnOrphan: tt.orphan}, index: 1}
+			refs := []*shardRefs{{fk: fk, uuids: map[uint64]string{7: parentUUID}}}
+
+			keep, err := rewriteRefs(refs, tt.row)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("rewriteRefs() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("rewriteRefs() error = %v", err)
+			}
+			if keep != tt.wantKeep || !reflect.DeepEqual(tt.row, tt.want) {
+				t.Errorf("rewriteRefs() = %v, row %#v, want %v, row %#v", keep, tt.row, tt.wantKeep, tt.want)
+			}
+
+			reportOrphans("log_tag", 0, 10, refs)
+			if got := fk.orphans.Load(); got != tt.wantOrphans {
+				t.Errorf("orphans = %d, want %d", got, tt.wantOrphans)
+			}
+		})
+	}
+}
+
+func TestTaskWaves(t *testing.T) {
+	cfg := config.Config{Jobs: []config.TableJob{
+		{SrcTable: "log_tag", ForeignKeys: []config.ForeignKey{{Column: "log_id", Parent: "log"}}},
+		{SrcTable: "log"},
+	}}
+	tasks := []*tableTask{{cfg: config.Config{SrcTable: "log_tag"}}, {cfg: config.Config{SrcTable: "log"}}}
+
+	waves, err := taskWaves(cfg, tasks)
+	if err != nil {
+		t.Fatalf("taskWaves() error = %v", err)
+	}
+	if len(waves) != 2 || waves[0][0] != tasks[1] || waves[1][0] != tasks[0] {
+		t.Errorf("taskWaves() = %v, want log before log_tag", waves)
+	}
+
+	if waves, _ := taskWaves(config.Config{}, tasks[:1]); len(waves) != 1 {
+		t.Errorf("taskWaves() without job file = %d waves, want 1", len(waves))
+	}
+}
@@ -0,0 +1,127 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/ranger"
+)
+
+// gap диапазон ID, в котором в целевой таблице строк меньше, чем в источнике
+type gap struct {
+	Range ranger.Range
+	Src   uint64
+	Dst   uint64
+}
+
+// findGaps сравнивает количество строк в источнике и целевой таблице по каждому шарду
+// и возвращает шарды, в которых целевой таблице не хватает строк. С -src-filter в целевой таблице считаются
+// только строки с nid строк источника (см. dstChecksum)
+func findGaps(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+) ([]gap, error) {
+	minID, maxID := dbx.MustPKRange(ctx, srcDb, cfg.SrcTable, cfg.SrcNID, cfg.SrcFilter)
+	if maxID == 0 || maxID < minID {
+		return nil, nil
+	}
+
+	shards, err := splitRange(ctx, srcDb, cfg, minID, maxID)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("checking coverage", "shards", len(shards), "min", minID, "max", maxID)
+
+	results := make([]gap, len(shards))
+	err = forEachShard(ctx, shards, cfg.StageWorkers, func(ctx context.Context, idx int, sh ranger.Range) error {
+		srcCount, err := dbx.CountByRange(ctx, srcDb, cfg.SrcTable, cfg.SrcNID, cfg.SrcFilter, sh.From, sh.To)
+		if err != nil {
+			return err
+		}
+
+		dstCount, _, err := dstChecksum(ctx, srcDb, dstDb, cfg, nil, sh)
+		if err != nil {
+			return err
+		}
+
+		results[idx] = gap{Range: sh, Src: srcCount, Dst: dstCount}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var gaps []gap
+	for _, r := range results {
+		switch {
+		case r.Dst < r.Src:
+			slog.Info("gap found", "from", r.Range.From, "to", r.Range.To, "src_rows", r.Src, "dst_rows", r.Dst)
+			gaps = append(gaps, r)
+		case r.Dst > r.Src:
+			slog.Warn("destination has more rows than source", "from", r.Range.From, "to", r.Range.To, "src_rows", r.Src, "dst_rows", r.Dst)
+		}
+	}
+
+	return gaps, nil
+}
+
+// dstChecksum считает количество строк и контрольную сумму колонок целевой таблицы в шарде. С -src-filter
+// в диапазоне целевой таблицы могут быть строки, которые этот запуск не переносит, поэтому считаются только
+// строки с nid строк источника, подходящих под фильтр
+func dstChecksum(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+	columns []string,
+	sh ranger.Range,
+) (uint64, uint64, error) {
+	if cfg.SrcFilter == "" {
+		return dbx.ChecksumByRange(ctx, dstDb, cfg.DstTable, columns, cfg.DstNID, "", sh.From, sh.To)
+	}
+
+	nids, err := distinctNIDs(ctx, srcDb, cfg, cfg.SrcNID, sh.From, sh.To)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Количество строк и сумма CRC32 складываются по частям списка
+	var count, sum uint64
+	for len(nids) > 0 {
+		n := min(len(nids), refBatch)
+		c, s, err := dbx.ChecksumByRange(ctx, dstDb, cfg.DstTable, columns, cfg.DstNID, dbx.IDsFilter(cfg.DstNID, nids[:n]), sh.From, sh.To)
+		if err != nil {
+			return 0, 0, err
+		}
+		count += c
+		sum += s
+		nids = nids[n:]
+	}
+	return count, sum, nil
+}
+
+// printRepairedGaps печатает список восстановленных диапазонов
+func printRepairedGaps(table string, gaps []gap) {
+	var missing uint64
+	for _, g := range gaps {
+		missing += g.Src - g.Dst
+	}
+
+	slog.Info("gaps repaired", "table", table, "ranges", len(gaps), "missing_rows", missing)
+	for _, g := range gaps {
+		slog.Info("repaired range", "table", table, "from", g.Range.From, "to", g.Range.To, "src_rows", g.Src, "dst_rows", g.Dst)
+	}
+}
+
+// gapRanges возвращает диапазоны шардов с пропусками
+func gapRanges(gaps []gap) []ranger.Range {
+	out := make([]ranger.Range, 0, len(gaps))
+	for _, g := range gaps {
+		out = append(out, g.Range)
+	}
+	return out
+}
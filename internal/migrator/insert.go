@@ -0,0 +1,140 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"os"
+	"time"
+)
+
+// maxPlaceholders ограничение MySQL на количество плейсхолдеров в одном prepared statement
+const maxPlaceholders = 65535
+
+// insertFile загружает временный CSV-файл в целевую БД пачками multi-row INSERT через prepared statements.
+// Используется, когда на сервере недоступны и LOAD DATA INFILE, и LOAD DATA LOCAL INFILE. Весь файл
+// загружается в одной транзакции, чтобы ошибка посреди файла не оставила частично загруженный шард
+func insertFile(ctx context.Context, db *sql.DB, j loadJob, cfg config.Config, m dbx.ColumnMapping) (uint64, error) {
+	if len(m.Fields) == 0 {
+		return 0, fmt.Errorf("destination table has no columns")
+	}
+
+	// Поля CSV, которые передаются в INSERT: UUID и загружаемые поля соответствия
+	fields := []int{0}
+	for _, i := range m.Loaded() {
+		fields = append(fields, i+1)
+	}
+	recordLen := len(m.Fields) + 1
+
+	file, err := os.Open(j.Path)
+	if err != nil {
+		return 0, fmt.Errorf("open staged file: %w", err)
+	}
+	defer file.Close()
+
+	batchSize := insertBatchSize(cfg.InsertBatch, len(fields))
+
+	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	defer cancel()
+
+	tx, err := db.BeginTx(loadCtx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// При восстановлении пропусков и повторе сначала удаляем строки неполного шарда
+	if cfg.RepairGaps || j.Replace {
+		if err := deleteReplaced(loadCtx, tx, cfg, j); err != nil {
+			return 0, err
+		}
+	}
+
+	batchStmt, err := tx.PrepareContext(loadCtx, dbx.BuildInsertSQL(cfg.DstTable, cfg.DstUuid, m, batchSize))
+	if err != nil {
+		return 0, fmt.Errorf("prepare insert: %w", err)
+	}
+	defer batchStmt.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	args := make([]any, 0, batchSize*len(fields))
+	var inserted uint64
+
+	flush := func(rows int) error {
+		if rows == 0 {
+			return nil
+		}
+
+		stmt := batchStmt
+		if rows < batchSize {
+			// Хвост файла вставляем отдельным запросом на оставшееся количество строк
+			tail, err := tx.PrepareContext(loadCtx, dbx.BuildInsertSQL(cfg.DstTable, cfg.DstUuid, m, rows))
+			if err != nil {
+				return fmt.Errorf("prepare insert: %w", err)
+			}
+			defer tail.Close()
+			stmt = tail
+		}
+
+		if _, err := stmt.ExecContext(loadCtx, args...); err != nil {
+			return fmt.Errorf("insert: %w", err)
+		}
+
+		inserted += uint64(rows)
+		args = args[:0]
+		return nil
+	}
+
+	rows := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, fmt.Errorf("read staged file: %w", err)
+		}
+
+		if len(record) < recordLen {
+			return 0, fmt.Errorf("staged row has %d fields, destination expects %d", len(record), recordLen)
+		}
+
+		for _, i := range fields {
+			args = append(args, record[i])
+		}
+
+		rows++
+		if rows == batchSize {
+			if err := flush(rows); err != nil {
+				return 0, err
+			}
+			rows = 0
+		}
+	}
+
+	if err := flush(rows); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+
+	return inserted, nil
+}
+
+// insertBatchSize ограничивает размер пачки так, чтобы не превысить лимит плейсхолдеров
+func insertBatchSize(batch, columns int) int {
+	if limit := maxPlaceholders / columns; batch > limit {
+		return limit
+	}
+	return batch
+}
@@ -0,0 +1,90 @@
+package migrator
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestInsertBatchSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		batch    int
+		columns  int
+		expected int
+	}{
+		{
+			name:     "batch fits placeholder limit",
+			batch:    1000,
+			columns:  10,
+			expected: 1000,
+		},
+		{
+			name:     "batch is capped by placeholder limit",
+			batch:    10000,
+			columns:  10,
+			expected: 6553,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := insertBatchSize(tt.batch, tt.columns)
+			if result != tt.expected {
+				t.Errorf("insertBatchSize(%d, %d) = %d, want %d", tt.batch, tt.columns, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestStagedNIDs(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		field    int
+		expected []uint64
+		wantErr  bool
+	}{
+		{
+			name:     "nid after UUID",
+			content:  "0190a1b2c3d4e5f60718293a4b5c6d7e,10,a\n0190a1b2c3d4e5f60718293a4b5c6d7f,12,\"b,c\"\n",
+			field:    1,
+			expected: []uint64{10, 12},
+		},
+		{
+			name:    "empty file",
+			content: "",
+			field:   1,
+		},
+		{
+			name:    "missing field",
+			content: "0190a1b2c3d4e5f60718293a4b5c6d7e\n",
+			field:   1,
+			wantErr: true,
+		},
+		{
+			name:    "not a number",
+			content: "0190a1b2c3d4e5f60718293a4b5c6d7e,abc\n",
+			field:   1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "shard.csv")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := stagedNIDs(path, tt.field)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("stagedNIDs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(result, tt.expected) {
+				t.Errorf("stagedNIDs() = %v, want %v", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/uuidmap"
+	"logs-migrator/internal/uuidv7"
+	"slices"
+	"strconv"
+)
+
+// Lookup ищет nid и UUID из аргументов команды среди строк таблицы -src-table и печатает найденные пары
+// "таблица, nid, UUID" через табуляцию. Поиск идет по карте UUID (-uuid-map-file или -uuid-map-table), а без
+// нее - по колонкам -dst-nid и -dst-uuid целевой таблицы. Возвращает ошибку, если какой-то ключ не найден
+func Lookup(ctx context.Context, dstDb *sql.DB, cfg config.Config, w io.Writer) error {
+	nids, uuids, err := parseLookupKeys(cfg.LookupKeys)
+	if err != nil {
+		return err
+	}
+
+	resolver, err := lookupResolver(ctx, dstDb, cfg)
+	if err != nil {
+		return err
+	}
+
+	entries, err := resolver.Resolve(ctx, cfg.SrcTable, nids, uuids)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", e.Table, e.NID, e.Canonical())
+	}
+
+	missing := missingKeys(entries, nids, uuids)
+	for _, key := range missing {
+		slog.Warn("key not found", "table", cfg.SrcTable, "key", key)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%d of %d keys not found", len(missing), len(cfg.LookupKeys))
+	}
+
+	return nil
+}
+
+// parseLookupKeys делит аргументы на nid (только цифры) и UUID (32 hex-символа, с дефисами или без)
+func parseLookupKeys(keys []string) (nids []uint64, uuids []string, err error) {
+	for _, key := range keys {
+		if nid, err := strconv.ParseUint(key, 10, 64); err == nil {
+			nids = append(nids, nid)
+			continue
+		}
+
+		u, err := uuidmap.ParseUUID(key)
+		if err != nil {
+			return nil, nil, fmt.Errorf("lookup key is neither nid nor UUID: %q", key)
+		}
+		uuids = append(uuids, u)
+	}
+
+	return nids, uuids, nil
+}
+
+// missingKeys возвращает ключи, для которых нет записи
+func missingKeys(entries []uuidmap.Entry, nids []uint64, uuids []string) []string {
+	var missing []string
+	for _, nid := range nids {
+		if !slices.ContainsFunc(entries, func(e uuidmap.Entry) bool { return e.NID == nid }) {
+			missing = append(missing, strconv.FormatUint(nid, 10))
+		}
+	}
+	for _, u := range uuids {
+		if !slices.ContainsFunc(entries, func(e uuidmap.Entry) bool { return e.UUID == u }) {
+			missing = append(missing, uuidmap.Entry{UUID: u}.Canonical())
+		}
+	}
+	return missing
+}
+
+// lookupResolver выбирает, где искать: в файле карты, в таблице карты или в целевой таблице
+func lookupResolver(ctx context.Context, dstDb *sql.DB, cfg config.Config) (uuidmap.Resolver, error) {
+	switch {
+	case cfg.UUIDMapFile != "":
+		return uuidmap.NewFile(cfg.UUIDMapFile), nil
+	case cfg.UUIDMapTable != "":
+		return uuidmap.NewTable(dstDb, cfg.UUIDMapTable), nil
+	}
+
+	dstSchema, err := dbx.TableSchema(ctx, dstDb, cfg.DstTable)
+	if err != nil {
+		return nil, err
+	}
+	format, err := uuidFormat(cfg, dstSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dstResolver{db: dstDb, cfg: cfg, format: format}, nil
+}
+
+// dstResolver ищет пары nid и UUID прямо в целевой таблице, если в ней сохранен nid
+type dstResolver struct {
+	db     *sql.DB
+	cfg    config.Config
+	format string
+}
+
+func (r *dstResolver) Resolve(ctx context.Context, table string, nids []uint64, uuids []string) ([]uuidmap.Entry, error) {
+	var out []uuidmap.Entry
+
+	if len(nids) > 0 {
+		args := make([]any, 0, len(nids))
+		for _, nid := range nids {
+			args = append(args, nid)
+		}
+		entries, err := r.query(ctx, table, false, args)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+	}
+
+	if len(uuids) > 0 {
+		// Колонка хранит UUID в своем формате: перекодируем ключи так же, как при миграции
+		args := make([]any, 0, len(uuids))
+		for _, u := range uuids {
+			args = append(args, uuidv7.Encode(u, r.format))
+		}
+		entries, err := r.query(ctx, table, true, args)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+	}
+
+	return out, nil
+}
+
+// query ищет строки по ключам args пачками по refBatch
+func (r *dstResolver) query(ctx context.Context, table string, byUUID bool, args []any) ([]uuidmap.Entry, error) {
+	var out []uuidmap.Entry
+	for len(args) > 0 {
+		n := min(len(args), refBatch)
+		entries, err := r.queryBatch(ctx, table, byUUID, args[:n])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+		args = args[n:]
+	}
+	return out, nil
+}
+
+func (r *dstResolver) queryBatch(ctx context.Context, table string, byUUID bool, args []any) ([]uuidmap.Entry, error) {
+	q := dbx.BuildUUIDLookup(r.cfg.DstTable, r.cfg.DstNID, r.cfg.DstUuid, r.format, byUUID, len(args))
+	rows, err := r.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("lookup in %s: %w", r.cfg.DstTable, err)
+	}
+	defer rows.Close()
+
+	var out []uuidmap.Entry
+	for rows.Next() {
+		e := uuidmap.Entry{Table: table}
+		if err := rows.Scan(&e.NID, &e.UUID); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		e.UUID = uuidv7.Decode(e.UUID, r.format)
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
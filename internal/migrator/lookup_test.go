@@ -0,0 +1,36 @@
+package migrator
+
+import (
+	"logs-migrator/internal/uuidmap"
+	"slices"
+	"testing"
+)
+
+func TestParseLookupKeys(t *testing.T) {
+	nids, uuids, err := parseLookupKeys([]string{"42", "0190C2A1-B2C3-7D4E-8F9A-0B1C2D3E4F50", "7", "0190c2a1b2c37d4e8f9a0b1c2d3e4f51"})
+	if err != nil {
+		t.Fatalf("parseLookupKeys() error = %v", err)
+	}
+	if want := []uint64{42, 7}; !slices.Equal(nids, want) {
+		t.Errorf("nids = %v, want %v", nids, want)
+	}
+	if want := []string{"0190c2a1b2c37d4e8f9a0b1c2d3e4f50", "0190c2a1b2c37d4e8f9a0b1c2d3e4f51"}; !slices.Equal(uuids, want) {
+		t.Errorf("uuids = %v, want %v", uuids, want)
+	}
+
+	for _, key := range []string{"-1", "abc", "0190c2a1-b2c3"} {
+		if _, _, err := parseLookupKeys([]string{key}); err == nil {
+			t.Errorf("parseLookupKeys(%q) error = nil", key)
+		}
+	}
+}
+
+func TestMissingKeys(t *testing.T) {
+	entries := []uuidmap.Entry{{Table: "log", NID: 1, UUID: "0190c2a1b2c37d4e8f9a0b1c2d3e4f50"}}
+
+	got := missingKeys(entries, []uint64{1, 2}, []string{"0190c2a1b2c37d4e8f9a0b1c2d3e4f50", "0190c2a1b2c37d4e8f9a0b1c2d3e4f51"})
+	want := []string{"2", "0190c2a1-b2c3-7d4e-8f9a-0b1c2d3e4f51"}
+	if !slices.Equal(got, want) {
+		t.Errorf("missingKeys() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,54 @@
+package migrator
+
+import (
+	"logs-migrator/internal/metrics"
+	"time"
+)
+
+// Фазы миграции, метка phase в метриках. Метка table - таблица-источник
+const (
+	phaseStage = "stage"
+	phaseLoad  = "load"
+)
+
+var (
+	metricRows = metrics.Default.Counter(
+		"logs_migrator_rows_total", "Rows staged and loaded by table and phase", "table", "phase",
+	)
+	metricFiles = metrics.Default.Counter(
+		"logs_migrator_files_total", "Shard files staged and loaded by table and phase", "table", "phase",
+	)
+	metricRetries = metrics.Default.Counter(
+		"logs_migrator_retries_total", "Shard retries after transient MySQL errors by table and phase", "table", "phase",
+	)
+	metricErrors = metrics.Default.Counter(
+		"logs_migrator_errors_total", "Shard errors that stopped the migration by table and phase", "table", "phase",
+	)
+	metricShardSeconds = metrics.Default.Histogram(
+		"logs_migrator_shard_duration_seconds", "Shard processing time by table and phase, including retries", metrics.DurationBuckets, "table", "phase",
+	)
+	metricShards = metrics.Default.Gauge(
+		"logs_migrator_shards", "Shards planned for the current run",
+	)
+	metricStagedBytes = metrics.Default.Gauge(
+		"logs_migrator_staged_bytes", "Bytes of staged files waiting on disk for load",
+	)
+	metricStagedFiles = metrics.Default.Gauge(
+		"logs_migrator_staged_files", "Staged files waiting on disk for load",
+	)
+)
+
+// registerQueueMetrics регистрирует датчики глубины очередей текущего запуска
+func registerQueueMetrics(stageJobs chan shardJob, loadJobs chan loadJob) {
+	metrics.Default.GaugeFunc("logs_migrator_stage_queue_depth", "Shards waiting for a stage worker", func() float64 {
+		return float64(len(stageJobs))
+	})
+	metrics.Default.GaugeFunc("logs_migrator_load_queue_depth", "Staged shards waiting for a load worker", func() float64 {
+		return float64(len(loadJobs))
+	})
+}
+
+// observeShard записывает длительность обработки шарда таблицы table в фазе phase
+func observeShard(table, phase string, start time.Time) {
+	metricShardSeconds.Observe(time.Since(start).Seconds(), table, phase)
+}
@@ -3,19 +3,30 @@ package migrator
 import (
 	"context"
 	"database/sql"
+	"encoding/csv"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"logs-migrator/internal/budget"
 	"logs-migrator/internal/config"
 	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/journal"
 	"logs-migrator/internal/ranger"
+	"logs-migrator/internal/retry"
 	"logs-migrator/internal/stagewriter"
 	"logs-migrator/internal/util"
+	"logs-migrator/internal/uuidmap"
+	"os"
 	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// Run мигрирует таблицы запуска: одну из флагов или все из файла заданий. Таблицы мигрируют волнами
+// (см. runWave): дочерние таблицы с внешними ключами - после родительских. С -follow после основной
+// миграции переносит новые строки до отмены ctx (см. follow)
 func Run(
 	ctx context.Context,
 	srcDb,
@@ -23,47 +34,160 @@ func Run(
 	secureDir string,
 	cfg config.Config,
 ) error {
-	// Определяем минимальный и максимальный ID записей, которые нужно мигрировать
-	minID, maxID := getMinMaxSrcID(ctx, srcDb, dstDb, cfg)
-	if minID == 0 && maxID == 0 {
-		log.Printf("[INFO] no new rows to migrate\n")
-		return nil
-	}
-	log.Printf("[INFO] numeric ID range: %d - %d\n", minID, maxID)
+	// Определяем шарды и колонки каждой таблицы
+	var tasks []*tableTask
+	defer func() {
+		for _, t := range tasks {
+			t.close()
+		}
+	}()
 
-	// Разбиваем на шарды
-	shards := ranger.Split(minID, maxID, uint64(cfg.ChunkSize))
-	log.Printf("[INFO] shards: %d\n", len(shards))
+	// Карта UUID общая для всех таблиц запуска
+	uuidMap, err := openUUIDMap(ctx, dstDb, cfg)
+	if err != nil {
+		return err
+	}
+	if uuidMap != nil {
+		defer func() {
+			if err := uuidMap.Close(); err != nil {
+				slog.Warn("failed to close UUID map", "err", err)
+			}
+		}()
+	}
 
-	// Получаем список колонок табьлицы-источника и целеной таблицы
-	srcTableColumns := dbx.MustTableColumns(ctx, srcDb, cfg.SrcTable)
-	dstTableColumns := dbx.MustTableColumns(ctx, dstDb, cfg.DstTable)
+	var totalShards int
+	for _, tableCfg := range cfg.Tables() {
+		// Переход на INSERT из-за пустого secure_file_priv действует на все таблицы
+		if cfg.UseInsert {
+			tableCfg.UseInsert = true
+		}
 
-	// Оборачиваем родительский контекст для воркеров
-	workersCtx, cancelWork := context.WithCancel(ctx)
-	defer cancelWork()
+		t, err := prepareTable(ctx, srcDb, dstDb, tableCfg)
+		if t != nil {
+			tasks = append(tasks, t)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", tableCfg.SrcTable, err)
+		}
+		t.uuidMap = uuidMap
+		totalShards += len(t.shards)
+	}
+	if totalShards == 0 && !cfg.Follow {
+		return nil
+	}
 
-	// Создаем очереди
-	stageJobs := make(chan ranger.Range, len(shards))
-	loadJobs := make(chan loadJob, len(shards))
-	errs := make(chan error, 1)
+	// Внешние ключи дочерних таблиц ссылаются на родительские таблицы запуска
+	if err := linkForeignKeys(ctx, dstDb, cfg, tasks); err != nil {
+		return err
+	}
 
-	// Создаем счетчики
-	var totalStaged atomic.Uint64
-	var totalLoaded atomic.Uint64
-	var filesStaged atomic.Uint64
-	var filesLoaded atomic.Uint64
+	// Проверяем свободное место и создаем бюджет временных файлов
+	bud, err := stageBudget(cfg, secureDir)
+	if err != nil {
+		return err
+	}
+	metricShards.Set(int64(totalShards))
 
-	// Включаем Fast-load если указан флаг
-	if cfg.UseFastLoad {
+	// Включаем Fast-load если указан флаг. Он действует только на основную миграцию: слежение работает долго,
+	// и целевая БД все это время не должна оставаться без redo log
+	disableFastLoad := func() {}
+	if cfg.UseFastLoad && totalShards > 0 {
 		originalSettings := dbx.EnableFastLoad(ctx, dstDb, cfg.InnodbBufferPoolSize, cfg.InnodbIOCapacity, cfg.InnodbIOCapacityMax)
-		defer func() {
+		disableFastLoad = sync.OnceFunc(func() {
 			dbx.DisableFastLoad(dstDb, originalSettings)
-		}()
+		})
+		defer disableFastLoad()
 	}
 
 	// Фиксируем время старта
 	start := time.Now()
+	stopProgress := startProgress(ctx, cfg, tasks)
+
+	// Дочерние таблицы мигрируют волной после родительских: когда начинается их выгрузка, UUID всех
+	// родительских строк уже загружены
+	waves, err := taskWaves(cfg, tasks)
+	if err != nil {
+		return err
+	}
+	for _, wave := range waves {
+		if err = runWave(ctx, srcDb, dstDb, secureDir, cfg, bud, wave); err != nil {
+			break
+		}
+	}
+	stopProgress()
+
+	// Печатаем статистику. Если волна завершилась ошибкой, то пишем, что миграция не удалась
+	if err != nil {
+		printStats(start, tasks, true)
+		return err
+	}
+
+	printStats(start, tasks, false)
+
+	for _, t := range tasks {
+		if len(t.gaps) > 0 {
+			printRepairedGaps(t.cfg.SrcTable, t.gaps)
+		}
+	}
+
+	if cfg.Follow {
+		disableFastLoad()
+		return follow(ctx, srcDb, dstDb, secureDir, cfg, bud, tasks)
+	}
+
+	return nil
+}
+
+// taskWaves делит таблицы запуска на волны по внешним ключам (см. config.TableWaves)
+func taskWaves(cfg config.Config, tasks []*tableTask) ([][]*tableTask, error) {
+	if len(cfg.Jobs) == 0 {
+		return [][]*tableTask{tasks}, nil
+	}
+
+	indexes, err := config.TableWaves(cfg.Jobs)
+	if err != nil {
+		return nil, err
+	}
+
+	waves := make([][]*tableTask, 0, len(indexes))
+	for _, wave := range indexes {
+		var ts []*tableTask
+		for _, i := range wave {
+			ts = append(ts, tasks[i])
+		}
+		waves = append(waves, ts)
+	}
+	return waves, nil
+}
+
+// runWave мигрирует шарды таблиц волны: шарды ставятся в общую очередь друг за другом и обрабатываются
+// общим пулом воркеров. Возвращает первую ошибку воркеров
+func runWave(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	secureDir string,
+	cfg config.Config,
+	bud *budget.Budget,
+	tasks []*tableTask,
+) error {
+	var totalShards int
+	for _, t := range tasks {
+		totalShards += len(t.shards)
+	}
+	if totalShards == 0 {
+		return nil
+	}
+
+	// Оборачиваем родительский контекст для воркеров
+	workersCtx, cancelWork := context.WithCancel(ctx)
+	defer cancelWork()
+
+	// Создаем очереди
+	stageJobs := make(chan shardJob, totalShards)
+	loadJobs := make(chan loadJob, totalShards)
+	errs := make(chan error, 1)
+	registerQueueMetrics(stageJobs, loadJobs)
 
 	// Запускаем Stage-воркеров
 	var stageWG sync.WaitGroup
@@ -72,7 +196,7 @@ func Run(
 		id := i + 1
 		go func(id int) {
 			defer stageWG.Done()
-			if err := runStageWorker(workersCtx, id, srcDb, srcTableColumns, cfg, secureDir, stageJobs, loadJobs, &totalStaged, &filesStaged); err != nil {
+			if err := runStageWorker(workersCtx, id, srcDb, secureDir, bud, stageJobs, loadJobs); err != nil {
 				select {
 				case errs <- err:
 					cancelWork()
@@ -89,7 +213,7 @@ func Run(
 		id := i + 1
 		go func(id int) {
 			defer loadWG.Done()
-			if err := runLoadWorker(workersCtx, id, dstDb, dstTableColumns, cfg, secureDir, loadJobs, &totalLoaded, &filesLoaded); err != nil {
+			if err := runLoadWorker(workersCtx, id, dstDb, cfg, secureDir, bud, loadJobs); err != nil {
 				select {
 				case errs <- err:
 					cancelWork()
@@ -102,11 +226,13 @@ func Run(
 	// Запускаем продюсера
 	go func() {
 		defer close(stageJobs)
-		for _, sh := range shards {
-			select {
-			case <-ctx.Done():
-				return
-			case stageJobs <- sh:
+		for _, t := range tasks {
+			for i, sh := range t.shards {
+				select {
+				case <-ctx.Done():
+					return
+				case stageJobs <- shardJob{task: t, Range: sh, Replace: i < t.resumed}:
+				}
 			}
 		}
 	}()
@@ -118,21 +244,98 @@ func Run(
 	// Ждём когда завершится этап загрузки
 	loadWG.Wait()
 
-	// Печатаем статистику. Если в канале с ошибками есть записи, то пишем, что миграция не удалась
 	close(errs)
-	if e := <-errs; e != nil {
-		printStats(start, filesStaged.Load(), totalStaged.Load(), filesLoaded.Load(), totalLoaded.Load(), true)
-		return e
-	}
+	return <-errs
+}
 
-	printStats(start, filesStaged.Load(), totalStaged.Load(), filesLoaded.Load(), totalLoaded.Load(), false)
+type loadJob struct {
+	task  *tableTask
+	Range ranger.Range
+	Path  string
+	Rows  uint64
+	Size  uint64
 
-	return nil
+	// Replace - перед загрузкой удалить строки диапазона из целевой таблицы. Выставляется при повторе,
+	// когда предыдущая попытка могла успеть записать часть шарда, и для шардов, продолженных из журнала
+	Replace bool
+
+	// NIDs nid строк, которые удаляются вместо всего диапазона у таблицы с фильтром (см. deleteReplaced).
+	// nil - nid берутся из временного файла
+	NIDs []uint64
+
+	// Map записи карты UUID строк шарда, load-воркер записывает их после загрузки. У потока записи дописываются
+	// до закрытия потока, то есть до того, как загрузка получит EOF
+	Map *uuidRecorder
+
+	// Для потоковой загрузки: читающий конец pipe и канал, в который load-воркер сообщает результат загрузки
+	Stream *io.PipeReader
+	Done   chan<- error
 }
 
-type loadJob struct {
-	Path string
-	Rows uint64
+// runStats счетчики миграции, которые обновляют воркеры
+type runStats struct {
+	table        string
+	filesStaged  atomic.Uint64
+	rowsStaged   atomic.Uint64
+	filesLoaded  atomic.Uint64
+	rowsLoaded   atomic.Uint64
+	stageRetries atomic.Uint64
+	loadRetries  atomic.Uint64
+	shardsDone   atomic.Uint64
+}
+
+// add прибавляет счетчики other
+func (st *runStats) add(other *runStats) {
+	st.filesStaged.Add(other.filesStaged.Load())
+	st.rowsStaged.Add(other.rowsStaged.Load())
+	st.filesLoaded.Add(other.filesLoaded.Load())
+	st.rowsLoaded.Add(other.rowsLoaded.Load())
+	st.stageRetries.Add(other.stageRetries.Load())
+	st.loadRetries.Add(other.loadRetries.Load())
+	st.shardsDone.Add(other.shardsDone.Load())
+}
+
+// staged учитывает выгруженный шард
+func (st *runStats) staged(rows uint64) {
+	st.filesStaged.Add(1)
+	st.rowsStaged.Add(rows)
+	metricFiles.Inc(st.table, phaseStage)
+	metricRows.Add(rows, st.table, phaseStage)
+}
+
+// loaded учитывает загруженный шард
+func (st *runStats) loaded(rows uint64) {
+	st.filesLoaded.Add(1)
+	st.rowsLoaded.Add(rows)
+	metricFiles.Inc(st.table, phaseLoad)
+	metricRows.Add(rows, st.table, phaseLoad)
+}
+
+// retried учитывает повторы шарда в фазе phase
+func (st *runStats) retried(phase string, retries int) {
+	if retries == 0 {
+		return
+	}
+	if phase == phaseStage {
+		st.stageRetries.Add(uint64(retries))
+	} else {
+		st.loadRetries.Add(uint64(retries))
+	}
+	metricRetries.Add(uint64(retries), st.table, phase)
+}
+
+// retryPolicy возвращает политику повторов шарда после временных ошибок MySQL
+func retryPolicy(cfg config.Config, logger *slog.Logger, r ranger.Range) retry.Policy {
+	return retry.Policy{
+		Attempts:   cfg.Retries,
+		Backoff:    cfg.RetryBackoff,
+		MaxBackoff: cfg.RetryMaxBackoff,
+		Retryable:  dbx.IsTransient,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			logger.Warn("transient error, retrying shard",
+				"from", r.From, "to", r.To, "attempt", attempt, "retries", cfg.Retries, "delay", delay, "err", err)
+		},
+	}
 }
 
 // runStageWorker запускает Stage-воркера, который идет в БД-источник, забирает данные, добавляет UUIDv7
@@ -141,56 +344,118 @@ func runStageWorker(
 	ctx context.Context,
 	id int,
 	src *sql.DB,
-	columns []string,
-	cfg config.Config,
 	secureDir string,
-	in <-chan ranger.Range,
+	bud *budget.Budget,
+	in <-chan shardJob,
 	out chan<- loadJob,
-	totalRows *atomic.Uint64,
-	totalFiles *atomic.Uint64,
 ) error {
-	logPrefix := fmt.Sprintf("[STAGE#%d]", id)
-	loc, err := time.LoadLocation(cfg.UUIDTZ)
-	if err != nil {
-		return err
-	}
+	errPrefix := fmt.Sprintf("stage worker %d", id)
+	workerLogger := slog.With("phase", phaseStage, "worker", id)
 
 	// Слушаем job'ы из канала in
-	for job := range in {
+	for sj := range in {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
 		}
 
-		chunkPath, written, err := processShardToCSV(
-			ctx,
-			src,
-			cfg,
-			columns,
-			job.From,
-			job.To,
-			secureDir,
-			loc,
+		t, job := sj.task, sj.Range
+		cfg, st := t.cfg, &t.stats
+		logger := workerLogger.With("table", cfg.SrcTable)
+
+		policy := retryPolicy(cfg, logger, job)
+
+		// В потоковом режиме шард загружается одновременно с выгрузкой, временного файла нет.
+		// Поток нельзя перечитать, поэтому после временной ошибки загрузки шард целиком повторяет stage-воркер
+		if cfg.UseStream {
+			start := time.Now()
+			var written uint64
+			retries, err := policy.Do(ctx, func(attempt int) error {
+				var err error
+				written, err = processShardToStream(ctx, src, t, job, sj.Replace || attempt > 0, out)
+				return err
+			})
+			st.retried(phaseStage, retries)
+			observeShard(cfg.SrcTable, phaseStage, start)
+			if err != nil {
+				metricErrors.Inc(cfg.SrcTable, phaseStage)
+				return fmt.Errorf("%s: %s: %w", errPrefix, cfg.SrcTable, err)
+			}
+			if written > 0 {
+				logger.Info("streamed range", "from", job.From, "to", job.To, "rows", written)
+				st.staged(written)
+			}
+			continue
+		}
+
+		// Ждем, пока load-воркеры разберут backlog временных файлов
+		if err := bud.Acquire(ctx); err != nil {
+			return err
+		}
+
+		start := time.Now()
+		var (
+			chunkPath string
+			written   uint64
+			rec       *uuidRecorder
 		)
+		retries, err := policy.Do(ctx, func(int) error {
+			var err error
+			rec = newUUIDRecorder(t)
+			chunkPath, written, err = processShardToCSV(
+				ctx,
+				src,
+				t,
+				job.From,
+				job.To,
+				secureDir,
+				t.uuidFunc,
+				rec,
+			)
+			return err
+		})
+		st.retried(phaseStage, retries)
+		observeShard(cfg.SrcTable, phaseStage, start)
 		if err != nil {
-			return fmt.Errorf("%s: %w", logPrefix, err)
+			bud.Release(0)
+			metricErrors.Inc(cfg.SrcTable, phaseStage)
+			return fmt.Errorf("%s: %s: %w", errPrefix, cfg.SrcTable, err)
 		}
 
-		// Если ничего не записано, скипаем, значит в заданном диапазоне ID ничего не найдено
+		// Если ничего не записано, скипаем, значит в заданном диапазоне ID ничего не найдено.
+		// Такой шард сразу считается загруженным
 		if written == 0 {
+			bud.Release(0)
+			if err := t.jr.MarkLoaded(job, 0); err != nil {
+				return fmt.Errorf("%s: %w", errPrefix, err)
+			}
+			t.shardDone()
 			continue
 		}
 
-		log.Printf("%s processed range [%d..%d]: %d rows", logPrefix, job.From, job.To, written)
+		logger.Info("processed range", "from", job.From, "to", job.To, "file", filepath.Base(chunkPath), "rows", written)
+
+		var size uint64
+		if info, err := os.Stat(chunkPath); err != nil {
+			logger.Warn("failed to stat staged file", "file", chunkPath, "err", err)
+		} else {
+			size = uint64(info.Size())
+		}
+		bud.Add(size)
+		metricStagedBytes.Add(int64(size))
+		metricStagedFiles.Add(1)
+
+		if err := t.jr.MarkStaged(job, written); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
+		}
 
-		totalFiles.Add(1)
-		totalRows.Add(written)
+		st.staged(written)
 
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case out <- loadJob{Path: chunkPath, Rows: written}:
+		case out <- loadJob{task: t, Range: job, Path: chunkPath, Rows: written, Size: size, Replace: sj.Replace, Map: rec}:
 		}
 	}
 
@@ -201,17 +466,75 @@ func runStageWorker(
 func processShardToCSV(
 	ctx context.Context,
 	db *sql.DB,
-	cfg config.Config,
-	columns []string,
+	t *tableTask,
 	from, to uint64,
 	tmpDir string,
-	loc *time.Location,
+	gen stagewriter.UUIDFunc,
+	rec *uuidRecorder,
 ) (chunkPath string, written uint64, err error) {
+	// Создаем структуру для записи данных в CSV
+	writer, err := stagewriter.New(tmpDir, t.cfg.SrcTable, from, to, t.tsIndex, t.loc)
+	if err != nil {
+		return "", 0, err
+	}
+	defer writer.Close()
+
+	if err := writeShardRows(ctx, db, t, from, to, writer, gen, rec); err != nil {
+		writer.CleanupOnError()
+		return "", 0, err
+	}
+
+	written = writer.RowsWritten()
+
+	// Удаляем пустые файлы
+	if written == 0 {
+		writer.CleanupOnError()
+		return "", 0, nil
+	}
+
+	return writer.Path(), written, nil
+}
+
+// writeShardRows считывает данные из исходной базы данных для заданного диапазона, заменяет внешние ключи
+// на UUID родителей, применяет к строкам трансформеры таблицы и передает их во writer. UUID строк формирует gen
+// (обычно t.uuidFunc). Если включена карта UUID, nid и UUID строк шарда собирает rec
+func writeShardRows(
+	ctx context.Context,
+	db *sql.DB,
+	t *tableTask,
+	from, to uint64,
+	writer *stagewriter.StagedWriter,
+	gen stagewriter.UUIDFunc,
+	rec *uuidRecorder,
+) error {
+	cfg := t.cfg
+	switch {
+	case rec != nil:
+		writer.SetUUIDFunc(rec.wrap(gen))
+	case gen != nil:
+		writer.SetUUIDFunc(gen)
+	}
+
+	// UUID родительских строк для внешних ключей шарда
+	var refs []*shardRefs
+	if len(t.fks) > 0 {
+		var err error
+		if refs, err = resolveRefs(ctx, db, t, from, to); err != nil {
+			return err
+		}
+	}
+
 	// Отправляем запрос в БД-источник
-	query := dbx.BuildSelectByRange(cfg.SrcTable, columns, cfg.SrcNID, cfg.SrcFilter)
+	query := dbx.BuildSelectByRange(cfg.SrcTable, t.mapping, cfg.SrcNID, cfg.SrcFilter)
+	if cfg.Command == config.CommandCDC && cfg.CDCLockReads {
+		// При sync_binlog и групповой фиксации событие binlog может прийти раньше, чем изменение станет видно
+		// в InnoDB. Блокирующее чтение дождется фиксации транзакции, но ставит разделяемые блокировки на строки
+		// источника и задерживает запись в них, поэтому включается только явно
+		query += " LOCK IN SHARE MODE"
+	}
 	rows, err := db.QueryContext(ctx, query, from, to)
 	if err != nil {
-		return "", 0, fmt.Errorf("query error: %w", err)
+		return fmt.Errorf("query error: %w", err)
 	}
 	defer rows.Close()
 
@@ -223,64 +546,57 @@ func processShardToCSV(
 		valuePointers[i] = &values[i]
 	}
 
-	// Создаем структуру для записи данных в CSV
-	writer, err := stagewriter.New(tmpDir, cfg.SrcTable, from, to, cfg.TSColumnIdx-1, loc)
-	if err != nil {
-		return "", 0, err
-	}
-	defer writer.Close()
-
 	// Обходим полученные записи
 	for rows.Next() {
 		if err := rows.Scan(valuePointers...); err != nil {
-			writer.CleanupOnError()
-			return "", 0, fmt.Errorf("scan: %w", err)
+			return fmt.Errorf("scan: %w", err)
+		}
+
+		if keep, err := rewriteRefs(refs, values); err != nil {
+			return err
+		} else if !keep {
+			continue
+		}
+
+		if err := t.transform.Transform(values); err != nil {
+			return fmt.Errorf("transform row: %w", err)
 		}
 
 		if err := writer.WriteRow(values); err != nil {
-			writer.CleanupOnError()
-			return "", 0, err
+			return err
 		}
 	}
 
 	// Если в процессе обхода возникла ошибка, нужно её выкинуть наружу
 	if err := rows.Err(); err != nil {
-		writer.CleanupOnError()
-		return "", 0, fmt.Errorf("rows iteration: %w", err)
+		return fmt.Errorf("rows iteration: %w", err)
 	}
 
-	written = writer.RowsWritten()
-
-	// Удаляем пустые файлы
-	if written == 0 {
-		writer.CleanupOnError()
-		return "", 0, nil
-	}
+	reportOrphans(cfg.SrcTable, from, to, refs)
 
-	return writer.Path(), written, nil
+	return nil
 }
 
 // runLoadWorker запускает Load-воркера, который загружает данные из временного файла в целевую БД.
-// После успешной загрузки удаляет временный файл
+// После временной ошибки загрузка файла повторяется, после завершения временный файл удаляется
 func runLoadWorker(
 	ctx context.Context,
 	id int,
 	dst *sql.DB,
-	columns []string,
-	cfg config.Config,
+	runCfg config.Config,
 	secureDir string,
+	bud *budget.Budget,
 	in <-chan loadJob,
-	totalRows *atomic.Uint64,
-	totalFiles *atomic.Uint64,
 ) error {
-	logPrefix := fmt.Sprintf("[LOAD#%d]", id)
+	errPrefix := fmt.Sprintf("load worker %d", id)
+	workerLogger := slog.With("phase", phaseLoad, "worker", id)
 
 	// Отключаем binlog для этой сессии воркера (если включен fast-load)
-	if cfg.UseFastLoad {
+	if runCfg.UseFastLoad {
 		if _, err := dst.ExecContext(ctx, "SET SESSION sql_log_bin = 0"); err != nil {
-			log.Printf("%s [WARN] failed to disable binlog for session: %v", logPrefix, err)
+			workerLogger.Warn("failed to disable binlog for session", "err", err)
 		} else {
-			log.Printf("%s binlog disabled for this session", logPrefix)
+			workerLogger.Debug("binlog disabled for this session")
 		}
 	}
 
@@ -291,47 +607,385 @@ func runLoadWorker(
 		default:
 		}
 
-		log.Printf("%s start LOAD IN FILE %s", logPrefix, filepath.Base(j.Path))
+		t := j.task
+		cfg, st := t.cfg, &t.stats
+		logger := workerLogger.With("table", cfg.SrcTable)
+
+		load := loadDataInfile
+		if cfg.UseInsert {
+			logger.Debug("start INSERT", "from", j.Range.From, "to", j.Range.To, "file", filepath.Base(j.Path))
+			load = insertFile
+		} else {
+			logger.Debug("start LOAD DATA INFILE", "from", j.Range.From, "to", j.Range.To, "file", filepath.Base(j.Path))
+		}
+
+		// Поток повторяет stage-воркер, файл можно загрузить заново. Повторная загрузка сначала удаляет
+		// диапазон: оборванное соединение не гарантирует, что предыдущая попытка не закоммитилась
+		policy := retryPolicy(cfg, logger, j.Range)
+		if j.Stream != nil {
+			policy.Attempts = 0
+		}
+
+		start := time.Now()
+		var rows uint64
+		retries, err := policy.Do(ctx, func(attempt int) error {
+			job := j
+			job.Replace = j.Replace || attempt > 0
+			var err error
+			if rows, err = load(ctx, dst, job, cfg, t.mapping); err != nil {
+				return err
+			}
+			return j.Map.record(ctx)
+		})
+		st.retried(phaseLoad, retries)
+		observeShard(cfg.SrcTable, phaseLoad, start)
+
+		// Безопасно удаляем файл ПОСЛЕ завершения загрузки (в любом случае - успех или ошибка)
+		if j.Stream == nil {
+			if removeErr := util.SafeRemove(j.Path, secureDir); removeErr != nil {
+				logger.Warn("failed to remove staged file", "file", j.Path, "err", removeErr)
+			}
+			bud.Release(j.Size)
+			metricStagedBytes.Add(-int64(j.Size))
+			metricStagedFiles.Add(-1)
+		}
+
+		// Ошибку потоковой загрузки обрабатывает stage-воркер, который пишет в этот поток
+		if j.Stream != nil {
+			if err != nil {
+				_ = j.Stream.CloseWithError(err)
+			} else if err = t.jr.MarkLoaded(j.Range, rows); err == nil {
+				t.shardDone()
+			}
+			j.Done <- err
+			if err == nil && rows > 0 {
+				st.loaded(rows)
+				logger.Info("loaded stream", "from", j.Range.From, "to", j.Range.To, "file", j.Path, "rows", rows)
+			}
+			continue
+		}
+
+		if err != nil {
+			metricErrors.Inc(cfg.SrcTable, phaseLoad)
+			return fmt.Errorf("%s: %s: %w", errPrefix, cfg.SrcTable, err)
+		}
 
-		if err := loadDataInfile(ctx, dst, j.Path, secureDir, cfg.DstTable, cfg.DstUuid, columns, cfg.UseLocalInfile); err != nil {
-			return fmt.Errorf("%s LOAD DATA: %w", logPrefix, err)
+		if err := t.jr.MarkLoaded(j.Range, rows); err != nil {
+			return fmt.Errorf("%s: %w", errPrefix, err)
 		}
+		t.shardDone()
 
-		totalFiles.Add(1)
-		totalRows.Add(j.Rows)
-		log.Printf("%s loaded %s (+%d rows)", logPrefix, filepath.Base(j.Path), j.Rows)
+		st.loaded(rows)
+		logger.Info("loaded file", "from", j.Range.From, "to", j.Range.To, "file", filepath.Base(j.Path), "rows", rows)
 	}
 
 	return nil
 }
 
-func loadDataInfile(ctx context.Context, db *sql.DB, stagedPath, secureDir, dstTable, uuidCol string, columns []string, useLocalInfile bool) error {
-	if len(columns) == 0 {
-		return fmt.Errorf("destination table has no columns")
+// loadDataInfile загружает файл или поток в целевую БД и возвращает количество загруженных строк
+func loadDataInfile(ctx context.Context, db *sql.DB, j loadJob, cfg config.Config, m dbx.ColumnMapping) (uint64, error) {
+	if len(m.Fields) == 0 {
+		return 0, fmt.Errorf("destination table has no columns")
 	}
 
 	// Строим SQL для LOAD DATA INFILE или LOAD DATA LOCAL INFILE
-	loadSQL := dbx.BuildLoadDataSQL(stagedPath, dstTable, uuidCol, columns, useLocalInfile)
+	loadSQL := dbx.BuildLoadDataSQL(j.Path, cfg.DstTable, cfg.DstUuid, m, cfg.UseLocalInfile)
 	if loadSQL == "" {
-		return fmt.Errorf("failed to build LOAD DATA SQL")
+		return 0, fmt.Errorf("failed to build LOAD DATA SQL")
 	}
 
 	// Запрос может быть достаточно долгим, поэтому лучше контекст обернуть с большим таймаутом
 	loadCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
 	defer cancel()
 
-	// Выполняем LOAD DATA INFILE
-	_, err := db.ExecContext(loadCtx, loadSQL)
+	// Выполняем LOAD DATA INFILE. При восстановлении пропусков и повторе сначала удаляем неполный диапазон.
+	// Поток загружаем в транзакции: если выгрузка оборвется, драйвер завершит LOAD DATA на уже
+	// переданных данных, и частичный шард нужно откатить
+	var (
+		res sql.Result
+		err error
+	)
+	switch {
+	case cfg.RepairGaps || j.Replace:
+		res, err = execLoadTx(loadCtx, db, loadSQL, cfg, j, true)
+	case j.Stream != nil:
+		res, err = execLoadTx(loadCtx, db, loadSQL, cfg, j, false)
+	default:
+		res, err = db.ExecContext(loadCtx, loadSQL)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	// Для файла количество строк известно заранее, для потока берем его из ответа сервера
+	if j.Stream == nil {
+		return j.Rows, nil
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return uint64(affected), nil
+}
+
+// execLoadTx выполняет LOAD DATA в транзакции. С replace перед загрузкой в той же транзакции удаляются
+// строки шарда (см. deleteReplaced), чтобы частично загруженный шард не задвоился
+func execLoadTx(ctx context.Context, db *sql.DB, loadSQL string, cfg config.Config, j loadJob, replace bool) (sql.Result, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if replace {
+		if err := deleteReplaced(ctx, tx, cfg, j); err != nil {
+			return nil, err
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, loadSQL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+
+	return res, nil
+}
+
+// deleteReplaced удаляет из целевой таблицы строки, которые заменяет загрузка шарда при повторе
+// и восстановлении пропусков. Без фильтра удаляется весь диапазон. С -src-filter в диапазоне целевой таблицы
+// могут быть строки, которые этот запуск не переносит, поэтому удаляются только nid строк шарда: j.NIDs
+// или nid из временного файла
+func deleteReplaced(ctx context.Context, tx *sql.Tx, cfg config.Config, j loadJob) error {
+	if cfg.SrcFilter == "" {
+		if _, err := tx.ExecContext(ctx, dbx.BuildDeleteByRange(cfg.DstTable, cfg.DstNID), j.Range.From, j.Range.To); err != nil {
+			return fmt.Errorf("delete range: %w", err)
+		}
+		return nil
+	}
+
+	nids := j.NIDs
+	if nids == nil && j.Stream == nil {
+		var err error
+		if nids, err = stagedNIDs(j.Path, j.task.nidIndex+1); err != nil {
+			return err
+		}
+	}
+
+	for len(nids) > 0 {
+		n := min(len(nids), refBatch)
+		args := make([]any, 0, n)
+		for _, nid := range nids[:n] {
+			args = append(args, nid)
+		}
+		if _, err := tx.ExecContext(ctx, dbx.BuildDeleteByIDs(cfg.DstTable, cfg.DstNID, n), args...); err != nil {
+			return fmt.Errorf("delete rows: %w", err)
+		}
+		nids = nids[n:]
+	}
+	return nil
+}
+
+// stagedNIDs читает nid строк временного файла из поля field (UUID - поле 0)
+func stagedNIDs(path string, field int) ([]uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open staged file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	var nids []uint64
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nids, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read staged file: %w", err)
+		}
+		if field >= len(record) {
+			return nil, fmt.Errorf("staged row has %d fields, nid is field %d", len(record), field+1)
+		}
+
+		nid, err := parseNID(record[field])
+		if err != nil {
+			return nil, err
+		}
+		nids = append(nids, nid)
+	}
+}
+
+// stageBudget сверяет свободное место в директории временных файлов с бюджетом и создает бюджет.
+// В потоковом режиме временных файлов нет, бюджет не нужен
+func stageBudget(cfg config.Config, stageDir string) (*budget.Budget, error) {
+	if cfg.UseStream || stageDir == "" {
+		return nil, nil
+	}
+
+	// В режиме серверного INFILE директория - secure_file_priv сервера: statfs на клиенте смотрит на другой диск
+	// или на чужую точку монтирования, поэтому проверка пропускается, а бюджет файлов действует как обычно
+	if !cfg.UseLocalInfile && !cfg.UseInsert {
+		slog.Info("skipping free space check in server INFILE mode", "dir", stageDir)
+	} else if free, err := util.FreeSpace(stageDir); err != nil {
+		slog.Warn("failed to check free space", "dir", stageDir, "err", err)
+	} else {
+		slog.Info("free space in stage dir", "dir", stageDir, "free", util.FormatBytes(free))
+		if cfg.MaxStagedBytes > 0 && free < cfg.MaxStagedBytes {
+			return nil, fmt.Errorf(
+				"not enough free space in %s: %s available, -max-staged-bytes is %s",
+				stageDir, util.FormatBytes(free), util.FormatBytes(cfg.MaxStagedBytes),
+			)
+		}
+	}
+
+	bud := budget.New(cfg.MaxStagedBytes, cfg.MaxStagedFiles)
+	if bud != nil {
+		slog.Info("staged files budget, 0 = unlimited", "bytes", util.FormatBytes(cfg.MaxStagedBytes), "files", cfg.MaxStagedFiles)
+	}
+
+	return bud, nil
+}
+
+// openUUIDMap открывает карту UUID, если она включена в конфиге
+func openUUIDMap(ctx context.Context, dstDb *sql.DB, cfg config.Config) (uuidmap.Sink, error) {
+	switch {
+	case cfg.UUIDMapTable != "":
+		m, err := uuidmap.OpenTable(ctx, dstDb, cfg.UUIDMapTable)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("recording UUID map", "table", cfg.UUIDMapTable)
+		return m, nil
+	case cfg.UUIDMapFile != "":
+		m, err := uuidmap.OpenFile(cfg.UUIDMapFile)
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("recording UUID map", "file", cfg.UUIDMapFile)
+		return m, nil
+	default:
+		return nil, nil
+	}
+}
+
+// openJournal открывает журнал шардов, если он включен в конфиге
+func openJournal(cfg config.Config) (*journal.Journal, error) {
+	if cfg.JournalDir == "" {
+		return nil, nil
+	}
+
+	jr, err := journal.Open(cfg.JournalDir, journalKey(cfg))
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("checkpoint journal opened", "file", jr.Path())
+
+	return jr, nil
+}
+
+func journalKey(cfg config.Config) journal.Key {
+	return journal.Key{
+		SrcTable:  cfg.SrcTable,
+		SrcNID:    cfg.SrcNID,
+		SrcFilter: cfg.SrcFilter,
+		DstTable:  cfg.DstTable,
+		DstNID:    cfg.DstNID,
+	}
+}
+
+// planShards возвращает список шардов для миграции и количество незавершенных шардов из журнала в его начале.
+// Новые шарды записываются в журнал до начала загрузки
+func planShards(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+	jr *journal.Journal,
+) ([]ranger.Range, int, error) {
+	pending, fresh, err := resolveShards(ctx, srcDb, dstDb, cfg, jr)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(pending) > 0 {
+		slog.Info("resuming unfinished shards from journal", "shards", len(pending))
+	}
 
-	// Безопасно удаляем файл ПОСЛЕ завершения ExecContext (в любом случае - успех или ошибка)
-	if removeErr := util.SafeRemove(stagedPath, secureDir); removeErr != nil {
-		log.Printf("[WARN] failed to remove %s: %v", stagedPath, removeErr)
+	if err := jr.Plan(fresh); err != nil {
+		return nil, 0, err
 	}
 
-	return err
+	return append(pending, fresh...), len(pending), nil
 }
 
-// getMinMaxSrcID расчитывает минимальный и максимальный числовой ID
+// resolveShards определяет шарды для миграции, ничего не записывая. Если журнал пуст, диапазон определяется
+// по MAX(nid) в целевой таблице. Иначе возвращаются незавершенные шарды из журнала и новые ID за пределами
+// последнего запланированного шарда. Без журнала целевая таблица должна быть пустой: MAX(nid) может оказаться
+// за шардами, которые прошлый запуск не успел загрузить, и их строки молча пропустятся
+func resolveShards(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+	jr *journal.Journal,
+) (pending, fresh []ranger.Range, err error) {
+	var minID, maxID uint64
+
+	if jr.Empty() {
+		if cfg.JournalDir == "" {
+			if dstMaxNID := dbx.MustMaxPk(ctx, dstDb, cfg.DstTable, cfg.DstNID); dstMaxNID > 0 {
+				return nil, nil, fmt.Errorf("destination %s already has rows up to nid %d and there is no journal to resume from, set -journal-dir or use -repair-gaps", cfg.DstTable, dstMaxNID)
+			}
+		}
+		minID, maxID = getMinMaxSrcID(ctx, srcDb, dstDb, cfg)
+	} else {
+		_, srcMaxID := dbx.MustPKRange(ctx, srcDb, cfg.SrcTable, cfg.SrcNID, cfg.SrcFilter)
+		if journalMaxID := jr.MaxTo(); srcMaxID > journalMaxID {
+			minID, maxID = journalMaxID+1, srcMaxID
+		}
+	}
+
+	if maxID > 0 {
+		slog.Info("numeric ID range", "min", minID, "max", maxID)
+		fresh, err = splitRange(ctx, srcDb, cfg, minID, maxID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return jr.Pending(), fresh, nil
+}
+
+// splitRange делит диапазон ID на шарды выбранным способом: равными отрезками ID или по фактической плотности
+// строк. Во втором случае границы шардов находятся пробами по индексу первичного ключа источника
+func splitRange(ctx context.Context, srcDb *sql.DB, cfg config.Config, minID, maxID uint64) ([]ranger.Range, error) {
+	if cfg.SplitMode != config.SplitDensity {
+		return ranger.Split(minID, maxID, uint64(cfg.ChunkSize)), nil
+	}
+
+	start := time.Now()
+	shards, err := ranger.SplitByDensity(minID, maxID, func(after uint64) (uint64, bool, error) {
+		return dbx.NextChunkBoundary(ctx, srcDb, cfg.SrcTable, cfg.SrcNID, cfg.SrcFilter, after, cfg.ChunkSize)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("density split: %w", err)
+	}
+	slog.Info("density split done", "shards", len(shards), "duration", time.Since(start).Truncate(time.Millisecond))
+
+	return shards, nil
+}
+
+// getMinMaxSrcID расчитывает минимальный и максимальный числовой ID. Нижняя граница сдвигается за MAX(nid)
+// целевой таблицы, поэтому пропуски ниже него этот способ не видит (для них есть режим -repair-gaps)
 func getMinMaxSrcID(
 	ctx context.Context,
 	srcDb,
@@ -352,23 +1006,66 @@ func getMinMaxSrcID(
 	return minID, maxID
 }
 
-// printStats печатает статистку миграции
-func printStats(start time.Time, filesStaged, rowsStaged, filesLoaded, rowsLoaded uint64, failed bool) {
+// printStats печатает статистку миграции: по каждой таблице, если их несколько, и общую
+func printStats(start time.Time, tasks []*tableTask, failed bool) {
 	duration := time.Since(start)
 	if duration <= 0 {
 		duration = time.Millisecond
 	}
 
-	title := "[IMPORT SUCCESS]"
+	var total runStats
+	for _, t := range tasks {
+		total.add(&t.stats)
+	}
+
+	if len(tasks) > 1 {
+		for _, t := range tasks {
+			// Для таблицы, загруженной целиком, скорость считается до загрузки ее последнего шарда
+			tableDuration := duration
+			if finished := t.finished.Load(); finished > 0 {
+				tableDuration = max(time.Unix(0, finished).Sub(start), time.Millisecond)
+			}
+
+			fields := append([]any{"table", t.cfg.SrcTable, "shards", len(t.shards)}, statsFields(&t.stats, tableDuration)...)
+			slog.Info("table stats", fields...)
+		}
+	}
+
+	// Маскирования считаются по правилам каждой таблицы, повторы шардов учитываются повторно
+	for _, t := range tasks {
+		if t.redactor == nil {
+			continue
+		}
+		for _, c := range t.redactor.Counts() {
+			slog.Info("redaction stats", "table", t.cfg.SrcTable, "rule", c.Rule, "redacted", c.Count)
+		}
+	}
+
+	// Строки без родителя по внешним ключам каждой таблицы, повторы шардов учитываются повторно
+	for _, t := range tasks {
+		for _, fk := range t.fks {
+			slog.Info("orphan stats", "table", t.cfg.SrcTable, "column", fk.Column, "parent", fk.Parent, "orphans", fk.orphans.Load(), "action", fk.Orphan())
+		}
+	}
+
+	msg, level := "import success", slog.LevelInfo
 	if failed {
-		title = "[IMPORT FAILED]"
+		msg, level = "import failed", slog.LevelError
 	}
 
-	log.Println("------------------------------------------------------------")
-	log.Println(title)
-	log.Printf("[STATS] staged: files=%s rows=%s", util.FormatNumber(filesStaged), util.FormatNumber(rowsStaged))
-	log.Printf("[STATS] loaded: files=%s rows=%s", util.FormatNumber(filesLoaded), util.FormatNumber(rowsLoaded))
-	log.Printf("[STATS] duration: %s", duration.Truncate(time.Second))
-	log.Printf("[STATS] speed: %.0f rows/s", float64(rowsLoaded)/duration.Seconds())
-	log.Println("------------------------------------------------------------")
+	slog.Log(context.Background(), level, msg, statsFields(&total, duration)...)
+}
+
+// statsFields возвращает поля лога со счетчиками миграции и скоростью загрузки
+func statsFields(st *runStats, duration time.Duration) []any {
+	return []any{
+		"files_staged", st.filesStaged.Load(),
+		"rows_staged", st.rowsStaged.Load(),
+		"files_loaded", st.filesLoaded.Load(),
+		"rows_loaded", st.rowsLoaded.Load(),
+		"stage_retries", st.stageRetries.Load(),
+		"load_retries", st.loadRetries.Load(),
+		"duration", duration.Truncate(time.Second),
+		"rows_per_sec", int64(float64(st.rowsLoaded.Load()) / duration.Seconds()),
+	}
 }
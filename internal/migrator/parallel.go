@@ -0,0 +1,59 @@
+package migrator
+
+import (
+	"context"
+	"logs-migrator/internal/ranger"
+	"sync"
+)
+
+// forEachShard вызывает fn для каждого шарда в workers параллельных горутинах.
+// Первая ошибка останавливает обход и возвращается наружу
+func forEachShard(
+	ctx context.Context,
+	shards []ranger.Range,
+	workers int,
+	fn func(ctx context.Context, idx int, sh ranger.Range) error,
+) error {
+	workCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan int)
+	errs := make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range jobs {
+				if err := fn(workCtx, idx, shards[idx]); err != nil {
+					select {
+					case errs <- err:
+						cancel()
+					default:
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for idx := range shards {
+			select {
+			case <-workCtx.Done():
+				return
+			case jobs <- idx:
+			}
+		}
+	}()
+	wg.Wait()
+
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	return ctx.Err()
+}
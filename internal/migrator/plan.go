@@ -0,0 +1,280 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/journal"
+	"logs-migrator/internal/ranger"
+	"logs-migrator/internal/stagewriter"
+	"logs-migrator/internal/util"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// planSampleShards сколько первых и последних шардов печатать в плане
+const planSampleShards = 3
+
+// Plan печатает план миграции: диапазон ID, шарды, SQL-запросы выгрузки и загрузки, запросы fast-load
+// и оценку количества строк. Выполняет только чтение: не меняет настройки целевой БД и не пишет на диск
+// (журнал читается без создания файла). Для файла заданий план печатается по каждой таблице
+func Plan(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+	w io.Writer,
+) error {
+	for _, tableCfg := range cfg.Tables() {
+		if err := planTable(ctx, srcDb, dstDb, tableCfg, w); err != nil {
+			return fmt.Errorf("%s: %w", tableCfg.SrcTable, err)
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	if cfg.UseFastLoad {
+		fmt.Fprintln(w, "[FAST-LOAD]")
+		for _, query := range dbx.FastLoadStatements(cfg.InnodbBufferPoolSize, cfg.InnodbIOCapacity, cfg.InnodbIOCapacityMax) {
+			fmt.Fprintf(w, "  %s\n", query)
+		}
+		fmt.Fprintln(w, "  (original settings are restored after the run)")
+	} else {
+		fmt.Fprintln(w, "[FAST-LOAD] disabled")
+	}
+	fmt.Fprintln(w, "------------------------------------------------------------")
+
+	return nil
+}
+
+// planTable печатает план миграции одной таблицы
+func planTable(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+	w io.Writer,
+) error {
+	var shards []ranger.Range
+
+	fmt.Fprintln(w, "------------------------------------------------------------")
+	fmt.Fprintln(w, "[PLAN]")
+	fmt.Fprintf(w, "source:       %s (nid: %s)\n", cfg.SrcTable, cfg.SrcNID)
+	if cfg.SrcFilter != "" {
+		fmt.Fprintf(w, "filter:       %s\n", cfg.SrcFilter)
+	}
+	fmt.Fprintf(w, "destination:  %s (nid: %s, uuid: %s)\n", cfg.DstTable, cfg.DstNID, cfg.DstUuid)
+	switch {
+	case cfg.UUIDMapTable != "":
+		fmt.Fprintf(w, "UUID map:     table %s\n", cfg.UUIDMapTable)
+	case cfg.UUIDMapFile != "":
+		fmt.Fprintf(w, "UUID map:     file %s\n", cfg.UUIDMapFile)
+	}
+
+	stageDir, useInsert := planStageDir(ctx, dstDb, cfg, w)
+	cfg.UseInsert = useInsert
+
+	if cfg.RepairGaps {
+		gaps, err := findGaps(ctx, srcDb, dstDb, cfg)
+		if err != nil {
+			return err
+		}
+		shards = gapRanges(gaps)
+		fmt.Fprintf(w, "repair gaps:  %d ranges with missing rows\n", len(gaps))
+	} else {
+		var jr *journal.Journal
+		if cfg.JournalDir != "" {
+			var err error
+			jr, err = journal.Read(cfg.JournalDir, journalKey(cfg))
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "journal:      %s\n", jr.Path())
+		}
+
+		pending, fresh, err := resolveShards(ctx, srcDb, dstDb, cfg, jr)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			fmt.Fprintf(w, "resume:       %d unfinished shards from journal\n", len(pending))
+		}
+		if len(fresh) > 0 {
+			fmt.Fprintf(w, "ID range:     %d - %d\n", fresh[0].From+1, fresh[len(fresh)-1].To)
+		}
+		shards = append(pending, fresh...)
+	}
+
+	fmt.Fprintf(w, "shards:       %s (chunk: %s, split: %s)\n", util.FormatNumber(uint64(len(shards))), util.FormatNumber(uint64(cfg.ChunkSize)), cfg.SplitMode)
+	for i, sh := range shards {
+		if i == planSampleShards && len(shards) > 2*planSampleShards {
+			fmt.Fprintln(w, "  ...")
+		}
+		if i >= planSampleShards && i < len(shards)-planSampleShards {
+			continue
+		}
+		fmt.Fprintf(w, "  #%-6d (%d, %d]\n", i+1, sh.From, sh.To)
+	}
+
+	if len(shards) > 0 {
+		printRowEstimate(ctx, srcDb, cfg, shards, w)
+	}
+
+	m, _, err := tableMapping(ctx, srcDb, dstDb, cfg)
+	if err != nil {
+		return err
+	}
+
+	sample := ranger.Range{}
+	if len(shards) > 0 {
+		sample = shards[0]
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "[SELECT] (parameters: from, to)")
+	fmt.Fprintf(w, "  %s\n", dbx.BuildSelectByRange(cfg.SrcTable, m, cfg.SrcNID, cfg.SrcFilter))
+
+	if len(cfg.ForeignKeys) > 0 {
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, "[FOREIGN KEYS] (parent nids per shard, parameters: from, to)")
+		for _, fk := range cfg.ForeignKeys {
+			from := "destination of " + fk.Parent + " by dst-nid"
+			if cfg.UUIDMapTable != "" {
+				from = "UUID map " + cfg.UUIDMapTable
+			}
+			fmt.Fprintf(w, "  %s -> %s UUID from %s, orphans: %s\n", fk.Column, fk.Parent, from, fk.Orphan())
+			fmt.Fprintf(w, "  %s\n", dbx.BuildDistinctByRange(cfg.SrcTable, fk.Column, cfg.SrcNID, cfg.SrcFilter))
+		}
+	}
+
+	if len(cfg.Transforms) > 0 || len(cfg.Redact) > 0 {
+		fmt.Fprintln(w, "")
+		fmt.Fprintln(w, "[TRANSFORM] (applied in order before the CSV write)")
+		if _, _, err := rowTransforms(cfg, m); err != nil {
+			fmt.Fprintf(w, "  invalid: %v\n", err)
+		}
+		for i, s := range cfg.Transforms {
+			fmt.Fprintf(w, "  #%d %s\n", i+1, strings.TrimSpace(fmt.Sprintf("%s %s %s", s.Type, s.Column, s.Params)))
+		}
+		for _, r := range cfg.Redact {
+			fmt.Fprintf(w, "  redact %s: %s %s\n", r.Label(), r.Action, r.Column)
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	if cfg.UseInsert {
+		fmt.Fprintln(w, "[INSERT] (one transaction per shard)")
+		fmt.Fprintf(w, "  %s\n", dbx.BuildInsertSQL(cfg.DstTable, cfg.DstUuid, m, 1))
+		fmt.Fprintf(w, "  (up to %d rows per statement)\n", insertBatchSize(cfg.InsertBatch, len(m.Loaded())+1))
+	} else {
+		fmt.Fprintln(w, "[LOAD DATA]")
+		stagedPath := filepath.Join(stageDir, stagewriter.FileName(cfg.SrcTable, sample.From, sample.To))
+		if cfg.UseStream {
+			stagedPath = streamReaderPrefix + strings.TrimSuffix(filepath.Base(stagedPath), ".csv")
+		}
+		fmt.Fprintf(w, "  %s\n", dbx.BuildLoadDataSQL(stagedPath, cfg.DstTable, cfg.DstUuid, m, cfg.UseLocalInfile))
+	}
+	if len(m.Defaults) > 0 {
+		fmt.Fprintf(w, "  (column defaults: %s)\n", strings.Join(m.Defaults, ", "))
+	}
+	if cfg.RepairGaps {
+		if cfg.SrcFilter != "" {
+			fmt.Fprintf(w, "  (preceded in the same transaction by: %s, for nids of the shard)\n", dbx.BuildDeleteByIDs(cfg.DstTable, cfg.DstNID, 1))
+		} else {
+			fmt.Fprintf(w, "  (preceded in the same transaction by: %s)\n", dbx.BuildDeleteByRange(cfg.DstTable, cfg.DstNID))
+		}
+	}
+
+	fmt.Fprintln(w, "")
+	fmt.Fprintln(w, "[SCHEMA]")
+	if issues, err := compareSchema(ctx, srcDb, dstDb, cfg, m); err != nil {
+		fmt.Fprintf(w, "  check unavailable: %v\n", err)
+	} else {
+		printIssues(w, issues)
+	}
+
+	return nil
+}
+
+// planStageDir выбирает способ загрузки и директорию для временных файлов так же, как при миграции,
+// но без остановки процесса при ошибке чтения secure_file_priv. Возвращает true, если будет использован INSERT
+func planStageDir(ctx context.Context, dstDb *sql.DB, cfg config.Config, w io.Writer) (string, bool) {
+	if cfg.UseStream {
+		fmt.Fprintln(w, "load mode:    LOCAL INFILE stream, no temp files")
+		return "", false
+	}
+
+	if cfg.UseLocalInfile {
+		fmt.Fprintf(w, "load mode:    LOCAL INFILE, temp dir: %s\n", os.TempDir())
+		return os.TempDir(), false
+	}
+
+	if cfg.UseInsert {
+		fmt.Fprintf(w, "load mode:    batched INSERT (%d rows per statement), temp dir: %s\n", cfg.InsertBatch, os.TempDir())
+		return os.TempDir(), true
+	}
+
+	dir, err := dbx.SecureFilePriv(ctx, dstDb)
+	switch {
+	case err != nil:
+		fmt.Fprintf(w, "load mode:    server INFILE, failed to read secure_file_priv: %v\n", err)
+	case dir == "":
+		fmt.Fprintf(w, "load mode:    batched INSERT (%d rows per statement), secure_file_priv is NULL/empty\n", cfg.InsertBatch)
+		return os.TempDir(), true
+	default:
+		fmt.Fprintf(w, "load mode:    server INFILE, secure_file_priv: %s\n", dir)
+	}
+
+	if dir == "" {
+		dir = "<secure_file_priv>"
+	}
+
+	return dir, false
+}
+
+// printRowEstimate печатает оценку количества строк. Оценка строится по статистике таблицы
+// (TABLE_ROWS) пропорционально доле диапазона ID, попавшей в шарды, и не учитывает -src-filter
+func printRowEstimate(ctx context.Context, srcDb *sql.DB, cfg config.Config, shards []ranger.Range, w io.Writer) {
+	tableRows, err := dbx.EstimateRows(ctx, srcDb, cfg.SrcTable)
+	if err != nil {
+		fmt.Fprintf(w, "rows:         estimate unavailable: %v\n", err)
+		return
+	}
+
+	minID, maxID := dbx.MustPKRange(ctx, srcDb, cfg.SrcTable, cfg.SrcNID, "")
+	rows := estimateShardRows(tableRows, minID, maxID, shards)
+
+	note := ""
+	if strings.TrimSpace(cfg.SrcFilter) != "" {
+		note = " (filter not taken into account)"
+	}
+
+	fmt.Fprintf(w, "rows:         ~%s total, ~%s per shard%s\n",
+		util.FormatNumber(rows),
+		util.FormatNumber(rows/uint64(len(shards))),
+		note,
+	)
+}
+
+// estimateShardRows оценивает количество строк в шардах: строки таблицы считаются равномерно
+// распределенными по диапазону ID [minID, maxID]
+func estimateShardRows(tableRows, minID, maxID uint64, shards []ranger.Range) uint64 {
+	if tableRows == 0 || maxID < minID {
+		return 0
+	}
+
+	var span uint64
+	for _, sh := range shards {
+		span += sh.To - sh.From
+	}
+
+	total := maxID - minID + 1
+	if span >= total {
+		return tableRows
+	}
+
+	return uint64(float64(tableRows) * float64(span) / float64(total))
+}
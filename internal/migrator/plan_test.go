@@ -0,0 +1,52 @@
+package migrator
+
+import (
+	"testing"
+
+	"logs-migrator/internal/ranger"
+)
+
+func TestEstimateShardRows(t *testing.T) {
+	tests := []struct {
+		name      string
+		tableRows uint64
+		minID     uint64
+		maxID     uint64
+		shards    []ranger.Range
+		expected  uint64
+	}{
+		{
+			name:      "whole table",
+			tableRows: 1000,
+			minID:     1,
+			maxID:     100,
+			shards:    ranger.Split(1, 100, 10),
+			expected:  1000,
+		},
+		{
+			name:      "half of the range",
+			tableRows: 1000,
+			minID:     1,
+			maxID:     100,
+			shards:    ranger.Split(51, 100, 10),
+			expected:  500,
+		},
+		{
+			name:      "empty table",
+			tableRows: 0,
+			minID:     0,
+			maxID:     0,
+			shards:    ranger.Split(1, 100, 10),
+			expected:  0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := estimateShardRows(tt.tableRows, tt.minID, tt.maxID, tt.shards)
+			if result != tt.expected {
+				t.Errorf("estimateShardRows() = %d, want %d", result, tt.expected)
+			}
+		})
+	}
+}
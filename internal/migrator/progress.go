@@ -0,0 +1,92 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/progress"
+	"logs-migrator/internal/ranger"
+	"time"
+)
+
+// progressWindow минимальная ширина окна, за которое считается текущая скорость загрузки
+const progressWindow = time.Minute
+
+// startProgress запускает периодический вывод прогресса по всем таблицам запуска и возвращает функцию,
+// которая его останавливает
+func startProgress(ctx context.Context, cfg config.Config, tasks []*tableTask) func() {
+	if cfg.ProgressInterval <= 0 {
+		return func() {}
+	}
+
+	var (
+		shards    int
+		rowsTotal uint64
+	)
+	for _, t := range tasks {
+		shards += len(t.shards)
+		rowsTotal += t.rowsTotal
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	read := func() progress.Snapshot {
+		snap := progress.Snapshot{ShardsTotal: uint64(shards), RowsTotal: rowsTotal}
+		for _, t := range tasks {
+			snap.ShardsDone += t.stats.shardsDone.Load()
+			snap.RowsStaged += t.stats.rowsStaged.Load()
+			snap.RowsLoaded += t.stats.rowsLoaded.Load()
+		}
+		return snap
+	}
+
+	go func() {
+		defer close(done)
+		progress.Run(ctx, cfg.ProgressInterval, max(progressWindow, 4*cfg.ProgressInterval), read, logProgress)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// logProgress выводит строку прогресса
+func logProgress(s progress.Status) {
+	eta := "unknown"
+	if s.ETA > 0 {
+		eta = s.ETA.Truncate(time.Second).String()
+	}
+
+	slog.Info("progress",
+		"percent", float64(int(s.Percent*10))/10,
+		"shards_done", s.ShardsDone,
+		"shards_total", s.ShardsTotal,
+		"rows_staged", s.RowsStaged,
+		"rows_loaded", s.RowsLoaded,
+		"rows_total", s.RowsTotal,
+		"rows_per_sec", int64(s.Rate),
+		"eta", eta,
+	)
+}
+
+// estimateRunRows оценивает количество строк в шардах запуска. При разбивке по плотности каждый шард
+// содержит около -chunk строк, иначе строки таблицы по статистике считаются равномерно распределенными по ID
+func estimateRunRows(ctx context.Context, srcDb *sql.DB, cfg config.Config, shards []ranger.Range) uint64 {
+	if cfg.SplitMode == config.SplitDensity {
+		return uint64(len(shards)) * uint64(cfg.ChunkSize)
+	}
+
+	tableRows, err := dbx.EstimateRows(ctx, srcDb, cfg.SrcTable)
+	if err != nil {
+		slog.Debug("row estimate unavailable", "err", err)
+		return 0
+	}
+
+	minID, maxID := dbx.MustPKRange(ctx, srcDb, cfg.SrcTable, cfg.SrcNID, "")
+
+	return estimateShardRows(tableRows, minID, maxID, shards)
+}
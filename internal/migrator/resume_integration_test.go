@@ -0,0 +1,100 @@
+//go:build integration
+
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Тест продолжения миграции по журналу на живом MySQL. Запуск:
+//
+//	MIGRATOR_TEST_SRC_DSN='root:secret@tcp(127.0.0.1:3306)/cdc_src' \
+//	MIGRATOR_TEST_DST_DSN='root:secret@tcp(127.0.0.1:3306)/cdc_dst' \
+//	go test -tags integration ./internal/migrator -run Resume
+func TestResumeIntegration(t *testing.T) {
+	srcDSN, dstDSN := os.Getenv("MIGRATOR_TEST_SRC_DSN"), os.Getenv("MIGRATOR_TEST_DST_DSN")
+	if srcDSN == "" || dstDSN == "" {
+		t.Skip("MIGRATOR_TEST_SRC_DSN and MIGRATOR_TEST_DST_DSN are not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	srcDb := dbx.MustOpen(srcDSN, 4, false)
+	defer srcDb.Close()
+	dstDb := dbx.MustOpen(dstDSN, 4, false)
+	defer dstDb.Close()
+
+	mustExec(t, srcDb,
+		"DROP TABLE IF EXISTS resume_log",
+		"CREATE TABLE resume_log (id BIGINT NOT NULL PRIMARY KEY, created_at DATETIME NOT NULL, msg VARCHAR(100))",
+		"INSERT INTO resume_log VALUES (1, '2024-01-01 00:00:01', 'a'), (2, '2024-01-01 00:00:02', 'b'), "+
+			"(3, '2024-01-01 00:00:03', 'c'), (4, '2024-01-01 00:00:04', 'd'), (5, '2024-01-01 00:00:05', 'e')",
+	)
+	// nid в целевой таблице не уникален, чтобы повторная загрузка шарда была видна как дубликаты
+	mustExec(t, dstDb,
+		"DROP TABLE IF EXISTS resume_log",
+		"CREATE TABLE resume_log (id BINARY(16) NOT NULL PRIMARY KEY, nid BIGINT NOT NULL, created_at DATETIME NOT NULL, msg VARCHAR(100), KEY (nid))",
+	)
+
+	journalDir := t.TempDir()
+	args := []string{
+		"-src-dsn", srcDSN, "-dst-dsn", dstDSN,
+		"-src-table", "resume_log", "-dst-table", "resume_log",
+		"-chunk", "2", "-insert", "-progress-interval", "0",
+	}
+	cfg := config.ParseConfig(append(args, "-journal-dir", journalDir))
+
+	if err := Run(ctx, srcDb, dstDb, t.TempDir(), cfg); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// Падение после коммита загрузки, но до записи loaded: шарды остаются в журнале незавершенными
+	matches, _ := filepath.Glob(filepath.Join(journalDir, "journal_*.jsonl"))
+	if len(matches) != 1 {
+		t.Fatalf("journals = %v, want one", matches)
+	}
+	data, err := os.ReadFile(matches[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, line := range strings.SplitAfter(string(data), "\n") {
+		if !strings.Contains(line, `"loaded"`) {
+			kept = append(kept, line)
+		}
+	}
+	if err := os.WriteFile(matches[0], []byte(strings.Join(kept, "")), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Run(ctx, srcDb, dstDb, t.TempDir(), cfg); err != nil {
+		t.Fatalf("resumed Run() error = %v", err)
+	}
+	if rows, nids := countRows(t, dstDb); rows != 5 || nids != 5 {
+		t.Errorf("destination rows = %d, distinct nids = %d, want 5 and 5", rows, nids)
+	}
+
+	// Без журнала непустая целевая таблица не продолжается по MAX(nid)
+	err = Run(ctx, srcDb, dstDb, t.TempDir(), config.ParseConfig(args))
+	if err == nil || !strings.Contains(err.Error(), "-journal-dir") {
+		t.Errorf("Run() without journal error = %v, want refusal", err)
+	}
+}
+
+func countRows(t *testing.T, db *sql.DB) (rows, nids int) {
+	t.Helper()
+
+	if err := db.QueryRow("SELECT COUNT(*), COUNT(DISTINCT nid) FROM resume_log").Scan(&rows, &nids); err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return rows, nids
+}
@@ -0,0 +1,88 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"logs-migrator/internal/ranger"
+	"logs-migrator/internal/stagewriter"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// streamReaderPrefix префикс имени файла, по которому драйвер отдает зарегистрированный io.Reader
+const streamReaderPrefix = "Reader::"
+
+// processShardToStream выгружает шард из источника прямо в LOAD DATA LOCAL INFILE через io.Pipe без временного
+// файла. Поток регистрируется в драйвере как 'Reader::<name>' и ставится в очередь load-воркеров, после чего
+// stage-воркер пишет в него строки и ждет результат загрузки. При повторе (replace) загрузка сначала удаляет
+// диапазон из целевой таблицы
+func processShardToStream(
+	ctx context.Context,
+	db *sql.DB,
+	t *tableTask,
+	job ranger.Range,
+	replace bool,
+	out chan<- loadJob,
+) (uint64, error) {
+	cfg := t.cfg
+	name := strings.TrimSuffix(stagewriter.FileName(cfg.SrcTable, job.From, job.To), ".csv")
+
+	pr, pw := io.Pipe()
+	mysql.RegisterReaderHandler(name, func() io.Reader { return pr })
+	defer mysql.DeregisterReaderHandler(name)
+
+	// Если работа отменена, пока поток ждет load-воркера, разблокируем запись
+	stop := context.AfterFunc(ctx, func() { _ = pr.CloseWithError(ctx.Err()) })
+	defer stop()
+
+	done := make(chan error, 1)
+
+	// Поток нельзя перечитать, поэтому nid строк, которые заменяет загрузка таблицы с фильтром, читаются заранее
+	var nids []uint64
+	if (replace || cfg.RepairGaps) && cfg.SrcFilter != "" {
+		var err error
+		if nids, err = distinctNIDs(ctx, db, cfg, cfg.SrcNID, job.From, job.To); err != nil {
+			return 0, err
+		}
+	}
+
+	rec := newUUIDRecorder(t)
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case out <- loadJob{task: t, Range: job, Path: streamReaderPrefix + name, Replace: replace, NIDs: nids, Stream: pr, Done: done, Map: rec}:
+	}
+
+	writer := stagewriter.NewStream(pw, t.tsIndex, t.loc)
+	err := writeShardRows(ctx, db, t, job.From, job.To, writer, t.uuidFunc, rec)
+	if err == nil {
+		err = writer.Close()
+	}
+
+	// Закрываем поток: с ошибкой загрузка оборвется и откатится, без ошибки load-воркер получит EOF
+	if err != nil {
+		_ = pw.CloseWithError(err)
+	} else {
+		_ = pw.Close()
+	}
+
+	var loadErr error
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case loadErr = <-done:
+	}
+
+	if err != nil {
+		return 0, err
+	}
+	if loadErr != nil {
+		return 0, fmt.Errorf("LOAD DATA stream: %w", loadErr)
+	}
+
+	return writer.RowsWritten(), nil
+}
@@ -0,0 +1,274 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/journal"
+	"logs-migrator/internal/ranger"
+	"logs-migrator/internal/redact"
+	"logs-migrator/internal/stagewriter"
+	"logs-migrator/internal/uuidmap"
+	"logs-migrator/pkg/transform"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// tableTask таблица запуска: ее конфиг, колонки, журнал, шарды и счетчики. Шарды всех таблиц
+// обрабатывает общий пул воркеров, поэтому все, что относится к таблице, едет вместе с шардом
+type tableTask struct {
+	cfg     config.Config
+	mapping dbx.ColumnMapping
+	loc     *time.Location
+	jr      *journal.Journal
+	gaps    []gap
+	shards  []ranger.Range
+
+	// resumed количество шардов в начале shards, взятых из журнала незавершенными. Такой шард мог успеть
+	// загрузиться до падения, поэтому его загрузка заменяет строки шарда в целевой таблице
+	resumed int
+
+	// tsIndex индекс выгружаемого поля с временной меткой для UUIDv7
+	tsIndex int
+
+	// uuidFunc способ формирования UUID строк, nil - UUIDv7 со случайными битами
+	uuidFunc stagewriter.UUIDFunc
+
+	// fks внешние ключи: поля с nid родительских строк, которые заменяются на UUID родителей
+	fks []*foreignKey
+
+	// uuidMap карта UUID, в которую stage-воркеры записывают nid и UUID выгруженных строк, nil - выключена.
+	// nidIndex индекс поля с nid строки
+	uuidMap  uuidmap.Sink
+	nidIndex int
+
+	// transform трансформеры строк, которые stage-воркеры применяют между Scan и записью в CSV. Последним
+	// в цепочке идет redactor, если у таблицы есть правила маскирования
+	transform transform.Chain
+	redactor  *redact.Redactor
+
+	// rowsTotal оценка количества строк для вывода прогресса
+	rowsTotal uint64
+
+	// followFrom ID, после которого слежение ищет новые строки. followSeen - MAX(nid), увиденные опросами
+	// и еще не перенесенные из-за -follow-lag
+	followFrom uint64
+	followSeen []followMark
+
+	stats runStats
+
+	// finished время загрузки последнего шарда таблицы, UnixNano
+	finished atomic.Int64
+}
+
+// shardJob шард таблицы в очереди stage-воркеров. Replace - загрузка шарда заменяет его строки
+// в целевой таблице (см. loadJob.Replace)
+type shardJob struct {
+	task *tableTask
+	ranger.Range
+	Replace bool
+}
+
+// prepareTable определяет шарды и колонки таблицы. Задание возвращается и вместе с ошибкой,
+// чтобы вызывающий мог закрыть уже открытый журнал
+func prepareTable(ctx context.Context, srcDb, dstDb *sql.DB, cfg config.Config) (*tableTask, error) {
+	loc, err := time.LoadLocation(cfg.UUIDTZ)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &tableTask{cfg: cfg, loc: loc}
+	t.stats.table = cfg.SrcTable
+
+	switch {
+	case cfg.Command == config.CommandCDC:
+		// Перенос изменений не планирует шарды и не ведет журнал: диапазоны строятся по nid из binlog,
+		// а позицию хранит контрольная точка binlog
+	case cfg.RepairGaps:
+		// В режиме восстановления мигрируем заново только шарды, в которых целевой таблице не хватает строк.
+		// Журнал не используется: повторный запуск сам найдет диапазоны, которые остались неполными
+		t.gaps, err = findGaps(ctx, srcDb, dstDb, cfg)
+		if err != nil {
+			return t, err
+		}
+		if len(t.gaps) == 0 {
+			slog.Info("no gaps found, destination is complete", "table", cfg.SrcTable)
+			return t, nil
+		}
+		t.shards = gapRanges(t.gaps)
+	default:
+		// Открываем журнал шардов
+		t.jr, err = openJournal(cfg)
+		if err != nil {
+			return t, err
+		}
+
+		// Определяем шарды, которые нужно мигрировать: незавершенные из журнала и новые
+		t.shards, t.resumed, err = planShards(ctx, srcDb, dstDb, cfg, t.jr)
+		if err != nil {
+			return t, err
+		}
+		// Слежению колонки и трансформеры нужны и без новых строк
+		if len(t.shards) == 0 {
+			slog.Info("no new rows to migrate", "table", cfg.SrcTable)
+			if !cfg.Follow {
+				return t, nil
+			}
+		}
+		slog.Info("shards planned", "table", cfg.SrcTable, "shards", len(t.shards))
+	}
+
+	t.mapping, t.tsIndex, err = tableMapping(ctx, srcDb, dstDb, cfg)
+	if err != nil {
+		return t, err
+	}
+
+	t.fks, err = foreignKeys(cfg, &t.mapping)
+	if err != nil {
+		return t, err
+	}
+
+	t.uuidFunc = uuidFunc(cfg, t.mapping)
+	if needsNID(cfg) {
+		t.nidIndex = t.mapping.SourceField(cfg.SrcNID)
+	}
+
+	t.transform, t.redactor, err = rowTransforms(cfg, t.mapping)
+	if err != nil {
+		return t, err
+	}
+
+	// Проверяем совместимость схем до того, как данные начнут переноситься
+	if err := preflightSchema(ctx, srcDb, dstDb, cfg, t.mapping); err != nil {
+		return t, err
+	}
+
+	// Оцениваем объем работы для вывода прогресса. При восстановлении пропусков количество строк известно точно
+	if cfg.ProgressInterval > 0 && len(t.shards) > 0 {
+		if cfg.RepairGaps {
+			for _, g := range t.gaps {
+				t.rowsTotal += g.Src
+			}
+		} else {
+			t.rowsTotal = estimateRunRows(ctx, srcDb, cfg, t.shards)
+		}
+	}
+
+	return t, nil
+}
+
+// shardDone отмечает загруженный шард и запоминает время, когда таблица загружена целиком
+func (t *tableTask) shardDone() {
+	if t.stats.shardsDone.Add(1) == uint64(len(t.shards)) {
+		t.finished.Store(time.Now().UnixNano())
+	}
+}
+
+// close закрывает журнал таблицы
+func (t *tableTask) close() {
+	if err := t.jr.Close(); err != nil {
+		slog.Warn("failed to close journal", "table", t.cfg.SrcTable, "err", err)
+	}
+}
+
+// tableMapping возвращает соответствие колонок таблицы и индекс поля с временной меткой для UUIDv7.
+// Колонки берутся из конфига, если они заданы в файле заданий, иначе все колонки таблиц по порядку.
+// Без правил в файле заданий колонки сопоставляются по позиции
+func tableMapping(ctx context.Context, srcDb, dstDb *sql.DB, cfg config.Config) (dbx.ColumnMapping, int, error) {
+	src := cfg.SrcColumns
+	if len(src) == 0 {
+		src = dbx.MustTableColumns(ctx, srcDb, cfg.SrcTable)
+	}
+
+	// Типы колонок целевой таблицы определяют выражения выгрузки и загрузки значений
+	dstSchema, err := dbx.TableSchema(ctx, dstDb, cfg.DstTable)
+	if err != nil {
+		return dbx.ColumnMapping{}, 0, err
+	}
+
+	dst := cfg.DstColumns
+	if len(dst) == 0 {
+		for _, c := range dstSchema {
+			dst = append(dst, c.Name)
+		}
+	}
+
+	m := dbx.PositionalMapping(src, dst)
+	if len(cfg.ColumnMap) > 0 || len(cfg.DropColumns) > 0 {
+		if m, err = dbx.BuildColumnMapping(src, dst, cfg.DstUuid, cfg.ColumnMap, cfg.DropColumns); err != nil {
+			return dbx.ColumnMapping{}, 0, fmt.Errorf("column mapping: %w", err)
+		}
+	}
+	m.SetTypes(dstSchema)
+
+	// Внешние ключи выгружаются как есть и загружаются UUID родителя, а не по типу колонки
+	for _, fk := range cfg.ForeignKeys {
+		if _, err := m.SetRef(fk.Column); err != nil {
+			return dbx.ColumnMapping{}, 0, err
+		}
+	}
+
+	m.UUIDFormat, err = uuidFormat(cfg, dstSchema)
+	if err != nil {
+		return dbx.ColumnMapping{}, 0, err
+	}
+
+	// Детерминированным и монотонным UUID, карте UUID и переносу изменений нужен nid каждой строки, даже если
+	// соответствие его не загружает
+	if needsNID(cfg) {
+		m.SourceField(cfg.SrcNID)
+	}
+
+	// Колонка с временной меткой задается именем или позицией в таблице-источнике. Если соответствие ее
+	// не переносит, она все равно выгружается, но не загружается
+	tsColumn := cfg.TSColumn
+	if tsColumn == "" {
+		if cfg.TSColumnIdx > len(src) {
+			return dbx.ColumnMapping{}, 0, fmt.Errorf("ts-idx %d is out of range: source has %d columns", cfg.TSColumnIdx, len(src))
+		}
+		tsColumn = src[cfg.TSColumnIdx-1]
+	} else if !slices.ContainsFunc(src, func(col string) bool { return strings.EqualFold(col, tsColumn) }) {
+		return dbx.ColumnMapping{}, 0, fmt.Errorf("ts column %s not found in source", tsColumn)
+	}
+
+	return m, m.SourceField(tsColumn), nil
+}
+
+// rowTransforms строит цепочку трансформеров строк таблицы. Маскирование применяется последним, чтобы
+// персональные данные не вернулись в строку после него
+func rowTransforms(cfg config.Config, m dbx.ColumnMapping) (transform.Chain, *redact.Redactor, error) {
+	fields := transformFields(m)
+
+	chain, err := transform.Build(cfg.Transforms, fields)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cfg.Redact) == 0 {
+		return chain, nil, nil
+	}
+
+	r, err := redact.New(cfg.Redact, fields, []byte(cfg.RedactKey))
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(chain, r), r, nil
+}
+
+// transformFields возвращает имена полей строки для трансформеров: целевая колонка поля, а для полей,
+// которые только выгружаются, - колонка источника
+func transformFields(m dbx.ColumnMapping) transform.Fields {
+	fields := make(transform.Fields, 0, len(m.Fields))
+	for _, f := range m.Fields {
+		name := f.Dst
+		if name == "" {
+			name = f.Src
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
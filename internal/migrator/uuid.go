@@ -0,0 +1,171 @@
+package migrator
+
+import (
+	"context"
+	"fmt"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/stagewriter"
+	"logs-migrator/internal/uuidmap"
+	"logs-migrator/internal/uuidv7"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// uuidFunc возвращает способ формирования UUID строк таблицы по -uuid-key, -uuid-monotonic и формату UUID:
+//   - с ключом случайные биты UUIDv7 берутся из HMAC от таблицы-источника и nid строки, и повторная
+//     миграция диапазона дает те же UUID;
+//   - монотонные UUID сортируются по (ts, nid): доля миллисекунды и nid занимают rand_a и начало rand_b;
+//   - форматы canonical и swapped перекодируют 32 hex-символа так, как их ждет колонка UUID.
+//
+// nil - UUIDv7 со случайными битами в 32 hex-символах
+func uuidFunc(cfg config.Config, m dbx.ColumnMapping) stagewriter.UUIDFunc {
+	gen := rowUUIDFunc(cfg, m)
+
+	format := m.UUIDFormat
+	if format != uuidv7.FormatCanonical && format != uuidv7.FormatSwapped {
+		return gen
+	}
+	if gen == nil {
+		gen = randomUUID
+	}
+
+	return func(ts time.Time, values []any) (string, error) {
+		uuid, err := gen(ts, values)
+		if err != nil {
+			return "", err
+		}
+		return uuidv7.Encode(uuid, format), nil
+	}
+}
+
+// randomUUID UUIDv7 со случайными битами в 32 hex-символах
+func randomUUID(ts time.Time, _ []any) (string, error) {
+	return uuidv7.FromTime(ts)
+}
+
+// needsNID возвращает true, если nid строки нужен при выгрузке: для детерминированных и монотонных UUID,
+// для карты UUID, для переноса изменений, который сохраняет UUID уже загруженных строк, и для таблиц с фильтром,
+// у которых повтор удаляет из целевой таблицы только строки шарда
+func needsNID(cfg config.Config) bool {
+	return cfg.UUIDKey != "" || cfg.UUIDMonotonic || cfg.UUIDMapTable != "" || cfg.UUIDMapFile != "" ||
+		cfg.Command == config.CommandCDC || cfg.SrcFilter != ""
+}
+
+// uuidRecorder собирает записи карты UUID одного шарда при выгрузке. В карту они записываются только после
+// загрузки шарда (record), чтобы в ней не оказалось UUID строк, которых нет в целевой таблице
+type uuidRecorder struct {
+	sink     uuidmap.Sink
+	table    string
+	format   string
+	nidIndex int
+	entries  []uuidmap.Entry
+}
+
+// newUUIDRecorder возвращает сборщик записей карты для шарда таблицы или nil, если карта выключена
+func newUUIDRecorder(t *tableTask) *uuidRecorder {
+	if t.uuidMap == nil {
+		return nil
+	}
+	return &uuidRecorder{sink: t.uuidMap, table: t.cfg.SrcTable, format: t.mapping.UUIDFormat, nidIndex: t.nidIndex}
+}
+
+// record записывает собранные записи в карту UUID. nil - карта выключена
+func (r *uuidRecorder) record(ctx context.Context) error {
+	if r == nil || len(r.entries) == 0 {
+		return nil
+	}
+	return r.sink.Write(ctx, r.entries)
+}
+
+// wrap возвращает генератор UUID, который запоминает UUID каждой строки вместе с ее nid. В карту UUID
+// попадает в 32 hex-символах независимо от формата целевой колонки
+func (r *uuidRecorder) wrap(gen stagewriter.UUIDFunc) stagewriter.UUIDFunc {
+	if gen == nil {
+		gen = randomUUID
+	}
+
+	return func(ts time.Time, values []any) (string, error) {
+		uuid, err := gen(ts, values)
+		if err != nil {
+			return "", err
+		}
+		nid, err := nidValue(values[r.nidIndex])
+		if err != nil {
+			return "", err
+		}
+		r.entries = append(r.entries, uuidmap.Entry{Table: r.table, NID: nid, UUID: uuidv7.Decode(uuid, r.format)})
+		return uuid, nil
+	}
+}
+
+// rowUUIDFunc возвращает генератор UUID, которому нужен nid строки, или nil для случайных UUIDv7
+func rowUUIDFunc(cfg config.Config, m dbx.ColumnMapping) stagewriter.UUIDFunc {
+	if cfg.UUIDKey == "" && !cfg.UUIDMonotonic {
+		return nil
+	}
+
+	// Поле с nid уже есть в соответствии: tableMapping добавляет его при заданном ключе или монотонности
+	key := []byte(cfg.UUIDKey)
+	nidIndex := m.SourceField(cfg.SrcNID)
+
+	return func(ts time.Time, values []any) (string, error) {
+		nid, err := nidValue(values[nidIndex])
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case cfg.UUIDMonotonic && len(key) > 0:
+			return uuidv7.MonotonicKeyed(ts, key, cfg.SrcTable, nid), nil
+		case cfg.UUIDMonotonic:
+			return uuidv7.Monotonic(ts, nid)
+		default:
+			return uuidv7.Keyed(ts, key, cfg.SrcTable, nid), nil
+		}
+	}
+}
+
+// uuidFormat возвращает формат UUID таблицы: заданный в конфиге или определенный по типу колонки UUID
+func uuidFormat(cfg config.Config, dst []dbx.ColumnInfo) (string, error) {
+	if cfg.UUIDFormat != config.UUIDFormatAuto && cfg.UUIDFormat != "" {
+		return cfg.UUIDFormat, nil
+	}
+
+	for _, c := range dst {
+		if strings.EqualFold(c.Name, cfg.DstUuid) {
+			return dbx.DetectUUIDFormat(c)
+		}
+	}
+	return "", fmt.Errorf("destination %s has no UUID column %s", cfg.DstTable, cfg.DstUuid)
+}
+
+// nidValue возвращает числовой ID строки из значения, которое вернул Scan
+func nidValue(v any) (uint64, error) {
+	switch x := v.(type) {
+	case int64:
+		if x < 0 {
+			return 0, fmt.Errorf("negative nid %d", x)
+		}
+		return uint64(x), nil
+	case uint64:
+		return x, nil
+	case []byte:
+		return parseNID(string(x))
+	case string:
+		return parseNID(x)
+	case nil:
+		return 0, fmt.Errorf("nid is NULL")
+	default:
+		return 0, fmt.Errorf("unsupported nid value of type %T", v)
+	}
+}
+
+func parseNID(s string) (uint64, error) {
+	nid, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse nid: %w", err)
+	}
+	return nid, nil
+}
@@ -0,0 +1,185 @@
+package migrator
+
+import (
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/uuidmap"
+	"logs-migrator/internal/uuidv7"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNIDValue(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		want    uint64
+		wantErr bool
+	}{
+		{name: "int64", value: int64(42), want: 42},
+		{name: "uint64", value: uint64(1 << 63), want: 1 << 63},
+		{name: "bytes", value: []byte("18446744073709551615"), want: 18446744073709551615},
+		{name: "string", value: "7", want: 7},
+		{name: "negative", value: int64(-1), wantErr: true},
+		{name: "null", value: nil, wantErr: true},
+		{name: "not a number", value: []byte("abc"), wantErr: true},
+		{name: "float", value: 1.5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nidValue(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nidValue() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("nidValue() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUUIDFunc_Keyed(t *testing.T) {
+	cfg := config.Config{SrcTable: "log", SrcNID: "id", UUIDKey: "secret"}
+	if uuidFunc(config.Config{SrcNID: "id"}, dbx.ColumnMapping{}) != nil {
+		t.Fatal("uuidFunc() without key must keep random UUIDs")
+	}
+
+	// nid не загружается: tableMapping добавляет поле, которое только выгружается
+	m := dbx.ColumnMapping{Fields: []dbx.MappedField{{Src: "ins_ts", Dst: "ins_ts"}, {Src: "id"}}}
+	fn := uuidFunc(cfg, m)
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	first, err := fn(ts, []any{[]byte("2024-01-01 12:00:00"), int64(42)})
+	if err != nil {
+		t.Fatalf("uuid func error = %v", err)
+	}
+	again, _ := fn(ts, []any{[]byte("2024-01-01 12:00:00"), []byte("42")})
+	other, _ := fn(ts, []any{[]byte("2024-01-01 12:00:00"), int64(43)})
+
+	if first != again {
+		t.Errorf("same row got different UUIDs: %s and %s", first, again)
+	}
+	if first == other {
+		t.Errorf("different rows got the same UUID %s", first)
+	}
+}
+
+func TestUUIDFunc_Monotonic(t *testing.T) {
+	m := dbx.ColumnMapping{Fields: []dbx.MappedField{{Src: "id", Dst: "nid"}, {Src: "ins_ts", Dst: "ins_ts"}}}
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, key := range []string{"", "secret"} {
+		fn := uuidFunc(config.Config{SrcTable: "log", SrcNID: "id", UUIDKey: key, UUIDMonotonic: true}, m)
+
+		var prev string
+		for nid := int64(1); nid <= 3; nid++ {
+			uuid, err := fn(ts, []any{nid, []byte("2024-01-01 12:00:00")})
+			if err != nil {
+				t.Fatalf("uuid func error = %v", err)
+			}
+			if uuid <= prev {
+				t.Errorf("key %q: nid %d got %s, not after %s", key, nid, uuid, prev)
+			}
+			prev = uuid
+		}
+	}
+}
+
+func TestUUIDFunc_Format(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	row := []any{int64(42), []byte("2024-01-01 12:00:00")}
+	m := dbx.ColumnMapping{Fields: []dbx.MappedField{{Src: "id", Dst: "nid"}, {Src: "ins_ts", Dst: "ins_ts"}}}
+
+	for _, format := range []string{uuidv7.FormatBinary, uuidv7.FormatHex} {
+		m.UUIDFormat = format
+		if uuidFunc(config.Config{SrcNID: "id"}, m) != nil {
+			t.Errorf("format %s: random 32-hex UUIDs need no uuid func", format)
+		}
+	}
+
+	m.UUIDFormat = uuidv7.FormatCanonical
+	uuid, err := uuidFunc(config.Config{SrcNID: "id"}, m)(ts, row)
+	if err != nil || len(uuid) != 36 || strings.Count(uuid, "-") != 4 {
+		t.Errorf("canonical uuid = %q, err = %v", uuid, err)
+	}
+
+	cfg := config.Config{SrcTable: "log", SrcNID: "id", UUIDKey: "secret"}
+	m.UUIDFormat = uuidv7.FormatSwapped
+	swapped, _ := uuidFunc(cfg, m)(ts, row)
+	m.UUIDFormat = uuidv7.FormatBinary
+	plain, _ := uuidFunc(cfg, m)(ts, row)
+	if want := uuidv7.Encode(plain, uuidv7.FormatSwapped); swapped != want {
+		t.Errorf("swapped uuid = %s, want %s", swapped, want)
+	}
+}
+
+func TestUUIDFormat(t *testing.T) {
+	dst := []dbx.ColumnInfo{
+		{Name: "id", DataType: "char", ColumnType: "char(36)", MaxLength: 36},
+		{Name: "nid", DataType: "bigint", ColumnType: "bigint"},
+	}
+
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		want    string
+		wantErr bool
+	}{
+		{name: "auto", cfg: config.Config{DstUuid: "ID", UUIDFormat: config.UUIDFormatAuto}, want: uuidv7.FormatCanonical},
+		{name: "explicit", cfg: config.Config{DstUuid: "id", UUIDFormat: uuidv7.FormatHex}, want: uuidv7.FormatHex},
+		{name: "no uuid column", cfg: config.Config{DstTable: "log", DstUuid: "uuid", UUIDFormat: config.UUIDFormatAuto}, wantErr: true},
+		{name: "undetectable type", cfg: config.Config{DstUuid: "nid", UUIDFormat: config.UUIDFormatAuto}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := uuidFormat(tt.cfg, dst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("uuidFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("uuidFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUUIDRecorder(t *testing.T) {
+	if newUUIDRecorder(&tableTask{}) != nil {
+		t.Fatal("newUUIDRecorder() without UUID map must return nil")
+	}
+
+	task := &tableTask{
+		cfg:      config.Config{SrcTable: "log"},
+		mapping:  dbx.ColumnMapping{UUIDFormat: uuidv7.FormatSwapped},
+		uuidMap:  uuidmap.NewFile(""),
+		nidIndex: 1,
+	}
+	rec := newUUIDRecorder(task)
+	fn := rec.wrap(uuidFunc(task.cfg, task.mapping))
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var written []string
+	for nid := int64(1); nid <= 2; nid++ {
+		uuid, err := fn(ts, []any{[]byte("2024-01-01 12:00:00"), nid})
+		if err != nil {
+			t.Fatalf("uuid func error = %v", err)
+		}
+		written = append(written, uuid)
+	}
+
+	if len(rec.entries) != 2 {
+		t.Fatalf("recorded %d entries, want 2", len(rec.entries))
+	}
+	for i, e := range rec.entries {
+		// В карту попадает UUID в порядке байт RFC, а в целевую колонку - переставленный
+		if e.Table != "log" || e.NID != uint64(i+1) || uuidv7.Encode(e.UUID, uuidv7.FormatSwapped) != written[i] {
+			t.Errorf("entry %d = %+v, written UUID %s", i, e, written[i])
+		}
+		if !strings.HasPrefix(e.UUID, "018cc") {
+			t.Errorf("entry %d UUID %s does not start with the timestamp", i, e.UUID)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package migrator
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/ranger"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shardCheck результат сверки одного шарда
+type shardCheck struct {
+	Range       ranger.Range
+	SrcRows     uint64
+	DstRows     uint64
+	SrcChecksum uint64
+	DstChecksum uint64
+}
+
+func (c shardCheck) matches() bool {
+	return c.SrcRows == c.DstRows && c.SrcChecksum == c.DstChecksum
+}
+
+// Verify сверяет источник и целевую таблицу по тем же шардам, что и миграция: для каждого шарда считает
+// количество строк и контрольную сумму общих колонок с обеих сторон. Сгенерированная UUID-колонка и колонки,
+// которые меняют трансформеры и маскирование, в контрольной сумме не участвуют. С -src-filter в целевой
+// таблице сверяются только строки с nid строк источника. Если есть расхождения, они печатаются
+// (и выгружаются в -verify-out) и возвращается ошибка. Таблицы из файла заданий сверяются по очереди,
+// расхождения в одной таблице не останавливают сверку остальных
+func Verify(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+) error {
+	tables := cfg.Tables()
+
+	var errs []error
+	for _, tableCfg := range tables {
+		// Расхождения каждой таблицы выгружаются в свой файл: report.csv -> report.<таблица>.csv
+		if len(tables) > 1 && tableCfg.VerifyOut != "" {
+			ext := filepath.Ext(tableCfg.VerifyOut)
+			tableCfg.VerifyOut = strings.TrimSuffix(tableCfg.VerifyOut, ext) + "." + tableCfg.SrcTable + ext
+		}
+
+		if err := verifyTable(ctx, srcDb, dstDb, tableCfg); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", tableCfg.SrcTable, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// verifyTable сверяет одну таблицу
+func verifyTable(
+	ctx context.Context,
+	srcDb,
+	dstDb *sql.DB,
+	cfg config.Config,
+) error {
+	minID, maxID := dbx.MustPKRange(ctx, srcDb, cfg.SrcTable, cfg.SrcNID, cfg.SrcFilter)
+	if maxID == 0 || maxID < minID {
+		slog.Info("source is empty, nothing to verify", "table", cfg.SrcTable)
+		return nil
+	}
+
+	shards, err := splitRange(ctx, srcDb, cfg, minID, maxID)
+	if err != nil {
+		return err
+	}
+	slog.Info("verifying shards", "table", cfg.SrcTable, "shards", len(shards), "min", minID, "max", maxID)
+
+	m, _, err := tableMapping(ctx, srcDb, dstDb, cfg)
+	if err != nil {
+		return err
+	}
+
+	// Сравниваются колонки, которые копируются без преобразования
+	srcColumns, dstColumns := m.Pairs()
+	if len(srcColumns) == 0 {
+		return fmt.Errorf("source and destination tables have no shared columns")
+	}
+
+	// Значения колонок, которые меняют трансформеры и правила маскирования, в источнике и целевой таблице
+	// различаются, поэтому по ним сверяется только количество строк
+	var changed []string
+	srcColumns, dstColumns, changed = checksumColumns(cfg, srcColumns, dstColumns)
+	if len(changed) > 0 {
+		slog.Info("changed columns are verified by row count only", "table", cfg.SrcTable, "columns", changed)
+	}
+
+	start := time.Now()
+
+	results := make([]shardCheck, len(shards))
+	err = forEachShard(ctx, shards, cfg.StageWorkers, func(ctx context.Context, idx int, sh ranger.Range) error {
+		srcRows, srcSum, err := dbx.ChecksumByRange(ctx, srcDb, cfg.SrcTable, srcColumns, cfg.SrcNID, cfg.SrcFilter, sh.From, sh.To)
+		if err != nil {
+			return err
+		}
+
+		dstRows, dstSum, err := dstChecksum(ctx, srcDb, dstDb, cfg, dstColumns, sh)
+		if err != nil {
+			return err
+		}
+
+		results[idx] = shardCheck{Range: sh, SrcRows: srcRows, DstRows: dstRows, SrcChecksum: srcSum, DstChecksum: dstSum}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	var mismatched []shardCheck
+	var srcTotal, dstTotal uint64
+	for _, r := range results {
+		srcTotal += r.SrcRows
+		dstTotal += r.DstRows
+		if !r.matches() {
+			mismatched = append(mismatched, r)
+		}
+	}
+
+	printVerifyStats(cfg.SrcTable, start, len(shards), srcTotal, dstTotal, mismatched)
+
+	if cfg.VerifyOut != "" {
+		if err := writeMismatches(cfg.VerifyOut, mismatched); err != nil {
+			return err
+		}
+		slog.Info("mismatched ranges written", "table", cfg.SrcTable, "file", cfg.VerifyOut)
+	}
+
+	if len(mismatched) > 0 {
+		return fmt.Errorf("verification failed: %d of %d shards mismatched", len(mismatched), len(shards))
+	}
+
+	return nil
+}
+
+// checksumColumns убирает из пар колонок те, которые меняют трансформеры и правила маскирования,
+// и возвращает их целевые колонки отдельно. Трансформер без колонки может менять любое поле строки,
+// тогда контрольная сумма не считается вовсе
+func checksumColumns(cfg config.Config, src, dst []string) ([]string, []string, []string) {
+	changed := make(map[string]bool)
+	for _, s := range cfg.Transforms {
+		if s.Column == "" {
+			return nil, nil, dst
+		}
+		changed[strings.ToLower(s.Column)] = true
+	}
+	for _, r := range cfg.Redact {
+		changed[strings.ToLower(r.Column)] = true
+	}
+
+	var keepSrc, keepDst, skipped []string
+	for i := range dst {
+		if changed[strings.ToLower(dst[i])] {
+			skipped = append(skipped, dst[i])
+			continue
+		}
+		keepSrc = append(keepSrc, src[i])
+		keepDst = append(keepDst, dst[i])
+	}
+	return keepSrc, keepDst, skipped
+}
+
+// writeMismatches выгружает расхождения в CSV
+func writeMismatches(path string, mismatched []shardCheck) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create verify report: %w", err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	_ = w.Write([]string{"from", "to", "src_rows", "dst_rows", "src_checksum", "dst_checksum"})
+	for _, m := range mismatched {
+		_ = w.Write([]string{
+			strconv.FormatUint(m.Range.From, 10),
+			strconv.FormatUint(m.Range.To, 10),
+			strconv.FormatUint(m.SrcRows, 10),
+			strconv.FormatUint(m.DstRows, 10),
+			strconv.FormatUint(m.SrcChecksum, 10),
+			strconv.FormatUint(m.DstChecksum, 10),
+		})
+	}
+	w.Flush()
+
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("write verify report: %w", err)
+	}
+
+	return file.Close()
+}
+
+// printVerifyStats печатает итоги сверки
+func printVerifyStats(table string, start time.Time, shards int, srcRows, dstRows uint64, mismatched []shardCheck) {
+	for _, m := range mismatched {
+		slog.Warn("mismatched range",
+			"table", table,
+			"from", m.Range.From, "to", m.Range.To,
+			"src_rows", m.SrcRows, "dst_rows", m.DstRows,
+			"src_checksum", m.SrcChecksum, "dst_checksum", m.DstChecksum,
+		)
+	}
+
+	msg, level := "verify success", slog.LevelInfo
+	if len(mismatched) > 0 {
+		msg, level = "verify failed", slog.LevelError
+	}
+
+	slog.Log(context.Background(), level, msg,
+		"table", table,
+		"shards", shards,
+		"mismatched", len(mismatched),
+		"src_rows", srcRows,
+		"dst_rows", dstRows,
+		"duration", time.Since(start).Truncate(time.Second),
+	)
+}
@@ -0,0 +1,62 @@
+package migrator
+
+import (
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/redact"
+	"logs-migrator/pkg/transform"
+	"reflect"
+	"testing"
+)
+
+func TestChecksumColumns(t *testing.T) {
+	src := []string{"created_at", "msg", "level", "email"}
+	dst := []string{"created_at", "message", "level", "email"}
+
+	tests := []struct {
+		name        string
+		cfg         config.Config
+		wantSrc     []string
+		wantDst     []string
+		wantChanged []string
+	}{
+		{
+			name:    "no transforms",
+			wantSrc: src,
+			wantDst: dst,
+		},
+		{
+			name: "transformed column counted only",
+			cfg: config.Config{Transforms: []transform.Spec{
+				{Type: "trim", Column: "MESSAGE"},
+				{Type: "map", Column: "level"},
+			}},
+			wantSrc:     []string{"created_at", "email"},
+			wantDst:     []string{"created_at", "email"},
+			wantChanged: []string{"message", "level"},
+		},
+		{
+			name:        "redacted column counted only",
+			cfg:         config.Config{Redact: []redact.Rule{{Column: "email", Action: redact.ActionNull}}},
+			wantSrc:     []string{"created_at", "msg", "level"},
+			wantDst:     []string{"created_at", "message", "level"},
+			wantChanged: []string{"email"},
+		},
+		{
+			name:        "transform without column disables checksum",
+			cfg:         config.Config{Transforms: []transform.Spec{{Type: "custom"}}},
+			wantChanged: dst,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotSrc, gotDst, gotChanged := checksumColumns(tt.cfg, src, dst)
+			if !reflect.DeepEqual(gotSrc, tt.wantSrc) || !reflect.DeepEqual(gotDst, tt.wantDst) {
+				t.Errorf("checksumColumns() = %v, %v, want %v, %v", gotSrc, gotDst, tt.wantSrc, tt.wantDst)
+			}
+			if !reflect.DeepEqual(gotChanged, tt.wantChanged) {
+				t.Errorf("checksumColumns() changed = %v, want %v", gotChanged, tt.wantChanged)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package progress
+
+import (
+	"context"
+	"time"
+)
+
+// Snapshot текущие значения счетчиков миграции
+type Snapshot struct {
+	ShardsDone  uint64
+	ShardsTotal uint64
+	RowsStaged  uint64
+	RowsLoaded  uint64
+	// RowsTotal оценка общего количества строк (0 - оценки нет)
+	RowsTotal uint64
+}
+
+// Status прогресс миграции, рассчитанный по снимку счетчиков
+type Status struct {
+	Snapshot
+	// Percent доля выполненной работы в процентах
+	Percent float64
+	// Rate скорость загрузки, строк в секунду, за скользящее окно
+	Rate float64
+	// ETA оценка оставшегося времени (0 - оценки нет)
+	ETA time.Duration
+}
+
+type sample struct {
+	at   time.Time
+	rows uint64
+}
+
+// Tracker считает скорость загрузки за скользящее окно и оценивает оставшееся время
+type Tracker struct {
+	window  time.Duration
+	samples []sample
+}
+
+func NewTracker(window time.Duration) *Tracker {
+	return &Tracker{window: window}
+}
+
+// Update добавляет снимок, сделанный в момент now, и возвращает прогресс
+func (t *Tracker) Update(now time.Time, snap Snapshot) Status {
+	t.samples = append(t.samples, sample{at: now, rows: snap.RowsLoaded})
+
+	// Отбрасываем снимки старше окна, но оставляем хотя бы один предыдущий для расчета скорости
+	drop := 0
+	for drop < len(t.samples)-2 && now.Sub(t.samples[drop+1].at) >= t.window {
+		drop++
+	}
+	t.samples = t.samples[drop:]
+
+	status := Status{Snapshot: snap, Percent: percent(snap)}
+
+	if first := t.samples[0]; len(t.samples) > 1 && now.After(first.at) && snap.RowsLoaded >= first.rows {
+		status.Rate = float64(snap.RowsLoaded-first.rows) / now.Sub(first.at).Seconds()
+	}
+
+	if status.Rate > 0 && snap.RowsTotal > snap.RowsLoaded {
+		status.ETA = time.Duration(float64(snap.RowsTotal-snap.RowsLoaded) / status.Rate * float64(time.Second))
+	}
+
+	return status
+}
+
+// percent считает долю загруженных строк от оценки, а без оценки - долю завершенных шардов.
+// Оценка строк приблизительная, поэтому до завершения всех шардов прогресс не доходит до 100%
+func percent(snap Snapshot) float64 {
+	if snap.ShardsTotal > 0 && snap.ShardsDone >= snap.ShardsTotal {
+		return 100
+	}
+
+	var p float64
+	switch {
+	case snap.RowsTotal > 0:
+		p = 100 * float64(snap.RowsLoaded) / float64(snap.RowsTotal)
+	case snap.ShardsTotal > 0:
+		p = 100 * float64(snap.ShardsDone) / float64(snap.ShardsTotal)
+	}
+
+	return min(p, 99.9)
+}
+
+// Run каждые interval снимает счетчики через read и передает прогресс в report, пока не отменен контекст
+func Run(ctx context.Context, interval, window time.Duration, read func() Snapshot, report func(Status)) {
+	tracker := NewTracker(window)
+	tracker.Update(time.Now(), read())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			report(tracker.Update(now, read()))
+		}
+	}
+}
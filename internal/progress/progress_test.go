@@ -0,0 +1,122 @@
+package progress
+
+import (
+	"context"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTracker_Update(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := NewTracker(time.Minute)
+
+	tests := []struct {
+		name        string
+		offset      time.Duration
+		snap        Snapshot
+		wantPercent float64
+		wantRate    float64
+		wantETA     time.Duration
+	}{
+		{
+			name:        "first sample has no rate",
+			offset:      0,
+			snap:        Snapshot{ShardsTotal: 10, RowsTotal: 10_000},
+			wantPercent: 0,
+		},
+		{
+			name:        "rate since start",
+			offset:      10 * time.Second,
+			snap:        Snapshot{ShardsDone: 1, ShardsTotal: 10, RowsLoaded: 1_000, RowsTotal: 10_000},
+			wantPercent: 10,
+			wantRate:    100,
+			wantETA:     90 * time.Second,
+		},
+		{
+			name:        "window drops old samples",
+			offset:      80 * time.Second,
+			snap:        Snapshot{ShardsDone: 4, ShardsTotal: 10, RowsLoaded: 4_000, RowsTotal: 10_000},
+			wantPercent: 40,
+			wantRate:    3_000.0 / 70,
+			wantETA:     140 * time.Second,
+		},
+		{
+			name:        "estimate exceeded before all shards done",
+			offset:      90 * time.Second,
+			snap:        Snapshot{ShardsDone: 9, ShardsTotal: 10, RowsLoaded: 12_000, RowsTotal: 10_000},
+			wantPercent: 99.9,
+			wantRate:    11_000.0 / 80,
+		},
+		{
+			name:        "all shards done",
+			offset:      100 * time.Second,
+			snap:        Snapshot{ShardsDone: 10, ShardsTotal: 10, RowsLoaded: 12_500, RowsTotal: 10_000},
+			wantPercent: 100,
+			wantRate:    11_500.0 / 90,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tracker.Update(start.Add(tt.offset), tt.snap)
+
+			if math.Abs(got.Percent-tt.wantPercent) > 1e-9 {
+				t.Errorf("Percent = %v, want %v", got.Percent, tt.wantPercent)
+			}
+			if math.Abs(got.Rate-tt.wantRate) > 1e-9 {
+				t.Errorf("Rate = %v, want %v", got.Rate, tt.wantRate)
+			}
+			if (got.ETA - tt.wantETA).Abs() > time.Millisecond {
+				t.Errorf("ETA = %v, want %v", got.ETA, tt.wantETA)
+			}
+		})
+	}
+}
+
+func TestPercent_ByShards(t *testing.T) {
+	if got := percent(Snapshot{ShardsDone: 3, ShardsTotal: 4}); got != 75 {
+		t.Errorf("percent() = %v, want 75", got)
+	}
+	if got := percent(Snapshot{}); got != 0 {
+		t.Errorf("percent() of empty snapshot = %v, want 0", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var loaded atomic.Uint64
+	reports := make(chan Status, 10)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Run(ctx, 5*time.Millisecond, time.Minute, func() Snapshot {
+			return Snapshot{ShardsTotal: 2, RowsTotal: 100, RowsLoaded: loaded.Add(10)}
+		}, func(s Status) {
+			select {
+			case reports <- s:
+			default:
+			}
+		})
+	}()
+
+	select {
+	case s := <-reports:
+		if s.RowsLoaded == 0 || s.Rate <= 0 {
+			t.Errorf("report = %+v, want loaded rows and positive rate", s)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no progress report")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop after cancel")
+	}
+}
@@ -30,3 +30,41 @@ func Split(min, max, limit uint64) []Range {
 
 	return out
 }
+
+// BoundaryFunc возвращает верхнюю границу следующего шарда, начинающегося после after: ID строки, на которой
+// набирается нужное количество строк. ok=false означает, что до конца таблицы строк меньше, чем нужно
+type BoundaryFunc func(after uint64) (next uint64, ok bool, err error)
+
+// SplitByDensity делит [min,max] на диапазоны по фактическому распределению строк: границы берутся из next,
+// поэтому в каждом диапазоне примерно одинаковое количество строк, а пустые промежутки ID не порождают шардов
+func SplitByDensity(min, max uint64, next BoundaryFunc) ([]Range, error) {
+	if min > max {
+		return []Range{}, nil
+	}
+
+	// Диапазоны полуоткрыты (From, To], поэтому первый начинается с min-1. При min = 0 вычитание переполнилось бы
+	// и диапазонов не было бы вовсе: начинаем с 0, ID 0 автоинкремент не выдает
+	start := uint64(0)
+	if min > 0 {
+		start = min - 1
+	}
+
+	out := make([]Range, 0)
+
+	for cur := start; cur < max; {
+		end, ok, err := next(cur)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok || end >= max {
+			out = append(out, Range{cur, max})
+			break
+		}
+
+		out = append(out, Range{cur, end})
+		cur = end
+	}
+
+	return out, nil
+}
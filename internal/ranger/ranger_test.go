@@ -1,6 +1,8 @@
 package ranger
 
 import (
+	"errors"
+	"slices"
 	"testing"
 )
 
@@ -110,3 +112,110 @@ func TestSplitEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestSplitByDensity(t *testing.T) {
+	// Строки с разреженными ID: плотный участок, большой пустой промежуток и еще один плотный участок
+	ids := []uint64{1, 2, 3, 4, 5, 6, 1000, 1001, 1002, 5000}
+
+	next := func(chunk int) BoundaryFunc {
+		return func(after uint64) (uint64, bool, error) {
+			seen := 0
+			for _, id := range ids {
+				if id <= after {
+					continue
+				}
+				seen++
+				if seen == chunk {
+					return id, true, nil
+				}
+			}
+			return 0, false, nil
+		}
+	}
+
+	t.Run("ranges hold chunk rows and skip gaps", func(t *testing.T) {
+		result, err := SplitByDensity(1, 5000, next(4))
+		if err != nil {
+			t.Fatalf("SplitByDensity() error: %v", err)
+		}
+
+		want := []Range{{0, 4}, {4, 1001}, {1001, 5000}}
+		if len(result) != len(want) {
+			t.Fatalf("SplitByDensity() = %v, want %v", result, want)
+		}
+		for i := range want {
+			if result[i] != want[i] {
+				t.Errorf("SplitByDensity()[%d] = %v, want %v", i, result[i], want[i])
+			}
+		}
+	})
+
+	t.Run("single range when chunk exceeds rows", func(t *testing.T) {
+		result, err := SplitByDensity(1, 5000, next(100))
+		if err != nil {
+			t.Fatalf("SplitByDensity() error: %v", err)
+		}
+
+		if len(result) != 1 || result[0] != (Range{0, 5000}) {
+			t.Errorf("SplitByDensity() = %v, want [{0 5000}]", result)
+		}
+	})
+
+	t.Run("boundary equal to max closes the split", func(t *testing.T) {
+		result, err := SplitByDensity(1, 5000, next(5))
+		if err != nil {
+			t.Fatalf("SplitByDensity() error: %v", err)
+		}
+
+		want := []Range{{0, 5}, {5, 5000}}
+		if len(result) != len(want) {
+			t.Fatalf("SplitByDensity() = %v, want %v", result, want)
+		}
+		for i := range want {
+			if result[i] != want[i] {
+				t.Errorf("SplitByDensity()[%d] = %v, want %v", i, result[i], want[i])
+			}
+		}
+	})
+
+	t.Run("min zero does not wrap around", func(t *testing.T) {
+		result, err := SplitByDensity(0, 5000, next(4))
+		if err != nil {
+			t.Fatalf("SplitByDensity() error: %v", err)
+		}
+
+		want := []Range{{0, 4}, {4, 1001}, {1001, 5000}}
+		if !slices.Equal(result, want) {
+			t.Errorf("SplitByDensity(0, 5000) = %v, want %v", result, want)
+		}
+	})
+
+	t.Run("min and max zero", func(t *testing.T) {
+		result, err := SplitByDensity(0, 0, next(4))
+		if err != nil {
+			t.Fatalf("SplitByDensity() error: %v", err)
+		}
+		if len(result) != 0 {
+			t.Errorf("SplitByDensity(0, 0) should return empty slice, got %v", result)
+		}
+	})
+
+	t.Run("from greater than to", func(t *testing.T) {
+		result, err := SplitByDensity(100, 50, next(4))
+		if err != nil {
+			t.Fatalf("SplitByDensity() error: %v", err)
+		}
+		if len(result) != 0 {
+			t.Errorf("SplitByDensity(100, 50) should return empty slice, got %v", result)
+		}
+	})
+
+	t.Run("propagates errors", func(t *testing.T) {
+		_, err := SplitByDensity(1, 10, func(uint64) (uint64, bool, error) {
+			return 0, false, errors.New("boom")
+		})
+		if err == nil {
+			t.Error("SplitByDensity() should return error from BoundaryFunc")
+		}
+	})
+}
@@ -0,0 +1,220 @@
+// Package redact маскирует персональные данные в колонках в stage-фазе, до того как строка попадет в CSV
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"logs-migrator/pkg/transform"
+	"net"
+	"regexp"
+	"sync/atomic"
+)
+
+// Действия правил
+const (
+	ActionRegex    = "regex"
+	ActionHMAC     = "hmac"
+	ActionTruncate = "truncate"
+	ActionNull     = "null"
+	ActionIP       = "ip_anonymize"
+)
+
+// ipv4Pattern находит IPv4-адреса внутри текста
+var ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+// Rule правило маскирования одной колонки. Параметры зависят от действия: pattern и replacement для regex,
+// length для truncate
+type Rule struct {
+	Name        string `json:"name,omitempty"`
+	Column      string `json:"column"`
+	Action      string `json:"action"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+	Length      int    `json:"length,omitempty"`
+}
+
+// Label возвращает имя правила для отчета: name или column:action
+func (r Rule) Label() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Column + ":" + r.Action
+}
+
+// Validate проверяет правило без привязки к колонкам таблицы
+func (r Rule) Validate() error {
+	if r.Column == "" {
+		return fmt.Errorf("redact rule %s has no column", r.Label())
+	}
+
+	switch r.Action {
+	case ActionRegex:
+		if r.Pattern == "" {
+			return fmt.Errorf("redact rule %s: regex needs a pattern", r.Label())
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("redact rule %s: %w", r.Label(), err)
+		}
+	case ActionTruncate:
+		if r.Length < 1 {
+			return fmt.Errorf("redact rule %s: truncate needs a positive length", r.Label())
+		}
+	case ActionHMAC, ActionNull, ActionIP:
+	default:
+		return fmt.Errorf("redact rule %s: unknown action %q", r.Label(), r.Action)
+	}
+
+	return nil
+}
+
+// Count количество маскирований по правилу
+type Count struct {
+	Rule  string
+	Count uint64
+}
+
+// Redactor применяет правила к строкам и считает маскирования по каждому правилу. Один Redactor
+// используется всеми stage-воркерами таблицы, поэтому счетчики атомарные
+type Redactor struct {
+	rules  []rule
+	key    []byte
+	counts []atomic.Uint64
+}
+
+type rule struct {
+	Rule
+	index int
+	re    *regexp.Regexp
+}
+
+// New привязывает правила к полям строки. key - ключ HMAC, обязателен, если есть правила hmac
+func New(rules []Rule, fields transform.Fields, key []byte) (*Redactor, error) {
+	r := &Redactor{
+		rules:  make([]rule, 0, len(rules)),
+		key:    key,
+		counts: make([]atomic.Uint64, len(rules)),
+	}
+
+	for _, rl := range rules {
+		if err := rl.Validate(); err != nil {
+			return nil, err
+		}
+		if rl.Action == ActionHMAC && len(key) == 0 {
+			return nil, fmt.Errorf("redact rule %s: hmac needs a key, set -redact-key-file or MIGRATOR_REDACT_KEY", rl.Label())
+		}
+
+		i, err := fields.Index(rl.Column)
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %s: %w", rl.Label(), err)
+		}
+
+		c := rule{Rule: rl, index: i}
+		if rl.Action == ActionRegex {
+			c.re = regexp.MustCompile(rl.Pattern)
+		}
+		r.rules = append(r.rules, c)
+	}
+
+	return r, nil
+}
+
+// Transform маскирует значения строки по порядку правил. NULL не меняется, числа и даты маскирует
+// только правило null
+func (r *Redactor) Transform(values []any) error {
+	for n, rl := range r.rules {
+		v := values[rl.index]
+		if v == nil {
+			continue
+		}
+
+		if rl.Action == ActionNull {
+			values[rl.index] = nil
+			r.counts[n].Add(1)
+			continue
+		}
+
+		s, ok := transform.Text(v)
+		if !ok {
+			continue
+		}
+
+		if out, hits := r.apply(rl, s); hits > 0 {
+			values[rl.index] = out
+			r.counts[n].Add(hits)
+		}
+	}
+	return nil
+}
+
+// Counts возвращает количество маскирований по каждому правилу в порядке правил
+func (r *Redactor) Counts() []Count {
+	out := make([]Count, 0, len(r.rules))
+	for n, rl := range r.rules {
+		out = append(out, Count{Rule: rl.Label(), Count: r.counts[n].Load()})
+	}
+	return out
+}
+
+// apply применяет правило к строке и возвращает результат и количество маскирований: для regex и
+// ip_anonymize - количество замененных вхождений, для остальных действий - 1 за измененное значение
+func (r *Redactor) apply(rl rule, s string) (string, uint64) {
+	switch rl.Action {
+	case ActionRegex:
+		hits := uint64(len(rl.re.FindAllStringIndex(s, -1)))
+		if hits == 0 {
+			return s, 0
+		}
+		return rl.re.ReplaceAllString(s, rl.Replacement), hits
+	case ActionHMAC:
+		mac := hmac.New(sha256.New, r.key)
+		mac.Write([]byte(s))
+		return hex.EncodeToString(mac.Sum(nil)), 1
+	case ActionTruncate:
+		n := 0
+		for pos := range s {
+			if n == rl.Length {
+				return s[:pos], 1
+			}
+			n++
+		}
+		return s, 0
+	case ActionIP:
+		return anonymizeIPs(s)
+	}
+	return s, 0
+}
+
+// anonymizeIPs обнуляет в адресах биты хоста: у IPv4 последний октет (/24), у IPv6 все после /48.
+// Если значение целиком не адрес, маскируются IPv4-адреса внутри текста
+func anonymizeIPs(s string) (string, uint64) {
+	if ip := net.ParseIP(s); ip != nil {
+		masked := maskIP(ip).String()
+		if masked == s {
+			return s, 0
+		}
+		return masked, 1
+	}
+
+	var hits uint64
+	out := ipv4Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		ip := net.ParseIP(m)
+		if ip == nil {
+			return m
+		}
+		masked := maskIP(ip).String()
+		if masked != m {
+			hits++
+		}
+		return masked
+	})
+	return out, hits
+}
+
+func maskIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4.Mask(net.CIDRMask(24, 32))
+	}
+	return ip.Mask(net.CIDRMask(48, 128))
+}
@@ -0,0 +1,122 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRedactor_Transform(t *testing.T) {
+	fields := []string{"nid", "msg", "ip", "token"}
+	key := []byte("secret")
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("abc123"))
+	tokenHash := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name      string
+		rule      Rule
+		row       []any
+		want      []any
+		wantCount uint64
+	}{
+		{
+			name: "regex counts every match",
+			rule: Rule{Name: "emails", Column: "msg", Action: ActionRegex, Pattern: `[\w.+-]+@[\w-]+\.[\w.]+`, Replacement: "[email]"},
+			row:  []any{int64(1), []byte("from a@b.io to c.d@e.com"), nil, nil},
+			want: []any{int64(1), "from [email] to [email]", nil, nil}, wantCount: 2,
+		},
+		{
+			name: "regex without match keeps value",
+			rule: Rule{Column: "msg", Action: ActionRegex, Pattern: `\d+`, Replacement: "#"},
+			row:  []any{int64(1), []byte("no digits"), nil, nil},
+			want: []any{int64(1), []byte("no digits"), nil, nil}, wantCount: 0,
+		},
+		{
+			name: "hmac",
+			rule: Rule{Column: "token", Action: ActionHMAC},
+			row:  []any{int64(1), nil, nil, []byte("abc123")},
+			want: []any{int64(1), nil, nil, tokenHash}, wantCount: 1,
+		},
+		{
+			name: "truncate",
+			rule: Rule{Column: "msg", Action: ActionTruncate, Length: 4},
+			row:  []any{int64(1), []byte("секретный текст"), nil, nil},
+			want: []any{int64(1), "секр", nil, nil}, wantCount: 1,
+		},
+		{
+			name: "null",
+			rule: Rule{Column: "nid", Action: ActionNull},
+			row:  []any{int64(1), nil, nil, nil},
+			want: []any{nil, nil, nil, nil}, wantCount: 1,
+		},
+		{
+			name: "ipv4 column",
+			rule: Rule{Column: "ip", Action: ActionIP},
+			row:  []any{int64(1), nil, []byte("192.168.10.77"), nil},
+			want: []any{int64(1), nil, "192.168.10.0", nil}, wantCount: 1,
+		},
+		{
+			name: "ipv6 column",
+			rule: Rule{Column: "ip", Action: ActionIP},
+			row:  []any{int64(1), nil, []byte("2001:db8:aaaa:bbbb::1"), nil},
+			want: []any{int64(1), nil, "2001:db8:aaaa::", nil}, wantCount: 1,
+		},
+		{
+			name: "ipv4 inside text",
+			rule: Rule{Column: "msg", Action: ActionIP},
+			row:  []any{int64(1), []byte("login from 10.1.2.3 and 10.1.2.0, version 1.2.3.400"), nil, nil},
+			want: []any{int64(1), "login from 10.1.2.0 and 10.1.2.0, version 1.2.3.400", nil, nil}, wantCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New([]Rule{tt.rule}, fields, key)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if err := r.Transform(tt.row); err != nil {
+				t.Fatalf("Transform() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.row, tt.want) {
+				t.Errorf("Transform() row = %#v, want %#v", tt.row, tt.want)
+			}
+			if got := r.Counts()[0]; got.Count != tt.wantCount || got.Rule != tt.rule.Label() {
+				t.Errorf("Counts() = %+v, want %s: %d", got, tt.rule.Label(), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	fields := []string{"nid", "msg"}
+
+	tests := []struct {
+		name    string
+		rule    Rule
+		key     []byte
+		wantErr string
+	}{
+		{name: "no column", rule: Rule{Action: ActionNull}, wantErr: "has no column"},
+		{name: "unknown action", rule: Rule{Column: "msg", Action: "shuffle"}, wantErr: `unknown action "shuffle"`},
+		{name: "regex without pattern", rule: Rule{Column: "msg", Action: ActionRegex}, wantErr: "needs a pattern"},
+		{name: "invalid regex", rule: Rule{Column: "msg", Action: ActionRegex, Pattern: "("}, wantErr: "missing closing )"},
+		{name: "truncate without length", rule: Rule{Column: "msg", Action: ActionTruncate}, wantErr: "positive length"},
+		{name: "hmac without key", rule: Rule{Column: "msg", Action: ActionHMAC}, wantErr: "set -redact-key"},
+		{name: "unknown column", rule: Rule{Column: "email", Action: ActionNull}, wantErr: "row has no column email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New([]Rule{tt.rule}, fields, tt.key)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("New() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package retry
+
+import (
+	"context"
+	"time"
+)
+
+// Policy описывает, сколько раз и с какими паузами повторять операцию
+type Policy struct {
+	// Attempts количество повторов после первой попытки (0 = без повторов)
+	Attempts int
+	// Backoff пауза перед первым повтором, дальше удваивается
+	Backoff time.Duration
+	// MaxBackoff верхняя граница паузы между повторами (0 = без ограничения)
+	MaxBackoff time.Duration
+	// Retryable решает, стоит ли повторять операцию после ошибки. Если не задана, повторов нет
+	Retryable func(error) bool
+	// OnRetry вызывается перед каждой паузой: номер повтора (с 1), ошибка и длительность паузы
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+// Delay возвращает паузу перед повтором с номером attempt (с 1): Backoff * 2^(attempt-1), но не больше MaxBackoff
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if p.MaxBackoff > 0 && delay >= p.MaxBackoff {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// Do выполняет fn и повторяет ее при ошибках, которые Retryable считает временными. В fn передается номер
+// попытки (0 - первая). Возвращает количество сделанных повторов и последнюю ошибку. Отмена контекста
+// прерывает ожидание и возвращает ошибку контекста
+func (p Policy) Do(ctx context.Context, fn func(attempt int) error) (int, error) {
+	for attempt := 0; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return attempt, nil
+		}
+		if attempt >= p.Attempts || p.Retryable == nil || !p.Retryable(err) || ctx.Err() != nil {
+			return attempt, err
+		}
+
+		delay := p.Delay(attempt + 1)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt+1, err, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
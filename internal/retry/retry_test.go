@@ -0,0 +1,134 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errTransient = errors.New("transient")
+	errFatal     = errors.New("fatal")
+)
+
+func isTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func TestPolicy_Delay(t *testing.T) {
+	p := Policy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := p.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestPolicy_Do(t *testing.T) {
+	tests := []struct {
+		name        string
+		attempts    int
+		errs        []error
+		wantCalls   int
+		wantRetries int
+		wantErr     error
+	}{
+		{
+			name:        "success first try",
+			attempts:    3,
+			errs:        []error{nil},
+			wantCalls:   1,
+			wantRetries: 0,
+		},
+		{
+			name:        "transient then success",
+			attempts:    3,
+			errs:        []error{errTransient, errTransient, nil},
+			wantCalls:   3,
+			wantRetries: 2,
+		},
+		{
+			name:        "fatal is not retried",
+			attempts:    3,
+			errs:        []error{errFatal},
+			wantCalls:   1,
+			wantRetries: 0,
+			wantErr:     errFatal,
+		},
+		{
+			name:        "attempts exhausted",
+			attempts:    2,
+			errs:        []error{errTransient, errTransient, errTransient, nil},
+			wantCalls:   3,
+			wantRetries: 2,
+			wantErr:     errTransient,
+		},
+		{
+			name:        "retries disabled",
+			attempts:    0,
+			errs:        []error{errTransient, nil},
+			wantCalls:   1,
+			wantRetries: 0,
+			wantErr:     errTransient,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls, notified int
+			p := Policy{
+				Attempts:  tt.attempts,
+				Backoff:   time.Microsecond,
+				Retryable: isTransient,
+				OnRetry:   func(int, error, time.Duration) { notified++ },
+			}
+
+			retries, err := p.Do(context.Background(), func(attempt int) error {
+				if attempt != calls {
+					t.Errorf("attempt = %d, want %d", attempt, calls)
+				}
+				calls++
+				return tt.errs[attempt]
+			})
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if retries != tt.wantRetries || notified != tt.wantRetries {
+				t.Errorf("retries = %d, notified = %d, want %d", retries, notified, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestPolicy_DoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Policy{
+		Attempts:  5,
+		Backoff:   time.Hour,
+		Retryable: isTransient,
+		OnRetry:   func(int, error, time.Duration) { cancel() },
+	}
+
+	_, err := p.Do(ctx, func(int) error { return errTransient })
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,338 @@
+// Package schema сравнивает схемы таблицы-источника и целевой таблицы до начала миграции
+package schema
+
+import (
+	"fmt"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/uuidv7"
+	"strings"
+)
+
+// Severity важность расхождения
+type Severity int
+
+const (
+	// Warning расхождение, которое может исказить данные, но не остановит загрузку
+	Warning Severity = iota
+	// Blocking расхождение, из-за которого загрузка упадет или потеряет данные
+	Blocking
+)
+
+func (s Severity) String() string {
+	if s == Blocking {
+		return "error"
+	}
+	return "warning"
+}
+
+// Issue найденное расхождение схем
+type Issue struct {
+	Severity Severity
+	Column   string
+	Message  string
+}
+
+func (i Issue) String() string {
+	if i.Column == "" {
+		return fmt.Sprintf("[%s] %s", i.Severity, i.Message)
+	}
+	return fmt.Sprintf("[%s] %s: %s", i.Severity, i.Column, i.Message)
+}
+
+// Tables схемы и соответствие колонок одной таблицы
+type Tables struct {
+	Src []dbx.ColumnInfo
+	Dst []dbx.ColumnInfo
+
+	Mapping dbx.ColumnMapping
+	// Positional соответствие по позиции (без правил в файле заданий): проверяются количество и порядок колонок
+	Positional bool
+
+	UUIDColumn string
+	SrcNID     string
+	DstNID     string
+}
+
+// CountBlocking возвращает количество блокирующих расхождений
+func CountBlocking(issues []Issue) int {
+	n := 0
+	for _, i := range issues {
+		if i.Severity == Blocking {
+			n++
+		}
+	}
+	return n
+}
+
+// Compare сравнивает схемы по соответствию колонок: количество и порядок колонок, сужение типов, NULL,
+// кодировки, а также типы UUID- и nid-колонок
+func Compare(t Tables) []Issue {
+	var c comparer
+	src := index(t.Src)
+	dst := index(t.Dst)
+
+	if t.Positional {
+		c.order(t)
+	}
+
+	c.keys(t, src, dst)
+
+	// Колонки, которые копируются без преобразования
+	loaded := make(map[string]bool)
+	for _, f := range t.Mapping.Fields {
+		if f.Dst == "" {
+			continue
+		}
+		loaded[strings.ToLower(f.Dst)] = true
+
+		d, ok := dst[strings.ToLower(f.Dst)]
+		if !ok {
+			c.add(Blocking, f.Dst, "destination has no such column")
+			continue
+		}
+		if f.Src == "" {
+			continue
+		}
+		s, ok := src[strings.ToLower(f.Src)]
+		if !ok {
+			c.add(Blocking, f.Src, "source has no such column")
+			continue
+		}
+		if f.Ref {
+			c.ref(s, d)
+			continue
+		}
+		c.pair(s, d)
+	}
+	for _, col := range t.Mapping.Consts {
+		loaded[strings.ToLower(col.Dst)] = true
+	}
+	loaded[strings.ToLower(t.UUIDColumn)] = true
+
+	// Колонки целевой таблицы, которые не загружаются, получают значение по умолчанию
+	for _, d := range t.Dst {
+		if loaded[strings.ToLower(d.Name)] || d.Generated() {
+			continue
+		}
+		switch {
+		case !d.Nullable && !d.Default.Valid:
+			c.add(Blocking, d.Name, "NOT NULL column without default is not loaded")
+		case t.Positional:
+			c.add(Warning, d.Name, "column is not loaded and gets its default value")
+		}
+	}
+
+	return c.issues
+}
+
+type comparer struct {
+	issues []Issue
+}
+
+func (c *comparer) add(sev Severity, column, format string, args ...any) {
+	c.issues = append(c.issues, Issue{Severity: sev, Column: column, Message: fmt.Sprintf(format, args...)})
+}
+
+// order проверяет количество и порядок колонок при соответствии по позиции
+func (c *comparer) order(t Tables) {
+	if len(t.Dst) > 0 && !strings.EqualFold(t.Dst[0].Name, t.UUIDColumn) {
+		c.add(Blocking, t.Dst[0].Name, "positional mapping expects UUID column %s first in destination", t.UUIDColumn)
+	}
+
+	if len(t.Src) != len(t.Dst)-1 {
+		c.add(Warning, "", "column count differs: source has %d, destination has %d plus UUID", len(t.Src), len(t.Dst)-1)
+	}
+
+	for _, f := range t.Mapping.Fields {
+		switch {
+		case f.Dst == "":
+			c.add(Warning, f.Src, "source column is not loaded: destination has no column at its position")
+		case strings.EqualFold(f.Src, t.SrcNID) && strings.EqualFold(f.Dst, t.DstNID):
+			// Переименование nid-колонки - обычная схема миграции
+		case !strings.EqualFold(f.Src, f.Dst):
+			c.add(Warning, f.Src, "loaded by position into %s", f.Dst)
+		}
+	}
+}
+
+// keys проверяет UUID- и nid-колонки
+func (c *comparer) keys(t Tables, src, dst map[string]dbx.ColumnInfo) {
+	if u, ok := dst[strings.ToLower(t.UUIDColumn)]; !ok {
+		c.add(Blocking, t.UUIDColumn, "destination has no UUID column")
+	} else if format := uuidFormat(t.Mapping); !dbx.UUIDFormatFits(format, u) {
+		c.add(Blocking, u.Name, "UUID column %s cannot store %s UUIDs, see -uuid-format", u.ColumnType, format)
+	}
+
+	s, srcOK := src[strings.ToLower(t.SrcNID)]
+	switch {
+	case !srcOK:
+		c.add(Blocking, t.SrcNID, "source has no nid column")
+	case kindOf(s) != kindInt:
+		c.add(Blocking, s.Name, "source nid column must be an integer, got %s", s.ColumnType)
+	}
+
+	d, dstOK := dst[strings.ToLower(t.DstNID)]
+	switch {
+	case !dstOK:
+		c.add(Blocking, t.DstNID, "destination has no nid column")
+	case kindOf(d) != kindInt:
+		c.add(Blocking, d.Name, "destination nid column must be an integer, got %s", d.ColumnType)
+	}
+
+	// Диапазоны шардов, журнал и сверка считают, что nid целевой таблицы равен nid источника
+	for _, f := range t.Mapping.Fields {
+		if strings.EqualFold(f.Dst, t.DstNID) && !strings.EqualFold(f.Src, t.SrcNID) {
+			from := f.Src
+			if from == "" {
+				from = "an expression"
+			}
+			c.add(Blocking, f.Dst, "nid column is loaded from %s, expected source nid %s", from, t.SrcNID)
+		}
+	}
+}
+
+// ref проверяет внешний ключ: в источнике nid родительской строки, в целевой таблице ее UUID
+func (c *comparer) ref(s, d dbx.ColumnInfo) {
+	name := s.Name + " -> " + d.Name
+	if kindOf(s) != kindInt {
+		c.add(Blocking, name, "foreign key must hold an integer nid in source, got %s", s.ColumnType)
+	}
+	if _, err := dbx.DetectUUIDFormat(d); err != nil {
+		c.add(Blocking, name, "foreign key column %s cannot store UUIDs", d.ColumnType)
+	}
+}
+
+// pair сравнивает колонку источника и колонку целевой таблицы, в которую она копируется
+func (c *comparer) pair(s, d dbx.ColumnInfo) {
+	name := s.Name
+	if !strings.EqualFold(s.Name, d.Name) {
+		name = s.Name + " -> " + d.Name
+	}
+
+	if s.Nullable && !d.Nullable {
+		c.add(Blocking, name, "source is nullable, destination is NOT NULL")
+	}
+
+	sk, dk := kindOf(s), kindOf(d)
+	if sk != dk {
+		c.add(Warning, name, "type changes from %s to %s", s.ColumnType, d.ColumnType)
+		return
+	}
+
+	narrowing := func() {
+		c.add(Blocking, name, "type narrowing %s -> %s", s.ColumnType, d.ColumnType)
+	}
+
+	switch sk {
+	case kindInt:
+		switch {
+		case intBytes[d.DataType] < intBytes[s.DataType]:
+			narrowing()
+		case s.Unsigned() && !d.Unsigned() && intBytes[d.DataType] == intBytes[s.DataType]:
+			c.add(Warning, name, "unsigned %s into signed %s: large values overflow", s.ColumnType, d.ColumnType)
+		case !s.Unsigned() && d.Unsigned():
+			c.add(Warning, name, "signed %s into unsigned %s: negative values fail", s.ColumnType, d.ColumnType)
+		}
+	case kindString, kindBinary:
+		if d.MaxLength < s.MaxLength {
+			narrowing()
+		}
+	case kindDecimal:
+		switch {
+		case d.NumericPrecision-d.NumericScale < s.NumericPrecision-s.NumericScale:
+			narrowing()
+		case d.NumericScale < s.NumericScale:
+			c.add(Warning, name, "scale %d -> %d: values are rounded", s.NumericScale, d.NumericScale)
+		}
+	case kindFloat:
+		if s.DataType == "double" && d.DataType == "float" {
+			narrowing()
+		}
+	case kindTemporal:
+		switch {
+		case temporalRank[d.DataType] < temporalRank[s.DataType]:
+			narrowing()
+		case s.DataType == "datetime" && d.DataType == "timestamp":
+			c.add(Warning, name, "DATETIME into TIMESTAMP: values outside 1970-2038 fail")
+		case d.DatetimePrecision < s.DatetimePrecision:
+			c.add(Warning, name, "fractional seconds precision %d -> %d: values are truncated", s.DatetimePrecision, d.DatetimePrecision)
+		}
+	case kindEnum:
+		if !strings.EqualFold(s.ColumnType, d.ColumnType) {
+			c.add(Warning, name, "allowed values differ: %s -> %s", s.ColumnType, d.ColumnType)
+		}
+	case kindBit:
+		if d.NumericPrecision < s.NumericPrecision {
+			narrowing()
+		}
+	}
+
+	if sk == kindString && !strings.EqualFold(s.Charset, d.Charset) {
+		if strings.EqualFold(s.Charset, "utf8mb4") {
+			c.add(Blocking, name, "charset %s -> %s: characters outside %s are lost", s.Charset, d.Charset, d.Charset)
+		} else {
+			c.add(Warning, name, "charset %s -> %s", s.Charset, d.Charset)
+		}
+	}
+}
+
+// Семейства типов MySQL, внутри которых имеет смысл сравнивать размеры
+type kind int
+
+const (
+	kindOther kind = iota
+	kindInt
+	kindDecimal
+	kindFloat
+	kindString
+	kindBinary
+	kindTemporal
+	kindEnum
+	kindBit
+	kindJSON
+)
+
+var intBytes = map[string]int{"tinyint": 1, "smallint": 2, "mediumint": 3, "int": 4, "integer": 4, "bigint": 8}
+
+// temporalRank порядок временных типов по количеству информации: DATE теряет время, YEAR - все, кроме года
+var temporalRank = map[string]int{"year": 1, "time": 1, "date": 2, "timestamp": 3, "datetime": 3}
+
+func kindOf(c dbx.ColumnInfo) kind {
+	switch c.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		return kindInt
+	case "decimal", "numeric":
+		return kindDecimal
+	case "float", "double", "real":
+		return kindFloat
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		return kindString
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return kindBinary
+	case "date", "datetime", "timestamp", "time", "year":
+		return kindTemporal
+	case "enum", "set":
+		return kindEnum
+	case "bit":
+		return kindBit
+	case "json":
+		return kindJSON
+	}
+	return kindOther
+}
+
+// uuidFormat возвращает формат UUID соответствия, пустой формат - binary
+func uuidFormat(m dbx.ColumnMapping) string {
+	if m.UUIDFormat == "" {
+		return uuidv7.FormatBinary
+	}
+	return m.UUIDFormat
+}
+
+func index(columns []dbx.ColumnInfo) map[string]dbx.ColumnInfo {
+	out := make(map[string]dbx.ColumnInfo, len(columns))
+	for _, c := range columns {
+		out[strings.ToLower(c.Name)] = c
+	}
+	return out
+}
@@ -0,0 +1,216 @@
+package schema
+
+import (
+	"database/sql"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/uuidv7"
+	"strings"
+	"testing"
+)
+
+func col(name, dataType, columnType string, opts ...func(*dbx.ColumnInfo)) dbx.ColumnInfo {
+	c := dbx.ColumnInfo{Name: name, DataType: dataType, ColumnType: columnType, Nullable: true}
+	for _, o := range opts {
+		o(&c)
+	}
+	return c
+}
+
+func notNull(c *dbx.ColumnInfo) { c.Nullable = false }
+
+func length(n uint64) func(*dbx.ColumnInfo) {
+	return func(c *dbx.ColumnInfo) { c.MaxLength = n }
+}
+
+func charset(cs string) func(*dbx.ColumnInfo) {
+	return func(c *dbx.ColumnInfo) { c.Charset = cs }
+}
+
+func withDefault(v string) func(*dbx.ColumnInfo) {
+	return func(c *dbx.ColumnInfo) { c.Default = sql.NullString{String: v, Valid: true} }
+}
+
+// logTables возвращает совместимые схемы: источник (id, ins_ts, msg), целевая таблица (uuid, nid, ins_ts, msg)
+func logTables() Tables {
+	src := []dbx.ColumnInfo{
+		col("id", "bigint", "bigint unsigned", notNull),
+		col("ins_ts", "datetime", "datetime", notNull),
+		col("msg", "text", "text", length(65535), charset("utf8mb4")),
+	}
+	dst := []dbx.ColumnInfo{
+		col("id", "binary", "binary(16)", notNull, length(16)),
+		col("nid", "bigint", "bigint unsigned", notNull),
+		col("ins_ts", "datetime", "datetime", notNull),
+		col("msg", "text", "text", length(65535), charset("utf8mb4")),
+	}
+
+	return Tables{
+		Src:        src,
+		Dst:        dst,
+		Mapping:    dbx.PositionalMapping([]string{"id", "ins_ts", "msg"}, []string{"id", "nid", "ins_ts", "msg"}),
+		Positional: true,
+		UUIDColumn: "id",
+		SrcNID:     "id",
+		DstNID:     "nid",
+	}
+}
+
+func TestCompare_Compatible(t *testing.T) {
+	if issues := Compare(logTables()); len(issues) != 0 {
+		t.Errorf("Compare() = %v, want no issues", issues)
+	}
+
+	// Внешний ключ: nid родителя в источнике, UUID родителя в целевой таблице
+	tb := logTables()
+	tb.Src[2] = col("msg", "bigint", "bigint unsigned")
+	tb.Dst[3] = col("msg", "binary", "binary(16)", length(16))
+	tb.Mapping.Fields[2].Ref = true
+	if issues := Compare(tb); len(issues) != 0 {
+		t.Errorf("Compare() with foreign key = %v, want no issues", issues)
+	}
+
+	tb = logTables()
+	tb.Dst[0] = col("id", "uuid", "uuid", notNull)
+	tb.Mapping.UUIDFormat = uuidv7.FormatCanonical
+	if issues := Compare(tb); len(issues) != 0 {
+		t.Errorf("Compare() with MariaDB UUID column = %v, want no issues", issues)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(*Tables)
+		want     string
+		severity Severity
+	}{
+		{
+			name:     "integer narrowing",
+			modify:   func(tb *Tables) { tb.Dst[1] = col("nid", "int", "int unsigned", notNull) },
+			want:     "id -> nid: type narrowing bigint unsigned -> int unsigned",
+			severity: Blocking,
+		},
+		{
+			name:     "text into varchar",
+			modify:   func(tb *Tables) { tb.Dst[3] = col("msg", "varchar", "varchar(255)", length(255), charset("utf8mb4")) },
+			want:     "msg: type narrowing text -> varchar(255)",
+			severity: Blocking,
+		},
+		{
+			name:     "nullable into NOT NULL",
+			modify:   func(tb *Tables) { tb.Dst[3].Nullable = false },
+			want:     "msg: source is nullable, destination is NOT NULL",
+			severity: Blocking,
+		},
+		{
+			name:     "lossy charset",
+			modify:   func(tb *Tables) { tb.Dst[3].Charset = "latin1" },
+			want:     "msg: charset utf8mb4 -> latin1",
+			severity: Blocking,
+		},
+		{
+			name:     "uuid column type",
+			modify:   func(tb *Tables) { tb.Dst[0] = col("id", "char", "char(36)", length(36)) },
+			want:     "id: UUID column char(36) cannot store binary UUIDs",
+			severity: Blocking,
+		},
+		{
+			name: "uuid format does not fit",
+			modify: func(tb *Tables) {
+				tb.Dst[0] = col("id", "char", "char(32)", length(32))
+				tb.Mapping.UUIDFormat = uuidv7.FormatCanonical
+			},
+			want:     "id: UUID column char(32) cannot store canonical UUIDs",
+			severity: Blocking,
+		},
+		{
+			name: "foreign key column cannot store UUIDs",
+			modify: func(tb *Tables) {
+				tb.Dst[3] = col("msg", "bigint", "bigint unsigned")
+				tb.Src[2] = col("msg", "bigint", "bigint unsigned")
+				tb.Mapping.Fields[2].Ref = true
+			},
+			want:     "msg -> msg: foreign key column bigint unsigned cannot store UUIDs",
+			severity: Blocking,
+		},
+		{
+			name:     "source nid type",
+			modify:   func(tb *Tables) { tb.Src[0] = col("id", "varchar", "varchar(32)", length(32)) },
+			want:     "id: source nid column must be an integer",
+			severity: Blocking,
+		},
+		{
+			name: "reordered columns",
+			modify: func(tb *Tables) {
+				tb.Dst[2], tb.Dst[3] = tb.Dst[3], tb.Dst[2]
+				tb.Mapping = dbx.PositionalMapping([]string{"id", "ins_ts", "msg"}, []string{"id", "nid", "msg", "ins_ts"})
+			},
+			want:     "ins_ts: loaded by position into msg",
+			severity: Warning,
+		},
+		{
+			name: "extra source column",
+			modify: func(tb *Tables) {
+				tb.Src = append(tb.Src, col("debug", "text", "text", length(65535)))
+				tb.Mapping = dbx.PositionalMapping([]string{"id", "ins_ts", "msg", "debug"}, []string{"id", "nid", "ins_ts", "msg"})
+			},
+			want:     "column count differs: source has 4, destination has 3 plus UUID",
+			severity: Warning,
+		},
+		{
+			name: "required column not loaded",
+			modify: func(tb *Tables) {
+				tb.Dst = append(tb.Dst, col("source", "varchar", "varchar(16)", notNull, length(16)))
+			},
+			want:     "source: NOT NULL column without default is not loaded",
+			severity: Blocking,
+		},
+		{
+			name: "defaulted column not loaded",
+			modify: func(tb *Tables) {
+				tb.Dst = append(tb.Dst, col("source", "varchar", "varchar(16)", notNull, length(16), withDefault("legacy")))
+			},
+			want:     "source: column is not loaded and gets its default value",
+			severity: Warning,
+		},
+		{
+			name: "nid from another column",
+			modify: func(tb *Tables) {
+				tb.Positional = false
+				tb.Mapping.Fields[0] = dbx.MappedField{Expr: "`id` + 1", Dst: "nid"}
+			},
+			want:     "nid: nid column is loaded from an expression, expected source nid id",
+			severity: Blocking,
+		},
+		{
+			name: "fractional seconds",
+			modify: func(tb *Tables) {
+				tb.Src[1].DatetimePrecision = 6
+				tb.Src[1].ColumnType = "datetime(6)"
+			},
+			want:     "ins_ts: fractional seconds precision 6 -> 0",
+			severity: Warning,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tb := logTables()
+			tt.modify(&tb)
+
+			issues := Compare(tb)
+			for _, i := range issues {
+				if strings.Contains(i.String(), tt.want) {
+					if i.Severity != tt.severity {
+						t.Errorf("issue %q severity = %s, want %s", i, i.Severity, tt.severity)
+					}
+					if tt.severity == Blocking && CountBlocking(issues) == 0 {
+						t.Errorf("CountBlocking() = 0 with blocking issue %q", i)
+					}
+					return
+				}
+			}
+			t.Errorf("Compare() = %v, want issue containing %q", issues, tt.want)
+		})
+	}
+}
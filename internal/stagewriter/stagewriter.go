@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"logs-migrator/internal/util"
 	"logs-migrator/internal/uuidv7"
 	"os"
@@ -25,15 +26,21 @@ type StagedWriter struct {
 	baseDir       string
 	tsColumnIndex int
 	tz            *time.Location
+	uuidFunc      UUIDFunc
 	rowsWritten   uint64
 }
 
+// UUIDFunc формирует UUID строки в виде 32 hex-символов по ее временной метке и значениям полей
+type UUIDFunc func(ts time.Time, values []any) (string, error)
+
+// randomUUID UUIDv7 со случайными битами: формат по умолчанию
+func randomUUID(ts time.Time, _ []any) (string, error) {
+	return uuidv7.FromTime(ts)
+}
+
 // New создает экземпляр StagedWriter
 func New(tmpDir, tableName string, fromID, toID uint64, tsColumnIndex int, tz *time.Location) (*StagedWriter, error) {
-	path := filepath.Join(
-		tmpDir,
-		fmt.Sprintf("stage_%s_%d-%d_%d.csv", tableName, fromID, toID, time.Now().UnixNano()),
-	)
+	path := filepath.Join(tmpDir, FileName(tableName, fromID, toID))
 
 	file, err := os.Create(path)
 	if err != nil {
@@ -56,10 +63,34 @@ func New(tmpDir, tableName string, fromID, toID uint64, tsColumnIndex int, tz *t
 		baseDir:       tmpDir,
 		tsColumnIndex: tsColumnIndex,
 		tz:            tz,
+		uuidFunc:      randomUUID,
 		rowsWritten:   0,
 	}, nil
 }
 
+// NewStream создает экземпляр StagedWriter, который пишет CSV в w, а не во временный файл
+// (например, в io.Pipe для LOAD DATA LOCAL INFILE 'Reader::<name>'). Close только сбрасывает буфер,
+// закрывать w должен вызывающий код
+func NewStream(w io.Writer, tsColumnIndex int, tz *time.Location) *StagedWriter {
+	return &StagedWriter{
+		cw:            csv.NewWriter(bufio.NewWriterSize(w, bufferSize)),
+		tsColumnIndex: tsColumnIndex,
+		tz:            tz,
+		uuidFunc:      randomUUID,
+		rowsWritten:   0,
+	}
+}
+
+// SetUUIDFunc задает способ формирования UUID строк вместо UUIDv7 со случайными битами
+func (sw *StagedWriter) SetUUIDFunc(fn UUIDFunc) {
+	sw.uuidFunc = fn
+}
+
+// FileName возвращает уникальное имя временного файла для шарда
+func FileName(tableName string, fromID, toID uint64) string {
+	return fmt.Sprintf("stage_%s_%d-%d_%d.csv", tableName, fromID, toID, time.Now().UnixNano())
+}
+
 // WriteRow записывает строку, добавляя в её начало UUID, сгенерированный из столбца с временной меткой
 func (sw *StagedWriter) WriteRow(values []any) error {
 	// Получаем TS и преобразуем в time.Time
@@ -88,7 +119,7 @@ func (sw *StagedWriter) WriteRow(values []any) error {
 	}
 
 	// Генерируем UUIDv7
-	uuid, err := uuidv7.FromTime(ts)
+	uuid, err := sw.uuidFunc(ts, values)
 	if err != nil {
 		return fmt.Errorf("generate UUID: %w", err)
 	}
@@ -116,6 +147,11 @@ func (sw *StagedWriter) Close() error {
 		return err
 	}
 
+	// Для потока файла нет
+	if sw.file == nil {
+		return nil
+	}
+
 	if err := sw.file.Sync(); err != nil {
 		_ = sw.file.Close()
 		return err
@@ -136,6 +172,9 @@ func (sw *StagedWriter) RowsWritten() uint64 {
 
 // CleanupOnError безопасно удаляет файл
 func (sw *StagedWriter) CleanupOnError() {
+	if sw.file == nil {
+		return
+	}
 	_ = util.SafeRemove(sw.path, sw.baseDir)
 }
 
@@ -149,7 +188,8 @@ func asString(value any) string {
 	case time.Time:
 		// ВАЖНО: НЕ конвертируем в UTC, сохраняем время "как есть"
 		// Это нужно, потому что позже мы парсим строку с правильной таймзоной
-		return x.Format(dateLayout)
+		// Дробная часть секунд сохраняется, нули в конце отбрасываются
+		return x.Format(dateLayout + ".999999")
 	default:
 		return fmt.Sprint(x)
 	}
@@ -1,6 +1,9 @@
 package stagewriter
 
 import (
+	"bytes"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -148,6 +151,31 @@ func TestWriteRow(t *testing.T) {
 		}
 	})
 
+	t.Run("custom UUID func", func(t *testing.T) {
+		var buf bytes.Buffer
+		writer := NewStream(&buf, 1, loc)
+
+		var gotTS time.Time
+		writer.SetUUIDFunc(func(ts time.Time, values []any) (string, error) {
+			gotTS = ts
+			return fmt.Sprintf("%032d", values[0]), nil
+		})
+
+		if err := writer.WriteRow([]any{7, "2024-01-01 12:00:00", "value"}); err != nil {
+			t.Fatalf("WriteRow() error: %v", err)
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close() error: %v", err)
+		}
+
+		if want := "00000000000000000000000000000007,7,2024-01-01 12:00:00,value\n"; buf.String() != want {
+			t.Errorf("CSV = %q, want %q", buf.String(), want)
+		}
+		if !gotTS.Equal(time.Date(2024, 1, 1, 12, 0, 0, 0, loc)) {
+			t.Errorf("UUID func got ts %v", gotTS)
+		}
+	})
+
 	t.Run("empty timestamp returns error", func(t *testing.T) {
 		writer, err := New(tmpDir, "test", 1, 10, 1, loc)
 		if err != nil {
@@ -254,6 +282,33 @@ func TestWriteRow(t *testing.T) {
 	})
 }
 
+func TestNewStream(t *testing.T) {
+	t.Run("writes rows to the stream", func(t *testing.T) {
+		var buf strings.Builder
+
+		writer := NewStream(&buf, 1, time.UTC)
+		if err := writer.WriteRow([]any{1, "2024-01-01 12:00:00", "stream_value"}); err != nil {
+			t.Fatalf("WriteRow() error: %v", err)
+		}
+
+		if err := writer.Close(); err != nil {
+			t.Fatalf("Close() error: %v", err)
+		}
+
+		if !strings.Contains(buf.String(), "stream_value") {
+			t.Errorf("stream content %q does not contain written data", buf.String())
+		}
+		if writer.RowsWritten() != 1 {
+			t.Errorf("RowsWritten() = %d, want 1", writer.RowsWritten())
+		}
+	})
+
+	t.Run("cleanup is a no-op", func(t *testing.T) {
+		writer := NewStream(io.Discard, 1, time.UTC)
+		writer.CleanupOnError()
+	})
+}
+
 func TestClose(t *testing.T) {
 	tmpDir := t.TempDir()
 	loc := time.UTC
@@ -450,6 +505,11 @@ func TestAsString(t *testing.T) {
 			input:    time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
 			expected: "2024-01-01 12:00:00",
 		},
+		{
+			name:     "time.Time with fractional seconds",
+			input:    time.Date(2024, 1, 1, 12, 0, 0, 123450000, time.UTC),
+			expected: "2024-01-01 12:00:00.12345",
+		},
 	}
 
 	for _, tt := range tests {
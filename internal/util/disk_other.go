@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package util
+
+import "errors"
+
+// FreeSpace на этой платформе не поддерживается
+func FreeSpace(dir string) (uint64, error) {
+	return 0, errors.ErrUnsupported
+}
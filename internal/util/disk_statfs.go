@@ -0,0 +1,15 @@
+//go:build linux || darwin || freebsd
+
+package util
+
+import "syscall"
+
+// FreeSpace возвращает количество байт, доступных непривилегированному пользователю в файловой системе dir
+func FreeSpace(dir string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
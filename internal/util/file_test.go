@@ -195,3 +195,17 @@ func TestIsDangerousPath(t *testing.T) {
 		})
 	}
 }
+
+func TestFreeSpace(t *testing.T) {
+	free, err := FreeSpace(t.TempDir())
+	if err != nil {
+		t.Skipf("FreeSpace is not supported: %v", err)
+	}
+	if free == 0 {
+		t.Error("FreeSpace() = 0, want positive value for temp dir")
+	}
+
+	if _, err := FreeSpace(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("FreeSpace() for missing dir should fail")
+	}
+}
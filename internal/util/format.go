@@ -1,9 +1,14 @@
 package util
 
 import (
+	"fmt"
 	"strconv"
+	"strings"
 )
 
+// Суффиксы размеров в байтах (степени 1024)
+var byteUnits = []string{"B", "K", "M", "G", "T"}
+
 func FormatNumber(n uint64) string {
 	s := strconv.FormatUint(n, 10)
 
@@ -13,3 +18,43 @@ func FormatNumber(n uint64) string {
 
 	return s
 }
+
+// FormatBytes форматирует размер в байтах с двоичным суффиксом: 1536 -> "1.5K"
+func FormatBytes(n uint64) string {
+	value := float64(n)
+	unit := 0
+	for value >= 1024 && unit < len(byteUnits)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return strconv.FormatUint(n, 10) + byteUnits[0]
+	}
+
+	return strconv.FormatFloat(value, 'f', 1, 64) + byteUnits[unit]
+}
+
+// ParseBytes разбирает размер с необязательным двоичным суффиксом K, M, G или T: "500G", "1.5T", "1048576"
+func ParseBytes(raw string) (uint64, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(s, "B")
+
+	multiplier := float64(1)
+	for i := len(byteUnits) - 1; i > 0; i-- {
+		if strings.HasSuffix(s, byteUnits[i]) {
+			s = strings.TrimSuffix(s, byteUnits[i])
+			for j := 0; j < i; j++ {
+				multiplier *= 1024
+			}
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+
+	return uint64(value * multiplier), nil
+}
@@ -2,6 +2,9 @@ package util
 
 import "strings"
 
+// quoteReplacer экранирует спецсимволы строкового литерала MySQL
+var quoteReplacer = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`)
+
 func Ident(s string) string {
 	s = strings.TrimSpace(s)
 
@@ -21,3 +24,8 @@ func IdentAll(s []string) []string {
 
 	return result
 }
+
+// Quote возвращает строковый литерал MySQL в одинарных кавычках
+func Quote(s string) string {
+	return "'" + quoteReplacer.Replace(s) + "'"
+}
@@ -136,3 +136,72 @@ func TestFormatNumber(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		input    uint64
+		expected string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1536, "1.5K"},
+		{10 * 1024 * 1024, "10.0M"},
+		{500 * 1024 * 1024 * 1024, "500.0G"},
+		{3 << 40, "3.0T"},
+	}
+
+	for _, tt := range tests {
+		if result := FormatBytes(tt.input); result != tt.expected {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestParseBytes(t *testing.T) {
+	tests := []struct {
+		input     string
+		expected  uint64
+		wantError bool
+	}{
+		{input: "1048576", expected: 1048576},
+		{input: "512K", expected: 512 << 10},
+		{input: "100M", expected: 100 << 20},
+		{input: "500G", expected: 500 << 30},
+		{input: "500gb", expected: 500 << 30},
+		{input: "1.5T", expected: 3 << 39},
+		{input: " 2G ", expected: 2 << 30},
+		{input: "", wantError: true},
+		{input: "abc", wantError: true},
+		{input: "-1G", wantError: true},
+	}
+
+	for _, tt := range tests {
+		result, err := ParseBytes(tt.input)
+		if (err != nil) != tt.wantError {
+			t.Errorf("ParseBytes(%q) error = %v, wantError %v", tt.input, err, tt.wantError)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("ParseBytes(%q) = %d, want %d", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"legacy", "'legacy'"},
+		{"", "''"},
+		{"it's", `'it\'s'`},
+		{`C:\logs`, `'C:\\logs'`},
+		{"a\nb", `'a\nb'`},
+	}
+
+	for _, tt := range tests {
+		if got := Quote(tt.input); got != tt.expected {
+			t.Errorf("Quote(%q) = %s, want %s", tt.input, got, tt.expected)
+		}
+	}
+}
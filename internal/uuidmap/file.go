@@ -0,0 +1,128 @@
+package uuidmap
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// File карта UUID в локальном CSV-файле: src_table,nid,uuid с UUID в виде с дефисами. Файл только дописывается,
+// поэтому при повторе шарда у nid появляется несколько записей, действует последняя
+type File struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+	cw   *csv.Writer
+}
+
+// OpenFile открывает файл карты на дозапись, создавая его при необходимости
+func OpenFile(path string) (*File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("open UUID map file: %w", err)
+	}
+
+	return &File{path: path, file: file, cw: csv.NewWriter(file)}, nil
+}
+
+// NewFile возвращает карту в существующем файле для поиска
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Write дописывает записи в файл и сбрасывает буфер, чтобы записи шарда не терялись при падении процесса
+func (f *File) Write(_ context.Context, entries []Entry) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range entries {
+		if err := f.cw.Write([]string{e.Table, strconv.FormatUint(e.NID, 10), e.Canonical()}); err != nil {
+			return fmt.Errorf("write UUID map file: %w", err)
+		}
+	}
+
+	f.cw.Flush()
+	if err := f.cw.Error(); err != nil {
+		return fmt.Errorf("write UUID map file: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает файл
+func (f *File) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	return f.file.Close()
+}
+
+// Resolve читает файл целиком и возвращает последние записи таблицы для nid и UUID в порядке nid
+func (f *File) Resolve(_ context.Context, table string, nids []uint64, uuids []string) ([]Entry, error) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, fmt.Errorf("open UUID map file: %w", err)
+	}
+	defer file.Close()
+
+	wantNIDs := make(map[uint64]struct{}, len(nids))
+	for _, nid := range nids {
+		wantNIDs[nid] = struct{}{}
+	}
+	wantUUIDs := make(map[string]struct{}, len(uuids))
+	for _, u := range uuids {
+		wantUUIDs[u] = struct{}{}
+	}
+
+	// Последняя запись nid перекрывает предыдущие, поэтому UUID сверяются уже после чтения всего файла.
+	// Запоминаются только nid, которые искали, и nid, у которых хотя бы раз встретился искомый UUID
+	latest := make(map[uint64]string)
+	r := csv.NewReader(bufio.NewReader(file))
+	r.FieldsPerRecord = 3
+	for {
+		rec, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read UUID map file %s: %w", f.path, err)
+		}
+		if rec[0] != table {
+			continue
+		}
+
+		nid, err := strconv.ParseUint(rec[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("read UUID map file %s: %w", f.path, err)
+		}
+		u, err := ParseUUID(rec[2])
+		if err != nil {
+			return nil, fmt.Errorf("read UUID map file %s: %w", f.path, err)
+		}
+		_, seen := latest[nid]
+		_, byNID := wantNIDs[nid]
+		_, byUUID := wantUUIDs[u]
+		if seen || byNID || byUUID {
+			latest[nid] = u
+		}
+	}
+
+	var out []Entry
+	for nid, u := range latest {
+		_, byNID := wantNIDs[nid]
+		_, byUUID := wantUUIDs[u]
+		if byNID || byUUID {
+			out = append(out, Entry{Table: table, NID: nid, UUID: u})
+		}
+	}
+	slices.SortFunc(out, func(a, b Entry) int { return cmp.Compare(a.NID, b.NID) })
+
+	return out, nil
+}
@@ -0,0 +1,150 @@
+package uuidmap
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"logs-migrator/internal/util"
+	"strings"
+)
+
+// batchSize записей карты в одном REPLACE
+const batchSize = 1000
+
+// Table карта UUID в таблице целевой БД: (src_table, nid) - первичный ключ, uuid - BINARY(16) с индексом
+// для обратного поиска
+type Table struct {
+	db    *sql.DB
+	table string
+}
+
+// OpenTable создает таблицу карты, если ее нет
+func OpenTable(ctx context.Context, db *sql.DB, table string) (*Table, error) {
+	if _, err := db.ExecContext(ctx, BuildCreateTable(table)); err != nil {
+		return nil, fmt.Errorf("create UUID map table %s: %w", table, err)
+	}
+	return &Table{db: db, table: table}, nil
+}
+
+// NewTable возвращает карту в существующей таблице, например для поиска
+func NewTable(db *sql.DB, table string) *Table {
+	return &Table{db: db, table: table}
+}
+
+// BuildCreateTable генерирует CREATE TABLE для таблицы карты
+func BuildCreateTable(table string) string {
+	return fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s ("+
+			"`src_table` VARCHAR(64) NOT NULL, "+
+			"`nid` BIGINT UNSIGNED NOT NULL, "+
+			"`uuid` BINARY(16) NOT NULL, "+
+			"PRIMARY KEY (`src_table`, `nid`), "+
+			"KEY `uuid` (`uuid`))",
+		util.Ident(table),
+	)
+}
+
+// BuildReplace генерирует multi-row REPLACE на rows записей (параметры: src_table, nid, uuid в hex)
+func BuildReplace(table string, rows int) string {
+	tuples := make([]string, rows)
+	for i := range tuples {
+		tuples[i] = "(?,?,UNHEX(?))"
+	}
+
+	return fmt.Sprintf(
+		"REPLACE INTO %s (`src_table`,`nid`,`uuid`) VALUES %s",
+		util.Ident(table),
+		strings.Join(tuples, ","),
+	)
+}
+
+// Write записывает записи пачками по batchSize
+func (t *Table) Write(ctx context.Context, entries []Entry) error {
+	for len(entries) > 0 {
+		n := min(len(entries), batchSize)
+
+		args := make([]any, 0, n*3)
+		for _, e := range entries[:n] {
+			args = append(args, e.Table, e.NID, e.UUID)
+		}
+		if _, err := t.db.ExecContext(ctx, BuildReplace(t.table, n), args...); err != nil {
+			return fmt.Errorf("write UUID map: %w", err)
+		}
+
+		entries = entries[n:]
+	}
+	return nil
+}
+
+// Close ничего не делает: соединением с БД владеет вызывающий код
+func (t *Table) Close() error {
+	return nil
+}
+
+// Resolve ищет записи таблицы карты по nid и по UUID пачками по batchSize
+func (t *Table) Resolve(ctx context.Context, table string, nids []uint64, uuids []string) ([]Entry, error) {
+	var out []Entry
+
+	for len(nids) > 0 {
+		n := min(len(nids), batchSize)
+
+		args := []any{table}
+		for _, nid := range nids[:n] {
+			args = append(args, nid)
+		}
+		entries, err := t.query(ctx, "`nid` IN ("+placeholders(n, "?")+")", args)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+
+		nids = nids[n:]
+	}
+
+	for len(uuids) > 0 {
+		n := min(len(uuids), batchSize)
+
+		args := []any{table}
+		for _, u := range uuids[:n] {
+			args = append(args, u)
+		}
+		entries, err := t.query(ctx, "`uuid` IN ("+placeholders(n, "UNHEX(?)")+")", args)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, entries...)
+
+		uuids = uuids[n:]
+	}
+
+	return out, nil
+}
+
+func (t *Table) query(ctx context.Context, where string, args []any) ([]Entry, error) {
+	q := fmt.Sprintf(
+		"SELECT `src_table`, `nid`, LOWER(HEX(`uuid`)) FROM %s WHERE `src_table` = ? AND %s ORDER BY `nid`",
+		util.Ident(t.table),
+		where,
+	)
+
+	rows, err := t.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query UUID map: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Entry
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.Table, &e.NID, &e.UUID); err != nil {
+			return nil, fmt.Errorf("scan UUID map: %w", err)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// placeholders возвращает n выражений expr через запятую
+func placeholders(n int, expr string) string {
+	return strings.TrimSuffix(strings.Repeat(expr+",", n), ",")
+}
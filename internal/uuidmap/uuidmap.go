@@ -0,0 +1,50 @@
+// Package uuidmap хранит карту UUID: соответствие числовых ID строк источника и UUID, которые им выдал
+// мигратор. По карте другие сервисы и таблицы переводят старые ссылки на строки в новые
+package uuidmap
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Entry запись карты: строка nid таблицы-источника Table получила UUID (32 hex-символа)
+type Entry struct {
+	Table string
+	NID   uint64
+	UUID  string
+}
+
+// Canonical возвращает UUID записи в виде xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func (e Entry) Canonical() string {
+	u := e.UUID
+	if len(u) != 32 {
+		return u
+	}
+	return u[0:8] + "-" + u[8:12] + "-" + u[12:16] + "-" + u[16:20] + "-" + u[20:]
+}
+
+// Sink принимает записи карты во время миграции. Запись одного nid поверх прежней заменяет ее: повтор шарда
+// выдает строкам новые случайные UUID
+type Sink interface {
+	Write(ctx context.Context, entries []Entry) error
+	Close() error
+}
+
+// Resolver ищет записи карты таблицы по nid и по UUID. Ненайденные ключи в результат не попадают
+type Resolver interface {
+	Resolve(ctx context.Context, table string, nids []uint64, uuids []string) ([]Entry, error)
+}
+
+// ParseUUID разбирает UUID с дефисами или без и возвращает 32 hex-символа в нижнем регистре
+func ParseUUID(s string) (string, error) {
+	u := strings.ToLower(strings.ReplaceAll(s, "-", ""))
+	if len(u) != 32 {
+		return "", fmt.Errorf("invalid UUID %q", s)
+	}
+	if _, err := hex.DecodeString(u); err != nil {
+		return "", fmt.Errorf("invalid UUID %q", s)
+	}
+	return u, nil
+}
@@ -0,0 +1,119 @@
+package uuidmap
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseUUID(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "0190c2a1b2c37d4e8f9a0b1c2d3e4f50", want: "0190c2a1b2c37d4e8f9a0b1c2d3e4f50"},
+		{in: "0190C2A1-B2C3-7D4E-8F9A-0B1C2D3E4F50", want: "0190c2a1b2c37d4e8f9a0b1c2d3e4f50"},
+		{in: "0190c2a1b2c37d4e", wantErr: true},
+		{in: "zz90c2a1b2c37d4e8f9a0b1c2d3e4f50", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseUUID(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUUID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseUUID() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEntry_Canonical(t *testing.T) {
+	e := Entry{UUID: "0190c2a1b2c37d4e8f9a0b1c2d3e4f50"}
+	if got, want := e.Canonical(), "0190c2a1-b2c3-7d4e-8f9a-0b1c2d3e4f50"; got != want {
+		t.Errorf("Canonical() = %q, want %q", got, want)
+	}
+}
+
+func TestFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "uuid_map.csv")
+
+	const (
+		first  = "0190c2a1b2c37d4e8f9a0b1c2d3e4f50"
+		retry  = "0190c2a1b2c37d4e8f9a0b1c2d3e4f51"
+		second = "0190c2a1b2c37d4e8f9a0b1c2d3e4f52"
+		other  = "0190c2a1b2c37d4e8f9a0b1c2d3e4f53"
+	)
+
+	f, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile() error = %v", err)
+	}
+	// Повтор шарда дописывает новый UUID для nid 1
+	for _, batch := range [][]Entry{
+		{{Table: "log", NID: 1, UUID: first}, {Table: "log", NID: 2, UUID: second}},
+		{{Table: "log_tag", NID: 1, UUID: other}},
+		{{Table: "log", NID: 1, UUID: retry}},
+	} {
+		if err := f.Write(ctx, batch); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		nids  []uint64
+		uuids []string
+		want  []Entry
+	}{
+		{
+			name: "by nid, last record wins",
+			nids: []uint64{1, 3},
+			want: []Entry{{Table: "log", NID: 1, UUID: retry}},
+		},
+		{
+			name:  "by uuid",
+			uuids: []string{second, first, other},
+			want:  []Entry{{Table: "log", NID: 2, UUID: second}},
+		},
+		{
+			name:  "both",
+			nids:  []uint64{2},
+			uuids: []string{retry},
+			want:  []Entry{{Table: "log", NID: 1, UUID: retry}, {Table: "log", NID: 2, UUID: second}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewFile(path).Resolve(ctx, "log", tt.nids, tt.uuids)
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildReplace(t *testing.T) {
+	got := BuildReplace("uuid_map", 2)
+	want := "REPLACE INTO `uuid_map` (`src_table`,`nid`,`uuid`) VALUES (?,?,UNHEX(?)),(?,?,UNHEX(?))"
+	if got != want {
+		t.Errorf("BuildReplace() = %q, want %q", got, want)
+	}
+
+	if create := BuildCreateTable("uuid_map"); !strings.Contains(create, "PRIMARY KEY (`src_table`, `nid`)") {
+		t.Errorf("BuildCreateTable() = %q, want primary key on (src_table, nid)", create)
+	}
+}
@@ -1,7 +1,9 @@
 package uuidv7
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -10,6 +12,78 @@ import (
 
 // FromTime returns UUIDv7 as 32-hex string (no dashes), per draft.
 func FromTime(t time.Time) (string, error) {
+	var rnd [10]byte
+	if _, err := io.ReadFull(rand.Reader, rnd[:]); err != nil {
+		return "", err
+	}
+
+	return encode(t, rnd), nil
+}
+
+// Keyed returns UUIDv7 as 32-hex string whose 74 random bits are taken from HMAC-SHA256(key, table, nid).
+// The same row of the same table always gets the same UUID, so re-migrating a range is idempotent.
+func Keyed(t time.Time, key []byte, table string, nid uint64) string {
+	return encode(t, keyedBits(key, table, nid))
+}
+
+// NIDBits is the width of the nid counter in Monotonic UUIDs.
+const NIDBits = 48
+
+// Monotonic returns UUIDv7 as 32-hex string that sorts by (t, nid) even within one millisecond
+// (RFC 9562, section 6.2): rand_a holds the sub-millisecond fraction of t (method 3), the first 48 bits
+// of rand_b hold nid as a dedicated counter (method 1), the last 14 bits are random.
+// nid above 2^48-1 wraps and loses the order.
+func Monotonic(t time.Time, nid uint64) (string, error) {
+	var rnd [2]byte
+	if _, err := io.ReadFull(rand.Reader, rnd[:]); err != nil {
+		return "", err
+	}
+
+	return encodeMonotonic(t, nid, binary.BigEndian.Uint16(rnd[:])), nil
+}
+
+// MonotonicKeyed is Monotonic with the last 14 bits taken from HMAC-SHA256(key, table, nid) as in Keyed,
+// so the same row always gets the same UUID.
+func MonotonicKeyed(t time.Time, key []byte, table string, nid uint64) string {
+	bits := keyedBits(key, table, nid)
+	return encodeMonotonic(t, nid, binary.BigEndian.Uint16(bits[:2]))
+}
+
+// keyedBits returns 80 bits of HMAC-SHA256(key, table, nid).
+func keyedBits(key []byte, table string, nid uint64) [10]byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(table))
+	// Разделитель, чтобы пары (table, nid) не склеивались в одинаковые байты
+	mac.Write([]byte{0})
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], nid)
+	mac.Write(n[:])
+
+	var rnd [10]byte
+	copy(rnd[:], mac.Sum(nil))
+	return rnd
+}
+
+// encodeMonotonic builds UUIDv7 with the sub-millisecond fraction of t in rand_a and nid in rand_b.
+func encodeMonotonic(t time.Time, nid uint64, tail uint16) string {
+	// 12-битная доля миллисекунды: наносекунды внутри миллисекунды, отмасштабированные на 4096
+	frac := uint64(t.UTC().UnixNano()%int64(time.Millisecond)) * 4096 / uint64(time.Millisecond)
+	randB := (nid&(1<<NIDBits-1))<<14 | uint64(tail&0x3FFF)
+
+	// Раскладка rnd повторяет encode: rand_a - старшая тетрада rnd[0] и rnd[1], rand_b - 6 бит rnd[2] и rnd[3:]
+	var rnd [10]byte
+	rnd[0] = byte(frac>>8) << 4
+	rnd[1] = byte(frac)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], randB)
+	rnd[2] = b[0] & 0x3F
+	copy(rnd[3:], b[1:])
+
+	return encode(t, rnd)
+}
+
+// encode builds UUIDv7 from the millisecond timestamp of t and 74 bits of rnd.
+func encode(t time.Time, rnd [10]byte) string {
 	ms := uint64(t.UTC().UnixNano() / int64(time.Millisecond))
 	var b [16]byte
 	// 48-bit timestamp
@@ -20,10 +94,6 @@ func FromTime(t time.Time) (string, error) {
 	b[4] = byte(ms >> 8)
 	b[5] = byte(ms)
 
-	var rnd [10]byte
-	if _, err := io.ReadFull(rand.Reader, rnd[:]); err != nil {
-		return "", err
-	}
 	// version 7 (0b0111) in high 4 bits of byte 6
 	b[6] = 0x70 | (rnd[0] >> 4)
 	b[7] = rnd[1]
@@ -36,5 +106,50 @@ func FromTime(t time.Time) (string, error) {
 		binary.BigEndian.Uint16(b[4:6]),
 		binary.BigEndian.Uint16(b[6:8]),
 		binary.BigEndian.Uint16(b[8:10]),
-		b[10:]), nil
+		b[10:])
+}
+
+// Formats of UUID in stage files and destination columns.
+const (
+	// FormatBinary is 32-hex in stage files, UNHEX into BINARY(16).
+	FormatBinary = "binary"
+	// FormatHex is 32-hex stored as is, e.g. in CHAR(32).
+	FormatHex = "hex"
+	// FormatCanonical is 36-char string with dashes, e.g. in CHAR(36) or MariaDB UUID.
+	FormatCanonical = "canonical"
+	// FormatSwapped is 32-hex with time-low and time-high swapped as MySQL UUID_TO_BIN(uuid, 1) does,
+	// UNHEX into BINARY(16).
+	FormatSwapped = "swapped"
+)
+
+// Formats lists supported UUID formats.
+var Formats = []string{FormatBinary, FormatHex, FormatCanonical, FormatSwapped}
+
+// Encode converts 32-hex UUID into its stage file representation for format.
+func Encode(uuid, format string) string {
+	if len(uuid) != 32 {
+		return uuid
+	}
+
+	switch format {
+	case FormatCanonical:
+		return uuid[0:8] + "-" + uuid[8:12] + "-" + uuid[12:16] + "-" + uuid[16:20] + "-" + uuid[20:]
+	case FormatSwapped:
+		// time_hi_and_version | time_mid | time_low | остальное
+		return uuid[12:16] + uuid[8:12] + uuid[0:8] + uuid[16:]
+	default:
+		return uuid
+	}
+}
+
+// Decode converts UUID from its stage file representation for format back into 32-hex.
+func Decode(uuid, format string) string {
+	switch {
+	case len(uuid) == 36:
+		return uuid[0:8] + uuid[9:13] + uuid[14:18] + uuid[19:23] + uuid[24:]
+	case len(uuid) == 32 && format == FormatSwapped:
+		return uuid[8:16] + uuid[4:8] + uuid[0:4] + uuid[16:]
+	default:
+		return uuid
+	}
 }
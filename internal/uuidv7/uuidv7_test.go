@@ -204,6 +204,119 @@ func TestFromTimeFormat(t *testing.T) {
 	})
 }
 
+func TestKeyed(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	key := []byte("secret")
+
+	uuid := Keyed(ts, key, "log", 42)
+
+	if len(uuid) != 32 {
+		t.Fatalf("UUID length = %d, want 32", len(uuid))
+	}
+	if uuid[12] != '7' {
+		t.Errorf("UUID version = %c, want '7'", uuid[12])
+	}
+	if v := strings.ToUpper(string(uuid[16])); !strings.Contains("89AB", v) {
+		t.Errorf("UUID variant = %s, want one of [8, 9, A, B]", v)
+	}
+
+	random, err := FromTime(ts)
+	if err != nil {
+		t.Fatalf("FromTime() unexpected error: %v", err)
+	}
+	if uuid[:12] != random[:12] {
+		t.Errorf("timestamp part = %s, want %s", uuid[:12], random[:12])
+	}
+
+	tests := []struct {
+		name  string
+		other string
+		same  bool
+	}{
+		{name: "same row", other: Keyed(ts, key, "log", 42), same: true},
+		{name: "other nid", other: Keyed(ts, key, "log", 43)},
+		{name: "other table", other: Keyed(ts, key, "log_api", 42)},
+		{name: "other key", other: Keyed(ts, []byte("other"), "log", 42)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if (tt.other == uuid) != tt.same {
+				t.Errorf("Keyed() = %s, first = %s, want same = %v", tt.other, uuid, tt.same)
+			}
+		})
+	}
+}
+
+func TestMonotonic(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	key := []byte("secret")
+
+	// Строки в порядке (ts, nid): UUID должны идти в том же порядке
+	rows := []struct {
+		ts  time.Time
+		nid uint64
+	}{
+		{base, 1},
+		{base, 2},
+		{base, 1000},
+		{base.Add(250 * time.Microsecond), 3},
+		{base.Add(251 * time.Microsecond), 2},
+		{base.Add(time.Millisecond), 1},
+		{base.Add(time.Millisecond), 1<<NIDBits - 1},
+		{base.Add(time.Second), 0},
+	}
+
+	var prev, prevKeyed string
+	for i, r := range rows {
+		uuid, err := Monotonic(r.ts, r.nid)
+		if err != nil {
+			t.Fatalf("Monotonic() unexpected error: %v", err)
+		}
+		keyed := MonotonicKeyed(r.ts, key, "log", r.nid)
+
+		for _, u := range []string{uuid, keyed} {
+			if len(u) != 32 || u[12] != '7' || !strings.Contains("89ab", string(u[16])) {
+				t.Fatalf("row %d: %s is not a UUIDv7", i, u)
+			}
+		}
+		if i > 0 && (uuid <= prev || keyed <= prevKeyed) {
+			t.Errorf("row %d (%v, %d): %s / %s does not sort after %s / %s", i, r.ts, r.nid, uuid, keyed, prev, prevKeyed)
+		}
+		prev, prevKeyed = uuid, keyed
+	}
+
+	if MonotonicKeyed(base, key, "log", 5) != MonotonicKeyed(base, key, "log", 5) {
+		t.Error("MonotonicKeyed() is not deterministic")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	const uuid = "0190c2a1b2c37d4e8f9a0b1c2d3e4f50"
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: FormatBinary, want: uuid},
+		{format: FormatHex, want: uuid},
+		{format: FormatCanonical, want: "0190c2a1-b2c3-7d4e-8f9a-0b1c2d3e4f50"},
+		// UUID_TO_BIN('0190c2a1-b2c3-7d4e-8f9a-0b1c2d3e4f50', 1)
+		{format: FormatSwapped, want: "7d4eb2c30190c2a18f9a0b1c2d3e4f50"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			if got := Encode(uuid, tt.format); got != tt.want {
+				t.Errorf("Encode(%s) = %s, want %s", tt.format, got, tt.want)
+			}
+			if got := Decode(tt.want, tt.format); got != uuid {
+				t.Errorf("Decode(%s) = %s, want %s", tt.format, got, uuid)
+			}
+		})
+	}
+}
+
 func BenchmarkFromTime(b *testing.B) {
 	now := time.Now()
 
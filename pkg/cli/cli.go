@@ -0,0 +1,156 @@
+// Package cli запускает мигратор так же, как команда logs-migrator. Через него мигратор собирается в своем
+// модуле вместе с трансформерами строк, зарегистрированными в logs-migrator/pkg/transform
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"logs-migrator/internal/config"
+	"logs-migrator/internal/dbx"
+	"logs-migrator/internal/logx"
+	"logs-migrator/internal/metrics"
+	"logs-migrator/internal/migrator"
+	"net"
+	"os"
+)
+
+// Main разбирает аргументы командной строки (без имени программы) и выполняет команду. Как и команда
+// logs-migrator, при ошибке пишет ее в лог и завершает процесс с ненулевым кодом. Отмена ctx прерывает работу
+func Main(ctx context.Context, args []string) {
+	cfg := config.ParseConfig(args)
+
+	// Листенер метрик останавливается вместе с командой
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Настраиваем логгер: уровень и формат уже проверены при разборе конфига
+	if err := logx.Setup(os.Stderr, cfg.LogLevel, cfg.LogFormat); err != nil {
+		logx.Fatal("setup logger", "err", err)
+	}
+
+	// HTTP-листенер с метриками
+	if cfg.MetricsAddr != "" {
+		ln, err := net.Listen("tcp", cfg.MetricsAddr)
+		if err != nil {
+			logx.Fatal("failed to listen for metrics", "addr", cfg.MetricsAddr, "err", err)
+		}
+		go func() {
+			if err := metrics.Serve(ctx, ln); err != nil {
+				slog.Warn("metrics listener stopped", "err", err)
+			}
+		}()
+		slog.Info("serving metrics", "addr", ln.Addr().String(), "path", "/metrics")
+	}
+
+	// Поиск в карте UUID не нужен источник, а с файлом карты - и целевая БД
+	if cfg.Command == config.CommandLookup {
+		runLookup(ctx, cfg)
+		return
+	}
+
+	// коннект к БД-источнику
+	srcDb := dbx.MustOpen(cfg.SrcDSN, cfg.StageWorkers, false)
+	defer func() {
+		if err := srcDb.Close(); err != nil {
+			slog.Warn("failed to close source DB connection", "err", err)
+		}
+	}()
+	slog.Info("connection to source DB opened")
+
+	// коннект к целевой БД (с поддержкой LOCAL INFILE если нужно)
+	dstDb := dbx.MustOpen(cfg.DstDSN, cfg.LoadWorkers, cfg.UseLocalInfile)
+	defer func() {
+		if err := dstDb.Close(); err != nil {
+			slog.Warn("failed to close destination DB connection", "err", err)
+		}
+	}()
+	slog.Info("connection to destination DB opened")
+
+	// Сверка, план и проверка схем не используют временные файлы
+	switch cfg.Command {
+	case config.CommandVerify:
+		if err := migrator.Verify(ctx, srcDb, dstDb, cfg); err != nil {
+			logx.Fatal("verify failed", "err", err)
+		}
+		return
+	case config.CommandPlan:
+		if err := migrator.Plan(ctx, srcDb, dstDb, cfg, os.Stdout); err != nil {
+			logx.Fatal("plan failed", "err", err)
+		}
+		return
+	case config.CommandCheck:
+		if err := migrator.Check(ctx, srcDb, dstDb, cfg, os.Stdout); err != nil {
+			logx.Fatal("schema check failed", "err", err)
+		}
+		return
+	case config.CommandCDC:
+		// Изменения загружаются INSERT из временных файлов на клиенте
+		if err := migrator.CDC(ctx, srcDb, dstDb, os.TempDir(), cfg); err != nil {
+			logx.Fatal("cdc failed", "err", err)
+		}
+		return
+	}
+
+	// Определяем папку для временных файлов
+	var secureDir string
+	if cfg.UseStream {
+		// В потоковом режиме временные файлы не создаются
+		slog.Info("using LOCAL INFILE stream mode, no temp files")
+	} else if cfg.UseLocalInfile {
+		// Для LOCAL INFILE используем временную папку на клиенте
+		secureDir = os.TempDir()
+		slog.Info("using LOCAL INFILE mode", "dir", secureDir)
+	} else if !cfg.UseInsert {
+		// Для INFILE используем secure_file_priv на сервере
+		secureDir = getSecureDir(ctx, dstDb)
+		if secureDir == "" {
+			// Файловая загрузка на сервере недоступна, переключаемся на INSERT
+			slog.Warn("secure_file_priv is NULL/empty, falling back to batched INSERT loader")
+			cfg.UseInsert = true
+		} else {
+			slog.Info("using server INFILE mode", "secure_file_priv", secureDir)
+		}
+	}
+
+	if cfg.UseInsert {
+		// Для INSERT файлы читает сам мигратор, используем временную папку на клиенте
+		secureDir = os.TempDir()
+		slog.Info("using batched INSERT mode", "batch", cfg.InsertBatch, "dir", secureDir)
+	}
+
+	if err := migrator.Run(
+		ctx,
+		srcDb,
+		dstDb,
+		secureDir,
+		cfg,
+	); err != nil {
+		logx.Fatal("migration failed", "err", err)
+	}
+}
+
+func runLookup(ctx context.Context, cfg config.Config) {
+	var dstDb *sql.DB
+	if cfg.UUIDMapFile == "" {
+		dstDb = dbx.MustOpen(cfg.DstDSN, 1, false)
+		defer func() {
+			if err := dstDb.Close(); err != nil {
+				slog.Warn("failed to close destination DB connection", "err", err)
+			}
+		}()
+	}
+
+	if err := migrator.Lookup(ctx, dstDb, cfg, os.Stdout); err != nil {
+		logx.Fatal("lookup failed", "err", err)
+	}
+}
+
+func getSecureDir(ctx context.Context, db *sql.DB) string {
+	dir, err := dbx.SecureFilePriv(ctx, db)
+	if err != nil {
+		logx.Fatal("read secure_file_priv", "err", err)
+	}
+
+	return dir
+}
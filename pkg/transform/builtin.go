@@ -0,0 +1,161 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Встроенные трансформеры. Все они меняют одну колонку, заданную в Spec.Column
+func init() {
+	Register("trim", stringFunc(strings.TrimSpace))
+	Register("lower", stringFunc(strings.ToLower))
+	Register("upper", stringFunc(strings.ToUpper))
+	Register("truncate", newTruncate)
+	Register("map", newMap)
+}
+
+// stringFunc возвращает фабрику трансформера, который применяет fn к строковому значению колонки.
+// NULL и нестроковые значения не меняются
+func stringFunc(fn func(string) string) Factory {
+	return func(spec Spec, fields Fields) (RowTransformer, error) {
+		i, err := column(spec, fields)
+		if err != nil {
+			return nil, err
+		}
+		if err := decodeParams(spec, &struct{}{}); err != nil {
+			return nil, err
+		}
+
+		return Func(func(values []any) error {
+			if s, ok := Text(values[i]); ok {
+				values[i] = fn(s)
+			}
+			return nil
+		}), nil
+	}
+}
+
+// newTruncate обрезает строковое значение до length символов (не байт): {"length": 1000}
+func newTruncate(spec Spec, fields Fields) (RowTransformer, error) {
+	i, err := column(spec, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var p struct {
+		Length int `json:"length"`
+	}
+	if err := decodeParams(spec, &p); err != nil {
+		return nil, err
+	}
+	if p.Length < 1 {
+		return nil, errors.New("params.length must be positive")
+	}
+
+	return Func(func(values []any) error {
+		s, ok := Text(values[i])
+		if !ok || utf8.RuneCountInString(s) <= p.Length {
+			return nil
+		}
+
+		n := 0
+		for pos := range s {
+			if n == p.Length {
+				values[i] = s[:pos]
+				break
+			}
+			n++
+		}
+		return nil
+	}), nil
+}
+
+// newMap заменяет значения по словарю: {"values": {"W": "warning"}, "default": "unknown", "ignore_case": true}.
+// Значение, которого нет в словаре, получает default, а без default не меняется. Числа сравниваются
+// по их десятичной записи, поэтому числовые уровни можно превратить в строковые
+func newMap(spec Spec, fields Fields) (RowTransformer, error) {
+	i, err := column(spec, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var p struct {
+		Values     map[string]string `json:"values"`
+		Default    *string           `json:"default"`
+		IgnoreCase bool              `json:"ignore_case"`
+	}
+	if err := decodeParams(spec, &p); err != nil {
+		return nil, err
+	}
+	if len(p.Values) == 0 {
+		return nil, errors.New("params.values is empty")
+	}
+
+	values := p.Values
+	if p.IgnoreCase {
+		values = make(map[string]string, len(p.Values))
+		for k, v := range p.Values {
+			values[strings.ToLower(k)] = v
+		}
+	}
+
+	return Func(func(row []any) error {
+		if row[i] == nil {
+			return nil
+		}
+
+		key, ok := Text(row[i])
+		if !ok {
+			key = fmt.Sprint(row[i])
+		}
+		if p.IgnoreCase {
+			key = strings.ToLower(key)
+		}
+
+		if v, found := values[key]; found {
+			row[i] = v
+		} else if p.Default != nil {
+			row[i] = *p.Default
+		}
+		return nil
+	}), nil
+}
+
+// column возвращает индекс колонки трансформера
+func column(spec Spec, fields Fields) (int, error) {
+	if spec.Column == "" {
+		return 0, errors.New("column is required")
+	}
+	return fields.Index(spec.Column)
+}
+
+// decodeParams разбирает параметры трансформера. Неизвестные параметры - ошибка, как и неизвестные поля
+// в файле заданий
+func decodeParams(spec Spec, v any) error {
+	if len(spec.Params) == 0 {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(spec.Params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("params: %w", err)
+	}
+	return nil
+}
+
+// Text возвращает строковое значение поля. NULL, числа и даты строками не считаются
+func Text(v any) (string, bool) {
+	switch x := v.(type) {
+	case []byte:
+		return string(x), true
+	case string:
+		return x, true
+	default:
+		return "", false
+	}
+}
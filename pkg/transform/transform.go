@@ -0,0 +1,136 @@
+// Package transform изменяет значения строк в stage-фазе: между Scan и записью строки в CSV.
+// Пакет публичный: свои типы трансформеров регистрируются через Register из пакетов вне модуля
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RowTransformer изменяет значения строки на месте. values - поля строки в порядке соответствия колонок,
+// как их вернул Scan: []byte, int64, float64, time.Time или nil
+type RowTransformer interface {
+	Transform(values []any) error
+}
+
+// Func позволяет использовать функцию как RowTransformer
+type Func func(values []any) error
+
+func (f Func) Transform(values []any) error {
+	return f(values)
+}
+
+// Chain применяет трансформеры по порядку
+type Chain []RowTransformer
+
+func (c Chain) Transform(values []any) error {
+	for _, t := range c {
+		if err := t.Transform(values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Spec описание трансформера в файле заданий: тип, колонка и параметры, которые разбирает фабрика типа
+type Spec struct {
+	Type   string          `json:"type"`
+	Column string          `json:"column,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// Validate проверяет, что тип трансформера зарегистрирован. Колонки и параметры проверяет Build
+func (s Spec) Validate() error {
+	if s.Type == "" {
+		return errors.New("transform has no type")
+	}
+	if !Registered(s.Type) {
+		return fmt.Errorf("unknown transform type %s (known: %s)", s.Type, strings.Join(Types(), ", "))
+	}
+	return nil
+}
+
+// Fields имена полей строки по порядку: целевая колонка поля, а для полей, которые только выгружаются, -
+// колонка источника
+type Fields []string
+
+// Index возвращает индекс поля по имени без учета регистра
+func (f Fields) Index(name string) (int, error) {
+	for i, field := range f {
+		if strings.EqualFold(field, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("row has no column %s", name)
+}
+
+// Factory создает трансформер по описанию. Индексы колонок фабрика находит в fields один раз,
+// чтобы на каждой строке не искать их заново
+type Factory func(spec Spec, fields Fields) (RowTransformer, error)
+
+var (
+	mu        sync.RWMutex
+	factories = make(map[string]Factory)
+)
+
+// Register регистрирует тип трансформера, который можно указать в файле заданий. Вызывается до разбора
+// конфига, обычно из init(). Повторная регистрация типа - ошибка программы
+func Register(name string, f Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if f == nil {
+		panic("transform: Register factory is nil")
+	}
+	if _, dup := factories[name]; dup {
+		panic("transform: Register called twice for " + name)
+	}
+	factories[name] = f
+}
+
+// Registered возвращает true, если тип трансформера зарегистрирован
+func Registered(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	_, ok := factories[name]
+	return ok
+}
+
+// Types возвращает зарегистрированные типы трансформеров по алфавиту
+func Types() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	out := make([]string, 0, len(factories))
+	for name := range factories {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Build создает цепочку трансформеров по описаниям. Пустой список - пустая цепочка
+func Build(specs []Spec, fields Fields) (Chain, error) {
+	chain := make(Chain, 0, len(specs))
+	for i, s := range specs {
+		if err := s.Validate(); err != nil {
+			return nil, fmt.Errorf("transform #%d: %w", i+1, err)
+		}
+
+		mu.RLock()
+		f := factories[s.Type]
+		mu.RUnlock()
+
+		t, err := f(s, fields)
+		if err != nil {
+			return nil, fmt.Errorf("transform #%d (%s): %w", i+1, s.Type, err)
+		}
+		chain = append(chain, t)
+	}
+	return chain, nil
+}
@@ -0,0 +1,135 @@
+package transform
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuild_Builtin(t *testing.T) {
+	fields := Fields{"nid", "level", "msg", "ins_ts"}
+	ts := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		specs []Spec
+		row   []any
+		want  []any
+	}{
+		{
+			name:  "trim",
+			specs: []Spec{{Type: "trim", Column: "msg"}},
+			row:   []any{int64(1), []byte("W"), []byte("  hello \n"), ts},
+			want:  []any{int64(1), []byte("W"), "hello", ts},
+		},
+		{
+			name:  "upper keeps NULL",
+			specs: []Spec{{Type: "upper", Column: "MSG"}},
+			row:   []any{int64(1), []byte("W"), nil, ts},
+			want:  []any{int64(1), []byte("W"), nil, ts},
+		},
+		{
+			name:  "truncate counts characters",
+			specs: []Spec{{Type: "truncate", Column: "msg", Params: json.RawMessage(`{"length": 3}`)}},
+			row:   []any{int64(1), nil, []byte("привет"), ts},
+			want:  []any{int64(1), nil, "при", ts},
+		},
+		{
+			name: "map with default and ignore_case",
+			specs: []Spec{{Type: "map", Column: "level", Params: json.RawMessage(
+				`{"values": {"w": "warning", "e": "error"}, "default": "info", "ignore_case": true}`,
+			)}},
+			row:  []any{int64(1), []byte("W"), []byte("x"), ts},
+			want: []any{int64(1), "warning", []byte("x"), ts},
+		},
+		{
+			name: "map numeric level",
+			specs: []Spec{{Type: "map", Column: "level", Params: json.RawMessage(
+				`{"values": {"3": "error"}, "default": "info"}`,
+			)}},
+			row:  []any{int64(1), int64(5), []byte("x"), ts},
+			want: []any{int64(1), "info", []byte("x"), ts},
+		},
+		{
+			name: "chain applies in order",
+			specs: []Spec{
+				{Type: "trim", Column: "msg"},
+				{Type: "truncate", Column: "msg", Params: json.RawMessage(`{"length": 2}`)},
+				{Type: "upper", Column: "msg"},
+			},
+			row:  []any{int64(1), nil, []byte("  abc"), ts},
+			want: []any{int64(1), nil, "AB", ts},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain, err := Build(tt.specs, fields)
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+			if err := chain.Transform(tt.row); err != nil {
+				t.Fatalf("Transform() error = %v", err)
+			}
+			if !reflect.DeepEqual(tt.row, tt.want) {
+				t.Errorf("Transform() row = %#v, want %#v", tt.row, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuild_Errors(t *testing.T) {
+	fields := Fields{"nid", "msg"}
+
+	tests := []struct {
+		name    string
+		spec    Spec
+		wantErr string
+	}{
+		{name: "no type", spec: Spec{Column: "msg"}, wantErr: "transform has no type"},
+		{name: "unknown type", spec: Spec{Type: "rot13", Column: "msg"}, wantErr: "unknown transform type rot13"},
+		{name: "no column", spec: Spec{Type: "trim"}, wantErr: "column is required"},
+		{name: "unknown column", spec: Spec{Type: "trim", Column: "missing"}, wantErr: "row has no column missing"},
+		{name: "unknown param", spec: Spec{Type: "trim", Column: "msg", Params: json.RawMessage(`{"chars": "x"}`)}, wantErr: "unknown field"},
+		{name: "zero length", spec: Spec{Type: "truncate", Column: "msg", Params: json.RawMessage(`{"length": 0}`)}, wantErr: "length must be positive"},
+		{name: "empty map", spec: Spec{Type: "map", Column: "msg"}, wantErr: "values is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build([]Spec{tt.spec}, fields)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Build() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	errBad := errors.New("bad row")
+	Register("test_reject", func(spec Spec, fields Fields) (RowTransformer, error) {
+		return Func(func(values []any) error { return errBad }), nil
+	})
+
+	if !Registered("test_reject") {
+		t.Fatal("Registered(test_reject) = false after Register")
+	}
+
+	chain, err := Build([]Spec{{Type: "test_reject"}}, nil)
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if err := chain.Transform([]any{}); !errors.Is(err, errBad) {
+		t.Errorf("Transform() error = %v, want %v", err, errBad)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register() did not panic on duplicate name")
+		}
+	}()
+	Register("trim", stringFunc(strings.TrimSpace))
+}